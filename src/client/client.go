@@ -25,10 +25,18 @@ func processCommand(args []string) {
 		handleSearch(args[1:])
 	case "files":
 		handleSearchFiles(args[1:])
+	case "replace":
+		handleReplace(args[1:])
+	case "suggest":
+		handleSuggest(args[1:])
 	case "workspace":
 		handleWorkspace(args[1:])
 	case "server":
 		handleServer(args[1:])
+	case "mcp":
+		handleMCP(args[1:])
+	case "token":
+		handleToken(args[1:])
 	case "version":
 		fmt.Println(running.Version())
 	case "help":
@@ -49,7 +57,11 @@ func printUsage() {
 	fmt.Println("  version         Show current version")
 	fmt.Println("  search          Search for documents matching the query")
 	fmt.Println("  files           Search for files matching the query")
+	fmt.Println("  replace         Replace the matches of the query in files")
+	fmt.Println("  suggest         Suggest indexed keywords starting with a prefix")
 	fmt.Println("  server          Server commands")
 	fmt.Println("  workspace       Workspace commands")
+	fmt.Println("  mcp             Serve the MCP tools over stdio")
+	fmt.Println("  token           API token commands")
 	fmt.Println("  help <command>  Show help for a specific command")
 }
@@ -1,14 +1,19 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/shared/auth"
+	"github.com/codetrek/haystack/shared/running"
 	"github.com/codetrek/haystack/shared/types"
 )
 
@@ -17,13 +22,46 @@ type result struct {
 	StatusCode int
 }
 
+// serverTransport connects to the server by its unix socket if it exists, or by TCP
+var serverTransport = &http.Transport{
+	DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if conf.Get().Global.DisableTCP {
+			addr = ""
+		}
+		return running.DialServer(ctx, addr)
+	},
+}
+
+// tokenTransport sends the default token of the server with every request
+// The token is read for each request, as it's generated when the server starts for the first time.
+type tokenTransport struct{}
+
+func (tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if token := auth.DefaultToken(); token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return serverTransport.RoundTrip(req)
+}
+
+// newServerClient returns an HTTP client of the server, timeout is 0 for no timeout
+func newServerClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: tokenTransport{},
+		Timeout:   timeout,
+	}
+}
+
+// serverURL returns the URL of a path of the server, the host is ignored if it's connected by the socket
+func serverURL(path string) string {
+	return fmt.Sprintf("http://127.0.0.1:%d%s", conf.Get().Global.Port, path)
+}
+
 func serverRequest(api string, postData []byte) (*result, error) {
 	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	client := newServerClient(30 * time.Second)
 
-	apiURL := fmt.Sprintf("http://127.0.0.1:%d/api/v1%s", conf.Get().Global.Port, api)
+	apiURL := serverURL("/api/v1" + api)
 
 	// Send request
 	resp, err := client.Post(
@@ -36,6 +74,11 @@ func serverRequest(api string, postData []byte) (*result, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("status code: %d, message: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
 	result := &result{
 		StatusCode: resp.StatusCode,
 	}
@@ -59,3 +102,40 @@ func serverRequest(api string, postData []byte) (*result, error) {
 
 	return result, nil
 }
+
+// serverStreamRequest sends a request to a streaming API and calls cb for each NDJSON line of the response
+// The request has no overall timeout as the server keeps writing while the results are produced
+func serverStreamRequest(api string, postData []byte, cb func(line []byte) error) error {
+	apiURL := serverURL("/api/v1" + api)
+
+	resp, err := newServerClient(0).Post(apiURL, "application/json", bytes.NewBuffer(postData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status code: %d, message: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// A record contains a whole file result, allow long lines
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		if err := cb(line); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	return nil
+}
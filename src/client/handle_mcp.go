@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	mcpserver "github.com/codetrek/haystack/server/server"
+	"github.com/codetrek/haystack/shared/running"
+)
+
+func handleMCP(args []string) {
+	if len(args) > 0 {
+		// stdout is the protocol stream, so the usage goes to stderr
+		fmt.Fprintln(os.Stderr, "Usage: "+running.ExecutableName()+" mcp")
+		fmt.Fprintln(os.Stderr, "  Serve the MCP tools over stdin and stdout, the server is started if it's not running")
+		return
+	}
+
+	if err := ensureServerRunning(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if err := mcpserver.ServeMCPStdio(forwardMCPMessage); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// ensureServerRunning starts the server if it's not running, and waits until it serves requests
+func ensureServerRunning() error {
+	if !running.IsServerRunning() {
+		running.StartDetachedServer()
+	}
+
+	healthURL := serverURL("/health")
+	client := newServerClient(time.Second)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := client.Get(healthURL)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("server is not ready in time")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// forwardMCPMessage sends an MCP JSON-RPC message to the server
+// The server is started again if it has stopped since, e.g. it's restarted by an upgrade
+func forwardMCPMessage(ctx context.Context, message []byte) ([]byte, error) {
+	response, err := postMCPMessage(ctx, message)
+	if err != nil && ctx.Err() == nil && !running.IsServerRunning() {
+		if err := ensureServerRunning(); err != nil {
+			return nil, err
+		}
+		response, err = postMCPMessage(ctx, message)
+	}
+
+	return response, err
+}
+
+func postMCPMessage(ctx context.Context, message []byte) ([]byte, error) {
+	apiURL := serverURL("/api/v1/mcp/message")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewBuffer(message))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := newServerClient(0).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d, message: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return body, nil
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/shared/running"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func handleReplace(args []string) {
+	// Create a new FlagSet for the replace command
+	replaceCmd := flag.NewFlagSet("replace", flag.ExitOnError)
+
+	// Define flags for replace command
+	maxResults := replaceCmd.Int("limit", conf.Get().Client.DefaultLimit.MaxResults, "Maximum number of matches to search")
+	path := replaceCmd.String("path", "", "Path to replace in")
+	include := replaceCmd.String("include", "", "File patterns to include")
+	exclude := replaceCmd.String("exclude", "", "File patterns to exclude")
+	workspace := replaceCmd.String("workspace", conf.Get().Client.DefaultWorkspace,
+		"Workspace path to replace in, or a comma separated list of paths, globs of paths or \"all\"")
+	ignoreCase := replaceCmd.Bool("ignore-case", false, "Match the query case-insensitively, it's case-sensitive by default")
+	dryRun := replaceCmd.Bool("dry-run", false, "Only print the diffs, files are not changed")
+	metadata := addMetadataFlags(replaceCmd)
+
+	var printUsage = func() {
+		fmt.Println("Usage: " + running.ExecutableName() + " replace [options] <query> <replacement>")
+		fmt.Println("  $0 in the replacement is the matched term, ${1}, ${2}... are the texts matched by its wildcards")
+		fmt.Println("Options:")
+		replaceCmd.PrintDefaults()
+	}
+
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		printUsage()
+		return
+	}
+
+	// Parse the remaining arguments
+	replaceCmd.Parse(args)
+
+	if replaceCmd.NArg() != 2 || replaceCmd.Arg(0) == "" {
+		fmt.Println("Error: A query and a replacement are required")
+		printUsage()
+		return
+	}
+
+	// Prepare the replace request
+	workspacePath, workspaces := parseWorkspaces(*workspace)
+	req := types.ReplaceRequest{
+		SearchContentRequest: types.SearchContentRequest{
+			Workspace:  workspacePath,
+			Workspaces: workspaces,
+			Query:      replaceCmd.Arg(0),
+			Limit: &types.SearchLimit{
+				MaxResults: *maxResults,
+			},
+		},
+		Replacement: replaceCmd.Arg(1),
+		IgnoreCase:  *ignoreCase,
+	}
+
+	filters := &types.SearchFilters{
+		Path:    *path,
+		Include: *include,
+		Exclude: *exclude,
+	}
+	if err := metadata.apply(filters); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if *filters != (types.SearchFilters{}) {
+		req.Filters = filters
+	}
+
+	preview, err := sendReplacePreviewRequest(req)
+	if err != nil {
+		fmt.Printf("Error previewing: %v\n", err)
+		return
+	}
+
+	for _, file := range preview.Files {
+		fmt.Print(file.Diff)
+	}
+
+	fmt.Println("----------------------------------------")
+	fmt.Printf("Found %d replacements in %d files\n", preview.TotalReplacements, len(preview.Files))
+	if preview.Truncate {
+		fmt.Println("(Search results were truncated, not all matches are replaced. Try narrowing your search.)")
+	}
+
+	if *dryRun || len(preview.Files) == 0 {
+		return
+	}
+
+	// Rewrite the previewed files, files changed since the preview are skipped
+	result, err := sendReplaceApplyRequest(types.ReplaceApplyRequest{
+		ReplaceRequest: req,
+		Files:          preview.Files,
+	})
+	if err != nil {
+		fmt.Printf("Error replacing: %v\n", err)
+		return
+	}
+
+	for _, conflict := range result.Conflicts {
+		fmt.Printf("Skipped %s: %s\n", filepath.Join(conflict.Workspace, conflict.File), conflict.Error)
+	}
+	fmt.Printf("Replaced %d matches in %d files\n", result.TotalReplacements, len(result.Files))
+}
+
+func sendReplacePreviewRequest(req types.ReplaceRequest) (*types.ReplacePreviewResult, error) {
+	var preview types.ReplacePreviewResult
+	if err := sendReplaceRequest("/replace/preview", req, &preview); err != nil {
+		return nil, err
+	}
+
+	return &preview, nil
+}
+
+func sendReplaceApplyRequest(req types.ReplaceApplyRequest) (*types.ReplaceApplyResult, error) {
+	var result types.ReplaceApplyResult
+	if err := sendReplaceRequest("/replace/apply", req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func sendReplaceRequest(api string, req any, data any) error {
+	// Marshal request to JSON
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	result, err := serverRequest(api, reqData)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+
+	// Parse response
+	if err := json.Unmarshal(*result.Body.Data, data); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return nil
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/codetrek/haystack/conf"
@@ -21,8 +24,20 @@ func handleSearch(args []string) {
 	path := searchCmd.String("path", "", "Path to search in")
 	include := searchCmd.String("include", "", "File patterns to include")
 	exclude := searchCmd.String("exclude", "", "File patterns to exclude")
-	workspace := searchCmd.String("workspace", conf.Get().Client.DefaultWorkspace, "Workspace path to search in")
+	workspace := searchCmd.String("workspace", conf.Get().Client.DefaultWorkspace,
+		"Workspace path to search in, or a comma separated list of paths, globs of paths or \"all\"")
 	caseSensitive := searchCmd.Bool("case-sensitive", false, "Enable case-sensitive search")
+	timeout := searchCmd.Int("timeout", 0, "Search timeout in milliseconds, 0 to use the server default")
+	multiline := searchCmd.Bool("multiline", false, "Match terms across lines")
+	window := searchCmd.Int("window", 0, "Maximum number of lines a multi-line match may span, 0 for the whole file")
+	fuzzy := searchCmd.Bool("fuzzy", false, "Match indexed keywords similar to the terms, ~term makes a single term fuzzy")
+	fuzzyDistance := searchCmd.Int("fuzzy-distance", 0, "Maximum edit distance of fuzzy terms, 0 for automatic")
+	variants := searchCmd.Bool("variants", false, "Match terms in all identifier styles, e.g. tab_group, tabGroup and tab-group")
+	metadata := addMetadataFlags(searchCmd)
+	scope := searchCmd.String("scope", "", "Where all terms must co-occur: line, window:<lines> or file")
+	explain := searchCmd.Bool("explain", false, "Print the query plan and the statistics of the search")
+	mode := searchCmd.String("mode", "", "count: only count the hits, facets: count the hits by directory, extension and language, "+
+		"estimate: only count the candidate files of the index")
 
 	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
 		fmt.Println("Usage: " + running.ExecutableName() + " search [options] <query>")
@@ -46,8 +61,10 @@ func handleSearch(args []string) {
 	}
 
 	// Prepare the search request
+	workspacePath, workspaces := parseWorkspaces(*workspace)
 	searchReq := types.SearchContentRequest{
-		Workspace:     *workspace,
+		Workspace:     workspacePath,
+		Workspaces:    workspaces,
 		Query:         query,
 		CaseSensitive: *caseSensitive,
 		Limit: &types.SearchLimit{
@@ -55,92 +72,294 @@ func handleSearch(args []string) {
 			MaxResultsPerFile: *maxResultsPerFile,
 		},
 		BeforeAfter: 1,
+		TimeoutMs:   *timeout,
+		Mode:        *mode,
+		Explain:     *explain,
+		Variants:    *variants,
 	}
 
-	// Add filters if specified
-	if *path != "" || *include != "" || *exclude != "" {
-		searchReq.Filters = &types.SearchFilters{
-			Path:    *path,
-			Include: *include,
-			Exclude: *exclude,
+	if *multiline {
+		searchReq.Multiline = &types.SearchMultiline{
+			Window: *window,
+		}
+	}
+
+	if *fuzzy {
+		searchReq.Fuzzy = &types.SearchFuzzy{
+			Distance: *fuzzyDistance,
+		}
+	}
+
+	if *scope != "" {
+		searchScope, err := parseSearchScope(*scope)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
 		}
+		searchReq.Scope = searchScope
+	}
+
+	// Add filters if specified
+	filters := &types.SearchFilters{
+		Path:    *path,
+		Include: *include,
+		Exclude: *exclude,
+	}
+	if err := metadata.apply(filters); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if *filters != (types.SearchFilters{}) {
+		searchReq.Filters = filters
 	}
 
 	// Execute the search
 	fmt.Printf("Searching for: %s (limit: %d, limit-per-file: %d)\n", query, *maxResults, *maxResultsPerFile)
-	results, err := sendSearchRequest(searchReq)
+	fmt.Println("----------------------------------------")
+	summary, err := sendSearchStreamRequest(searchReq, func(result *types.SearchContentResult) {
+		displaySearchResult(result, len(workspaces) > 0)
+	})
 	if err != nil {
 		fmt.Printf("Error searching: %v\n", err)
 		return
 	}
 
-	// Display results
-	displaySearchResults(results)
+	if summary.Explain != nil {
+		displaySearchExplain(summary.Explain)
+	}
+
+	// Only the candidates are counted in the estimate mode
+	if *mode == types.SearchModeEstimate && summary.Counts != nil {
+		fmt.Printf("Estimated %d candidate files (took %dms)\n", summary.Counts.Candidates, summary.TookMs)
+		return
+	}
+
+	// Display summary
+	displaySearchSummary(summary)
 }
 
-func sendSearchRequest(req types.SearchContentRequest) (*types.SearchContentResults, error) {
+// sendSearchStreamRequest sends the search request to the streaming API
+// onResult is called for each matched file as soon as it's received
+func sendSearchStreamRequest(req types.SearchContentRequest,
+	onResult func(result *types.SearchContentResult)) (*types.SearchContentSummary, error) {
 	// Marshal request to JSON
 	reqData, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	result, err := serverRequest("/search/content", reqData)
+	var summary *types.SearchContentSummary
+	err = serverStreamRequest("/search/content/stream", reqData, func(line []byte) error {
+		var record types.SearchContentStreamRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("failed to parse response: %v", err)
+		}
+
+		switch record.Type {
+		case types.StreamRecordResult:
+			if record.Result != nil {
+				onResult(record.Result)
+			}
+		case types.StreamRecordSummary:
+			summary = record.Summary
+		case types.StreamRecordError:
+			return fmt.Errorf("%s", record.Message)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %v", err)
 	}
 
-	// Parse response
-	var searchResp types.SearchContentResults
-	if err := json.Unmarshal(*result.Body.Data, &searchResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+	if summary == nil {
+		return nil, fmt.Errorf("search ended unexpectedly")
 	}
 
-	return &searchResp, nil
+	return summary, nil
 }
 
-func displaySearchResults(resp *types.SearchContentResults) {
-	if len(resp.Results) == 0 {
+// parseSearchScope parses the scope flag, e.g. `file` or `window:5`
+func parseSearchScope(scope string) (*types.SearchScope, error) {
+	switch {
+	case scope == types.SearchScopeLine || scope == types.SearchScopeFile:
+		return &types.SearchScope{Type: scope}, nil
+	case strings.HasPrefix(scope, types.SearchScopeWindow+":"):
+		window, err := strconv.Atoi(strings.TrimPrefix(scope, types.SearchScopeWindow+":"))
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid window scope: %s", scope)
+		}
+		return &types.SearchScope{Type: types.SearchScopeWindow, Window: window}, nil
+	default:
+		return nil, fmt.Errorf("unknown scope: %s", scope)
+	}
+}
+
+func displaySearchResult(result *types.SearchContentResult, showWorkspace bool) {
+	file := result.File
+	if showWorkspace {
+		file = filepath.Join(result.Workspace, result.File)
+	}
+	if result.Overlay {
+		file += " (unsaved)"
+	}
+	fmt.Printf("File: %s\n", file)
+
+	for _, match := range result.Lines {
+		if match.Range != nil && len(match.Span) > 0 {
+			// Show the lines of a multi-line match
+			fmt.Printf("→ %4d@(%d)-%d@(%d): %s\n", match.Range.StartLine, match.Range.StartColumn,
+				match.Range.EndLine, match.Range.EndColumn, match.Line.Content)
+			for _, span := range match.Span {
+				fmt.Printf("  %4d: %s\n", span.LineNumber, span.Content)
+			}
+			continue
+		}
+
+		// Show the term of a scoped match
+		if match.Term != "" {
+			fmt.Printf("→ %4d@(%d,%d) [%s]: %s\n", match.Line.LineNumber, match.Line.Match[0], match.Line.Match[1],
+				match.Term, match.Line.Content)
+			continue
+		}
+
+		// Show the matching line
+		fmt.Printf("→ %4d@(%d,%d): %s\n", match.Line.LineNumber, match.Line.Match[0], match.Line.Match[1], match.Line.Content)
+	}
+
+	if result.Truncate {
+		fmt.Println("  (Results truncated...)")
+	}
+	fmt.Println("----------------------------------------")
+}
+
+func displaySearchSummary(summary *types.SearchContentSummary) {
+	for term, keywords := range summary.Expansions {
+		fmt.Printf("Fuzzy term `%s` expanded to: %s\n", term, strings.Join(keywords, ", "))
+	}
+
+	for term, spellings := range summary.Variants {
+		fmt.Printf("Term `%s` matched as: %s\n", term, strings.Join(spellings, ", "))
+	}
+
+	for _, warning := range summary.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+
+	if summary.Counts != nil {
+		displaySearchCounts(summary.Counts)
+	}
+
+	if summary.TotalFiles == 0 && summary.Counts == nil {
 		fmt.Println("No results found.")
 		return
 	}
 
-	totalHits := 0
-	for _, result := range resp.Results {
-		totalHits += len(result.Lines)
+	cached := ""
+	if summary.Cached {
+		cached = ", cached"
 	}
+	fmt.Printf("Found %d results in %d files (took %dms%s)\n", summary.TotalHits, summary.TotalFiles, summary.TookMs, cached)
 
-	fmt.Printf("Found %d results in %d files:\n", totalHits, len(resp.Results))
-	fmt.Println("----------------------------------------")
+	if summary.Truncate {
+		fmt.Println("(Search results were truncated. Try narrowing your search.)")
+	}
+}
 
-	for _, result := range resp.Results {
-		fmt.Printf("File: %s\n", result.File)
+// displaySearchExplain displays the query plan and the statistics of each workspace
+func displaySearchExplain(explain *types.SearchExplain) {
+	var ms = func(us int64) string {
+		return fmt.Sprintf("%.1fms", float64(us)/1000)
+	}
 
-		for _, match := range result.Lines {
-			// // Show context before the match
-			// for _, beforeLine := range match.Before {
-			// 	fmt.Printf("  %4d: %s\n", beforeLine.LineNumber, beforeLine.Content)
-			// }
+	fmt.Println("Explain:")
+	for _, ws := range explain.Workspaces {
+		scope := ws.Scope
+		if ws.Window > 0 {
+			scope = fmt.Sprintf("%s:%d", ws.Scope, ws.Window)
+		}
+		fmt.Printf("  Workspace: %s\n", ws.Workspace)
+		fmt.Printf("    Query: %s (scope: %s)\n", ws.Tree, scope)
+		for i, clause := range ws.Clauses {
+			fmt.Printf("    Clause %d: %d candidates\n", i+1, clause.Candidates)
+			fmt.Printf("      Regex: %s\n", clause.Regex)
+			if clause.MultilineRegex != "" {
+				fmt.Printf("      Multi-line regex: %s\n", clause.MultilineRegex)
+			}
+			for _, term := range clause.Terms {
+				lookup := fmt.Sprintf("prefix `%s`", term.Prefix)
+				if term.Suffix != "" {
+					lookup = fmt.Sprintf("suffix `%s`", term.Suffix)
+				} else if term.Infix != "" {
+					lookup = fmt.Sprintf("infix `%s`", term.Infix)
+				}
+				if term.Skipped {
+					fmt.Printf("      Term `%s`: %s, skipped as it matches too many keywords\n", term.Pattern, lookup)
+					continue
+				}
+				fmt.Printf("      Term `%s`: %s, ~%d documents, %d candidates\n",
+					term.Pattern, lookup, term.Estimate, term.Candidates)
+				if len(term.Expansions) > 0 {
+					fmt.Printf("        Expanded to: %s\n", strings.Join(term.Expansions, ", "))
+				}
+				if len(term.Variants) > 0 {
+					fmt.Printf("        Variants: %s\n", strings.Join(term.Variants, ", "))
+				}
+			}
+			for _, near := range clause.Near {
+				fmt.Printf("      Near: %s\n", near)
+			}
+			if len(clause.Plan) > 1 {
+				// The candidates left once each term is intersected
+				steps := []string{}
+				for i, pattern := range clause.Plan {
+					if i < len(clause.Intersections) {
+						pattern = fmt.Sprintf("%s (%d)", pattern, clause.Intersections[i])
+					}
+					steps = append(steps, pattern)
+				}
+				fmt.Printf("      Plan: %s\n", strings.Join(steps, " => "))
+			}
+		}
+		fmt.Printf("    Files: %d candidates, %d skipped by filters, %d removed, %d read, %d matched, %d truncated\n",
+			ws.Candidates, ws.FilesSkipped, ws.FilesRemoved, ws.FilesRead, ws.FilesMatched, ws.FilesTruncated)
+		fmt.Printf("    Timings: compile %s, collect %s, match %s\n", ms(ws.CompileUs), ms(ws.CollectUs), ms(ws.MatchUs))
+	}
+
+	if explain.Truncation != "" {
+		fmt.Printf("  Truncated by: %s\n", explain.Truncation)
+	}
+	fmt.Println("----------------------------------------")
+}
 
-			// Show the matching line
-			fmt.Printf("→ %4d@(%d,%d): %s\n", match.Line.LineNumber, match.Line.Match[0], match.Line.Match[1], match.Line.Content)
+// displaySearchCounts displays the counts of the count, facets and estimate modes
+func displaySearchCounts(counts *types.SearchContentCounts) {
+	fmt.Printf("Candidates: %d files\n", counts.Candidates)
 
-			// // Show context after the match
-			// for _, afterLine := range match.After {
-			// 	fmt.Printf("  %4d: %s\n", afterLine.LineNumber, afterLine.Content)
-			// }
-			// fmt.Println()
+	var displayFacets = func(name string, facets map[string]types.SearchFacet) {
+		if len(facets) == 0 {
+			return
 		}
 
-		if result.Truncate {
-			fmt.Println("  (Results truncated...)")
+		keys := make([]string, 0, len(facets))
+		for key := range facets {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if facets[keys[i]].Hits != facets[keys[j]].Hits {
+				return facets[keys[i]].Hits > facets[keys[j]].Hits
+			}
+			return keys[i] < keys[j]
+		})
+
+		fmt.Printf("By %s:\n", name)
+		for _, key := range keys {
+			fmt.Printf("  %-24s %8d hits %6d files\n", key, facets[key].Hits, facets[key].Files)
 		}
-		fmt.Println("----------------------------------------")
 	}
 
-	if resp.Truncate {
-		fmt.Println("(Search results were truncated. Try narrowing your search.)")
-	}
+	displayFacets("directory", counts.Directories)
+	displayFacets("extension", counts.Extensions)
+	displayFacets("language", counts.Languages)
 }
 
 func handleSearchFiles(args []string) {
@@ -149,7 +368,9 @@ func handleSearchFiles(args []string) {
 
 	// Define flags for search command
 	maxResults := searchCmd.Int("limit", conf.Get().Client.DefaultLimit.MaxFilesResults, "Maximum number of results")
-	workspace := searchCmd.String("workspace", conf.Get().Client.DefaultWorkspace, "Workspace path to search in")
+	metadata := addMetadataFlags(searchCmd)
+	workspace := searchCmd.String("workspace", conf.Get().Client.DefaultWorkspace,
+		"Workspace path to search in, or a comma separated list of paths, globs of paths or \"all\"")
 
 	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
 		fmt.Println("Usage: " + running.ExecutableName() + " search [options] <query>")
@@ -173,10 +394,21 @@ func handleSearchFiles(args []string) {
 	}
 
 	// Prepare the search request
+	workspacePath, workspaces := parseWorkspaces(*workspace)
 	searchReq := types.SearchFilesRequest{
-		Workspace: *workspace,
-		Query:     query,
-		Limit:     *maxResults,
+		Workspace:  workspacePath,
+		Workspaces: workspaces,
+		Query:      query,
+		Limit:      *maxResults,
+	}
+
+	filters := &types.SearchFilters{}
+	if err := metadata.apply(filters); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if *filters != (types.SearchFilters{}) {
+		searchReq.Filters = filters
 	}
 
 	// Execute the search
@@ -188,7 +420,7 @@ func handleSearchFiles(args []string) {
 	}
 
 	// Display results
-	displaySearchFilesResults(results)
+	displaySearchFilesResults(results, len(workspaces) > 0)
 }
 
 func sendSearchFilesRequest(req types.SearchFilesRequest) (*types.SearchFilesResult, error) {
@@ -212,7 +444,7 @@ func sendSearchFilesRequest(req types.SearchFilesRequest) (*types.SearchFilesRes
 	return &searchResp, nil
 }
 
-func displaySearchFilesResults(resp *types.SearchFilesResult) {
+func displaySearchFilesResults(resp *types.SearchFilesResult, showWorkspace bool) {
 	if len(resp.Files) == 0 {
 		fmt.Println("No results found.")
 		return
@@ -221,7 +453,91 @@ func displaySearchFilesResults(resp *types.SearchFilesResult) {
 	fmt.Printf("Found %d files:\n", len(resp.Files))
 	fmt.Println("----------------------------------------")
 
+	if showWorkspace {
+		for _, match := range resp.Matches {
+			fmt.Printf("File: %s\n", filepath.Join(match.Workspace, match.File))
+		}
+		return
+	}
+
 	for _, file := range resp.Files {
 		fmt.Printf("File: %s\n", file)
 	}
 }
+
+// metadataFlags are the flags of the metadata filters
+type metadataFlags struct {
+	modifiedAfter  *string
+	modifiedBefore *string
+	minSize        *string
+	maxSize        *string
+}
+
+func addMetadataFlags(cmd *flag.FlagSet) *metadataFlags {
+	return &metadataFlags{
+		modifiedAfter:  cmd.String("modified-after", "", "Only files modified after the time, e.g. 7d, 12h, 2006-01-02"),
+		modifiedBefore: cmd.String("modified-before", "", "Only files modified before the time, e.g. 7d, 12h, 2006-01-02"),
+		minSize:        cmd.String("min-size", "", "Only files at least the size, e.g. 512, 10k, 2M"),
+		maxSize:        cmd.String("max-size", "", "Only files at most the size, e.g. 512, 10k, 2M"),
+	}
+}
+
+// apply sets the metadata filters to filters
+func (m *metadataFlags) apply(filters *types.SearchFilters) error {
+	filters.ModifiedAfter = *m.modifiedAfter
+	filters.ModifiedBefore = *m.modifiedBefore
+
+	var err error
+	if filters.MinSize, err = parseSize(*m.minSize); err != nil {
+		return err
+	}
+	if filters.MaxSize, err = parseSize(*m.maxSize); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseSize parses a size in bytes with an optional k, m or g suffix, e.g. 10k
+func parseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		multiplier = 1024
+	case "m":
+		multiplier = 1024 * 1024
+	case "g":
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	return size * multiplier, nil
+}
+
+// parseWorkspaces parses the workspace flag
+// returns the workspace path, or the workspace patterns if it's a list of paths, a glob of paths or "all"
+func parseWorkspaces(value string) (string, []string) {
+	if value != "all" && !strings.ContainsAny(value, ",*?[") {
+		return value, nil
+	}
+
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return "", patterns
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/codetrek/haystack/conf"
@@ -19,6 +20,7 @@ func handleServer(args []string) {
 		fmt.Println("  start          Start the server")
 		fmt.Println("  stop           Stop the server")
 		fmt.Println("  restart        Restart the server")
+		fmt.Println("  reload         Reload the configuration file")
 		fmt.Println("  run [options]  Run the server")
 		fmt.Println("    -d           Run the server in daemon mode")
 		return
@@ -34,11 +36,13 @@ func handleServer(args []string) {
 		handleServerStop()
 	case "restart":
 		handleServerRestart()
+	case "reload":
+		handleServerReload()
 	case "run":
 		handleServerRun(args[1:])
 	default:
 		fmt.Printf("Unknown server command: %s\n", command)
-		fmt.Println("Available commands: status, start, stop, restart")
+		fmt.Println("Available commands: status, start, stop, restart, reload")
 	}
 }
 
@@ -103,6 +107,34 @@ func handleServerRestart() {
 	fmt.Println("Server restarted")
 }
 
+func handleServerReload() {
+	if !running.IsServerRunning() {
+		fmt.Println("Server is not running")
+		return
+	}
+
+	result, err := serverRequest("/server/reload", []byte{})
+	if err != nil {
+		fmt.Printf("Error reloading config: %v\n", err)
+		return
+	}
+
+	var reload types.ConfigReloadResult
+	if err := json.Unmarshal(*result.Body.Data, &reload); err != nil {
+		fmt.Printf("Error unmarshalling reload result: %v\n", err)
+		return
+	}
+
+	if len(reload.Changed) == 0 {
+		fmt.Printf("Config `%s` reloaded, nothing changed\n", reload.File)
+	} else {
+		fmt.Printf("Config `%s` reloaded, changed: %s\n", reload.File, strings.Join(reload.Changed, ", "))
+	}
+	if len(reload.RestartRequired) > 0 {
+		fmt.Printf("Restart the server to apply: %s\n", strings.Join(reload.RestartRequired, ", "))
+	}
+}
+
 func handleServerStatus() {
 	if !running.IsServerRunning() {
 		fmt.Println("Server is not running")
@@ -122,6 +154,19 @@ func handleServerStatus() {
   Is restarting: %t
   Data path: %s
 	`, status.PID, status.Version, status.ShuttingDown, status.Restarting, status.DataPath)
+
+	if cache := status.SearchCache; cache != nil {
+		fmt.Printf(`
+Search cache:
+  Hits: %d
+  Misses: %d
+  Entries: %d
+  Memory: %.1fMB / %.1fMB
+  Evictions: %d
+  Invalidations: %d
+`, cache.Hits, cache.Misses, cache.Entries, float64(cache.Bytes)/1024/1024, float64(cache.MaxBytes)/1024/1024,
+			cache.Evictions, cache.Invalidations)
+	}
 }
 
 func handleServerStart() {
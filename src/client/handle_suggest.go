@@ -0,0 +1,105 @@
+package client
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/shared/running"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func handleSuggest(args []string) {
+	// Create a new FlagSet for the suggest command
+	suggestCmd := flag.NewFlagSet("suggest", flag.ExitOnError)
+
+	// Define flags for suggest command
+	limit := suggestCmd.Int("limit", 20, "Maximum number of keywords")
+	workspace := suggestCmd.String("workspace", conf.Get().Client.DefaultWorkspace,
+		"Workspace path to suggest from, or a comma separated list of paths, globs of paths or \"all\"")
+	complete := suggestCmd.Bool("complete", false, "Only print the keywords one per line, e.g. for shell completion")
+
+	var printUsage = func() {
+		fmt.Println("Usage: " + running.ExecutableName() + " suggest [options] <prefix>")
+		fmt.Println("Options:")
+		suggestCmd.PrintDefaults()
+	}
+
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		printUsage()
+		return
+	}
+
+	// Parse the remaining arguments
+	suggestCmd.Parse(args)
+
+	prefix := strings.Join(suggestCmd.Args(), " ")
+	if prefix == "" {
+		if *complete {
+			return
+		}
+		fmt.Println("Error: Prefix cannot be empty")
+		printUsage()
+		return
+	}
+
+	workspacePath, workspaces := parseWorkspaces(*workspace)
+	result, err := sendSuggestRequest(types.SearchSuggestRequest{
+		Workspace:  workspacePath,
+		Workspaces: workspaces,
+		Prefix:     prefix,
+		Limit:      *limit,
+	})
+
+	// Completion prints nothing but the keywords, errors are ignored
+	if *complete {
+		if err == nil {
+			for _, suggestion := range result.Suggestions {
+				fmt.Println(suggestion.Keyword)
+			}
+		}
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error suggesting: %v\n", err)
+		return
+	}
+
+	if len(result.Suggestions) == 0 {
+		fmt.Println("No keywords found.")
+		return
+	}
+
+	fmt.Printf("Found %d keywords:\n", len(result.Suggestions))
+	fmt.Println("----------------------------------------")
+	for _, suggestion := range result.Suggestions {
+		fmt.Printf("%-40s %d files\n", suggestion.Keyword, suggestion.Documents)
+	}
+	if result.Truncate {
+		fmt.Println("Too many keywords start with the prefix, only the first ones are ranked, use a longer prefix.")
+	}
+}
+
+func sendSuggestRequest(req types.SearchSuggestRequest) (*types.SearchSuggestResult, error) {
+	// Marshal request to JSON
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	result, err := serverRequest("/search/suggest", reqData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+
+	// Parse response
+	var suggestResp types.SearchSuggestResult
+	if err := json.Unmarshal(*result.Body.Data, &suggestResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return &suggestResp, nil
+}
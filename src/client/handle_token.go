@@ -0,0 +1,132 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/codetrek/haystack/shared/auth"
+	"github.com/codetrek/haystack/shared/running"
+)
+
+func handleToken(args []string) {
+	if len(args) < 1 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Println("Usage: " + running.ExecutableName() + " token <command>")
+		fmt.Println("Commands:")
+		fmt.Println("  list                          List the API tokens")
+		fmt.Println("  show <name>                   Show an API token")
+		fmt.Println("  add <name> [--scope <scope>]  Add an API token, scope is search (default) or admin")
+		fmt.Println("  rotate <name>                 Replace an API token with a new one")
+		fmt.Println("  remove <name>                 Remove an API token")
+		fmt.Println("Tokens are sent as 'Authorization: Bearer <token>', the default one is used by the CLI.")
+		return
+	}
+
+	command := args[0]
+	if command != "list" && len(args) < 2 {
+		fmt.Println("Usage: " + running.ExecutableName() + " token " + command + " <name>")
+		return
+	}
+
+	switch command {
+	case "list":
+		handleTokenList()
+	case "show":
+		handleTokenShow(args[1])
+	case "add":
+		handleTokenAdd(args[1], args[2:])
+	case "rotate":
+		handleTokenRotate(args[1])
+	case "remove":
+		handleTokenRemove(args[1])
+	default:
+		fmt.Printf("Unknown token command: %s\n", command)
+		fmt.Println("Available commands: list, show, add, rotate, remove")
+	}
+}
+
+func handleTokenList() {
+	tokens, err := auth.List()
+	if err != nil {
+		fmt.Printf("Error listing tokens: %v\n", err)
+		return
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("No tokens, the default one is generated when the server starts")
+		return
+	}
+
+	fmt.Printf("%-24s %-8s %-20s %s\n", "NAME", "SCOPE", "CREATED", "TOKEN")
+	for _, token := range tokens {
+		fmt.Printf("%-24s %-8s %-20s %s\n", token.Name, token.Scope, token.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			maskToken(token.Token))
+	}
+}
+
+func handleTokenShow(name string) {
+	tokens, err := auth.List()
+	if err != nil {
+		fmt.Printf("Error showing token: %v\n", err)
+		return
+	}
+
+	for _, token := range tokens {
+		if token.Name == name {
+			fmt.Println(token.Token)
+			return
+		}
+	}
+	fmt.Printf("Error showing token: %v\n", auth.ErrTokenNotFound)
+}
+
+func handleTokenAdd(name string, args []string) {
+	scope := auth.ScopeSearch
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--scope" && i+1 < len(args) {
+			i++
+			var err error
+			if scope, err = auth.ParseScope(args[i]); err != nil {
+				fmt.Printf("Error adding token: %v\n", err)
+				return
+			}
+		} else {
+			fmt.Printf("Unknown option: %s\n", args[i])
+			fmt.Println("Available options: --scope <scope>")
+			return
+		}
+	}
+
+	token, err := auth.Add(name, scope)
+	if err != nil {
+		fmt.Printf("Error adding token: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Added token %s of scope %s:\n%s\n", token.Name, token.Scope, token.Token)
+}
+
+func handleTokenRotate(name string) {
+	token, err := auth.Rotate(name)
+	if err != nil {
+		fmt.Printf("Error rotating token: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Rotated token %s, the old one is rejected from now on:\n%s\n", token.Name, token.Token)
+}
+
+func handleTokenRemove(name string) {
+	if err := auth.Remove(name); err != nil {
+		fmt.Printf("Error removing token: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Removed token %s\n", name)
+}
+
+// maskToken hides the token but its last characters, so it could be told apart
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sync/atomic"
 
 	"github.com/codetrek/haystack/shared/running"
 	"github.com/codetrek/haystack/shared/types"
@@ -14,9 +16,10 @@ import (
 )
 
 const (
-	DefaultMaxFileSize  = 2 * 1024 * 1024
-	DefaultIndexWorkers = 4
-	DefaultPort         = 13134
+	DefaultMaxFileSize   = 2 * 1024 * 1024
+	DefaultIndexWorkers  = 4
+	DefaultSearchWorkers = 4
+	DefaultPort          = 13134
 
 	DefaultMaxResults        = 5000
 	DefaultMaxResultsPerFile = 500
@@ -26,8 +29,13 @@ const (
 	DefaultClientMaxResultsPerFile = 50
 	DefaultClientMaxFileResults    = 100
 
-	DefaultMaxSearchWildcardLength  = 24
-	DefaultMaxSearchKeywordDistance = 32
+	DefaultMaxSearchWildcardLength    = 24
+	DefaultMaxSearchKeywordDistance   = 32
+	DefaultMaxSearchKeywordExpansions = 5000
+	MaxSearchKeywordExpansions        = 100000
+	DefaultSearchTimeoutMs            = 10 * 1000
+	MaxSearchTimeoutMs                = 60 * 1000
+	DefaultSearchCacheSize            = 32 // MB
 )
 
 var (
@@ -37,9 +45,14 @@ var (
 	}
 )
 
+// Global is the configuration shared by the server and the client
+// UnixSocket serves the API on the server.sock socket in the data path too, which only the user could connect to,
+// DisableTCP stops serving it on the port, so the socket is the only way to connect.
 type Global struct {
-	DataPath string `yaml:"data_path,omitempty"`
-	Port     int    `yaml:"port,omitempty"`
+	DataPath   string `yaml:"data_path,omitempty"`
+	Port       int    `yaml:"port,omitempty"`
+	UnixSocket bool   `yaml:"unix_socket,omitempty"`
+	DisableTCP bool   `yaml:"disable_tcp,omitempty"`
 }
 
 type Client struct {
@@ -48,9 +61,19 @@ type Client struct {
 }
 
 type Search struct {
-	MaxWildcardLength  int               `yaml:"max_wildcard_length,omitempty"`
-	MaxKeywordDistance int               `yaml:"max_keyword_distance,omitempty"`
-	Limit              types.SearchLimit `yaml:"limit,omitempty"`
+	MaxWildcardLength    int               `yaml:"max_wildcard_length,omitempty"`
+	MaxKeywordDistance   int               `yaml:"max_keyword_distance,omitempty"`
+	MaxKeywordExpansions int               `yaml:"max_keyword_expansions,omitempty"`
+	Workers              int               `yaml:"workers,omitempty"`
+	TimeoutMs            int               `yaml:"timeout_ms,omitempty"`
+	CacheSize            int64             `yaml:"cache_size,omitempty"`
+	Limit                types.SearchLimit `yaml:"limit,omitempty"`
+}
+
+// MCP is the configuration of the MCP HTTP transports
+// AllowedOrigins are the browser origins allowed besides localhost ones, e.g. "https://example.com", or "*" for any
+type MCP struct {
+	AllowedOrigins []string `yaml:"allowed_origins,omitempty"`
 }
 
 type Server struct {
@@ -58,6 +81,7 @@ type Server struct {
 	IndexWorkers int           `yaml:"index_workers,omitempty"`
 	Filters      types.Filters `yaml:"filters,omitempty"`
 	Search       Search        `yaml:"search,omitempty"`
+	MCP          MCP           `yaml:"mcp,omitempty"`
 	CacheSize    int64         `yaml:"cache_size,omitempty"`
 
 	LoggingStdout bool `yaml:"logging_stdout,omitempty"`
@@ -73,44 +97,59 @@ type Conf struct {
 	} `yaml:"for_test,omitempty"`
 }
 
-var conf = &Conf{
-	Global: Global{
-		Port: DefaultPort,
-	},
-	Client: Client{
-		DefaultWorkspace: "",
-		DefaultLimit: types.SearchLimit{
-			MaxResults:        DefaultClientMaxResults,
-			MaxResultsPerFile: DefaultClientMaxResultsPerFile,
-			MaxFilesResults:   DefaultClientMaxFileResults,
+// defaultConf returns a new configuration of the default values
+func defaultConf() *Conf {
+	return &Conf{
+		Global: Global{
+			Port: DefaultPort,
 		},
-	},
-	Server: Server{
-		MaxFileSize:  DefaultMaxFileSize,
-		IndexWorkers: DefaultIndexWorkers,
-		Filters: types.Filters{
-			Include: DefaultInclude,
-			Exclude: types.Exclude{
-				UseGitIgnore: false,
-				Customized:   DefaultExclude,
+		Client: Client{
+			DefaultWorkspace: "",
+			DefaultLimit: types.SearchLimit{
+				MaxResults:        DefaultClientMaxResults,
+				MaxResultsPerFile: DefaultClientMaxResultsPerFile,
+				MaxFilesResults:   DefaultClientMaxFileResults,
 			},
 		},
-		Search: Search{
-			MaxWildcardLength:  DefaultMaxSearchWildcardLength,
-			MaxKeywordDistance: DefaultMaxSearchKeywordDistance,
-			Limit: types.SearchLimit{
-				MaxResults:        DefaultMaxResults,
-				MaxResultsPerFile: DefaultMaxResultsPerFile,
-				MaxFilesResults:   DefaultMaxFiles,
+		Server: Server{
+			MaxFileSize:  DefaultMaxFileSize,
+			IndexWorkers: DefaultIndexWorkers,
+			Filters: types.Filters{
+				Include: slices.Clone(DefaultInclude),
+				Exclude: types.Exclude{
+					UseGitIgnore: false,
+					Customized:   slices.Clone(DefaultExclude),
+				},
+			},
+			Search: Search{
+				MaxWildcardLength:    DefaultMaxSearchWildcardLength,
+				MaxKeywordDistance:   DefaultMaxSearchKeywordDistance,
+				MaxKeywordExpansions: DefaultMaxSearchKeywordExpansions,
+				Workers:              DefaultSearchWorkers,
+				TimeoutMs:            DefaultSearchTimeoutMs,
+				CacheSize:            DefaultSearchCacheSize,
+				Limit: types.SearchLimit{
+					MaxResults:        DefaultMaxResults,
+					MaxResultsPerFile: DefaultMaxResultsPerFile,
+					MaxFilesResults:   DefaultMaxFiles,
+				},
 			},
 		},
-	},
+	}
 }
 
-var confFile string
+var (
+	current  atomic.Pointer[Conf]
+	confFile string
+)
 
+// Get returns the current configuration, it's replaced as a whole once the configuration file is reloaded
 func Get() *Conf {
-	return conf
+	if c := current.Load(); c != nil {
+		return c
+	}
+	current.CompareAndSwap(nil, defaultConf())
+	return current.Load()
 }
 
 func Load() error {
@@ -135,72 +174,109 @@ func Load() error {
 		confFile = filepath.Join(running.ExecutablePath(), "config.yaml")
 	}
 
-	confBytes := fsutils.ReadFileWithDefault(confFile, []byte(``))
-	if err := yaml.Unmarshal(confBytes, conf); err != nil {
+	state := statFile(confFile)
+	c, err := parse(confFile)
+	if err != nil {
 		return err
 	}
 
-	if conf.Global.DataPath == "" {
-		conf.Global.DataPath = filepath.Join(running.UserHomeDir(), ".haystack")
-	}
-
-	if err := os.Mkdir(conf.Global.DataPath, 0755); err != nil {
+	if err := os.Mkdir(c.Global.DataPath, 0755); err != nil {
 		if !os.IsExist(err) {
 			log.Fatalf("Failed to create home directory: %v", err)
 			return err
 		}
 	}
 
-	if conf.Server.IndexWorkers <= 0 || conf.Server.IndexWorkers > runtime.NumCPU() {
-		conf.Server.IndexWorkers = runtime.NumCPU()
+	current.Store(c)
+	loadedState = state
+	return nil
+}
+
+// parse reads the configuration file over the default values, and adjusts the values out of their ranges
+func parse(file string) (*Conf, error) {
+	c := defaultConf()
+	confBytes := fsutils.ReadFileWithDefault(file, []byte(``))
+	if err := yaml.Unmarshal(confBytes, c); err != nil {
+		return nil, err
 	}
 
-	if conf.Server.MaxFileSize <= 0 {
-		conf.Server.MaxFileSize = DefaultMaxFileSize
+	if c.Global.DataPath == "" {
+		c.Global.DataPath = filepath.Join(running.UserHomeDir(), ".haystack")
 	}
 
-	if conf.Global.Port <= 0 || conf.Global.Port > 65535 {
-		conf.Global.Port = DefaultPort
+	if c.Server.IndexWorkers <= 0 || c.Server.IndexWorkers > runtime.NumCPU() {
+		c.Server.IndexWorkers = runtime.NumCPU()
 	}
 
-	if conf.Server.Search.Limit.MaxResults <= 0 || conf.Server.Search.Limit.MaxResults > DefaultMaxResults {
-		conf.Server.Search.Limit.MaxResults = DefaultMaxResults
+	if c.Server.MaxFileSize <= 0 {
+		c.Server.MaxFileSize = DefaultMaxFileSize
 	}
 
-	if conf.Server.Search.Limit.MaxResultsPerFile <= 0 ||
-		conf.Server.Search.Limit.MaxResultsPerFile > DefaultMaxResultsPerFile {
-		conf.Server.Search.Limit.MaxResultsPerFile = DefaultMaxResultsPerFile
+	if c.Global.Port <= 0 || c.Global.Port > 65535 {
+		c.Global.Port = DefaultPort
 	}
 
-	if conf.Server.Search.Limit.MaxFilesResults <= 0 ||
-		conf.Server.Search.Limit.MaxFilesResults > DefaultMaxFiles {
-		conf.Server.Search.Limit.MaxFilesResults = DefaultMaxFiles
+	// The socket is the only listener if TCP is disabled
+	if c.Global.DisableTCP {
+		c.Global.UnixSocket = true
 	}
 
-	if conf.Server.Search.MaxWildcardLength <= 0 ||
-		conf.Server.Search.MaxWildcardLength > 64 { // 64 is the maximum length of a wildcard
-		conf.Server.Search.MaxWildcardLength = DefaultMaxSearchWildcardLength
+	if c.Server.Search.Limit.MaxResults <= 0 || c.Server.Search.Limit.MaxResults > DefaultMaxResults {
+		c.Server.Search.Limit.MaxResults = DefaultMaxResults
 	}
 
-	if conf.Server.Search.MaxKeywordDistance <= 0 ||
-		conf.Server.Search.MaxKeywordDistance > 128 { // 128 is the maximum distance of a keyword
-		conf.Server.Search.MaxKeywordDistance = DefaultMaxSearchKeywordDistance
+	if c.Server.Search.Limit.MaxResultsPerFile <= 0 ||
+		c.Server.Search.Limit.MaxResultsPerFile > DefaultMaxResultsPerFile {
+		c.Server.Search.Limit.MaxResultsPerFile = DefaultMaxResultsPerFile
 	}
 
-	if conf.Client.DefaultLimit.MaxResults <= 0 ||
-		conf.Client.DefaultLimit.MaxResults > conf.Server.Search.Limit.MaxResults {
-		conf.Client.DefaultLimit.MaxResults = DefaultClientMaxResults
+	if c.Server.Search.Limit.MaxFilesResults <= 0 ||
+		c.Server.Search.Limit.MaxFilesResults > DefaultMaxFiles {
+		c.Server.Search.Limit.MaxFilesResults = DefaultMaxFiles
 	}
 
-	if conf.Client.DefaultLimit.MaxResultsPerFile <= 0 ||
-		conf.Client.DefaultLimit.MaxResultsPerFile > conf.Server.Search.Limit.MaxResultsPerFile {
-		conf.Client.DefaultLimit.MaxResultsPerFile = DefaultClientMaxResultsPerFile
+	if c.Server.Search.MaxWildcardLength <= 0 ||
+		c.Server.Search.MaxWildcardLength > 64 { // 64 is the maximum length of a wildcard
+		c.Server.Search.MaxWildcardLength = DefaultMaxSearchWildcardLength
 	}
 
-	if conf.Client.DefaultLimit.MaxFilesResults <= 0 ||
-		conf.Client.DefaultLimit.MaxFilesResults > DefaultMaxFiles {
-		conf.Client.DefaultLimit.MaxFilesResults = DefaultMaxFiles
+	if c.Server.Search.MaxKeywordDistance <= 0 ||
+		c.Server.Search.MaxKeywordDistance > 128 { // 128 is the maximum distance of a keyword
+		c.Server.Search.MaxKeywordDistance = DefaultMaxSearchKeywordDistance
 	}
 
-	return nil
+	if c.Server.Search.MaxKeywordExpansions <= 0 ||
+		c.Server.Search.MaxKeywordExpansions > MaxSearchKeywordExpansions {
+		c.Server.Search.MaxKeywordExpansions = DefaultMaxSearchKeywordExpansions
+	}
+
+	if c.Server.Search.Workers <= 0 || c.Server.Search.Workers > runtime.NumCPU() {
+		c.Server.Search.Workers = runtime.NumCPU()
+	}
+
+	if c.Server.Search.TimeoutMs <= 0 || c.Server.Search.TimeoutMs > MaxSearchTimeoutMs {
+		c.Server.Search.TimeoutMs = DefaultSearchTimeoutMs
+	}
+
+	// A negative cache size disables the search result cache
+	if c.Server.Search.CacheSize == 0 {
+		c.Server.Search.CacheSize = DefaultSearchCacheSize
+	}
+
+	if c.Client.DefaultLimit.MaxResults <= 0 ||
+		c.Client.DefaultLimit.MaxResults > c.Server.Search.Limit.MaxResults {
+		c.Client.DefaultLimit.MaxResults = DefaultClientMaxResults
+	}
+
+	if c.Client.DefaultLimit.MaxResultsPerFile <= 0 ||
+		c.Client.DefaultLimit.MaxResultsPerFile > c.Server.Search.Limit.MaxResultsPerFile {
+		c.Client.DefaultLimit.MaxResultsPerFile = DefaultClientMaxResultsPerFile
+	}
+
+	if c.Client.DefaultLimit.MaxFilesResults <= 0 ||
+		c.Client.DefaultLimit.MaxFilesResults > DefaultMaxFiles {
+		c.Client.DefaultLimit.MaxFilesResults = DefaultMaxFiles
+	}
+
+	return c, nil
 }
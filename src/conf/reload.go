@@ -0,0 +1,159 @@
+package conf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// ErrInvalidConfig is returned if the reloaded configuration file is invalid, the current one is kept
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// restartRequiredPrefix is the section of the settings which are only applied once the server restarts
+const restartRequiredPrefix = "global."
+
+var (
+	reloadMutex sync.Mutex
+	loadedState fileState
+
+	reloadListeners      []func(old, new *Conf)
+	reloadListenersMutex sync.RWMutex
+)
+
+// fileState is the modification time and the size of the configuration file, zero if it doesn't exist
+type fileState struct {
+	modTime int64
+	size    int64
+}
+
+func statFile(file string) fileState {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: stat.ModTime().UnixNano(), size: stat.Size()}
+}
+
+// File returns the path of the configuration file
+func File() string {
+	return confFile
+}
+
+// OnReload registers a listener which is called with the old and the new configuration once a reload changes it
+// Listeners are called in the order of registration by the goroutine reloading, so they should return quickly.
+func OnReload(listener func(old, new *Conf)) {
+	reloadListenersMutex.Lock()
+	defer reloadListenersMutex.Unlock()
+
+	reloadListeners = append(reloadListeners, listener)
+}
+
+// Reload reads the configuration file again, and replaces the current configuration if it's valid
+// The settings requiring a restart keep their current values until the server restarts.
+func Reload() (*types.ConfigReloadResult, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	// The state is taken before reading, so a write during the reload is seen by the watcher
+	loadedState = statFile(confFile)
+	c, err := parse(confFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w `%s`: %v", ErrInvalidConfig, confFile, err)
+	}
+	// An empty list would drop every file of the workspaces from the indexes, it's only rejected here so a
+	// configuration accepted by earlier versions still starts the server
+	if len(c.Server.Filters.Include) == 0 {
+		return nil, fmt.Errorf("%w `%s`: server.filters.include must not be empty", ErrInvalidConfig, confFile)
+	}
+
+	// Settings of the running process aren't in the file
+	old := Get()
+	c.Server.LoggingStdout = old.Server.LoggingStdout
+	c.ForTest = old.ForTest
+
+	result := &types.ConfigReloadResult{File: confFile, Changed: []string{}}
+	for _, key := range changedKeys(reflect.ValueOf(old).Elem(), reflect.ValueOf(c).Elem(), "") {
+		if strings.HasPrefix(key, restartRequiredPrefix) {
+			result.RestartRequired = append(result.RestartRequired, key)
+		} else {
+			result.Changed = append(result.Changed, key)
+		}
+	}
+
+	c.Global = old.Global
+	if len(result.Changed) == 0 {
+		return result, nil
+	}
+
+	current.Store(c)
+
+	reloadListenersMutex.RLock()
+	defer reloadListenersMutex.RUnlock()
+	for _, listener := range reloadListeners {
+		listener(old, c)
+	}
+
+	return result, nil
+}
+
+// changedKeys returns the YAML keys of the settings differing between the configurations, e.g. "server.search.workers"
+func changedKeys(old, new reflect.Value, prefix string) []string {
+	keys := []string{}
+	for i := 0; i < old.NumField(); i++ {
+		field := old.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := prefix + name
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, changedKeys(old.Field(i), new.Field(i), key+".")...)
+		} else if !reflect.DeepEqual(old.Field(i).Interface(), new.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// WatchFile calls reload once the configuration file is changed, until the context is done
+// The file is polled every interval, and reloaded once it's unchanged for an interval, so it's not read while
+// an editor is writing it. reload should call Reload, which records the reloaded state of the file.
+func WatchFile(ctx context.Context, interval time.Duration, reload func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// pending is the changed state seen by the last poll, nil if the file isn't changed
+	var pending *fileState
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		state := statFile(confFile)
+		reloadMutex.Lock()
+		loaded := loadedState
+		reloadMutex.Unlock()
+
+		if state == loaded {
+			pending = nil
+			continue
+		}
+		if pending == nil || *pending != state {
+			pending = &state
+			continue
+		}
+
+		pending = nil
+		reload()
+	}
+}
@@ -0,0 +1,120 @@
+package conf
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	saved, savedFile := Get(), confFile
+	defer func() {
+		current.Store(saved)
+		confFile = savedFile
+	}()
+
+	confFile = filepath.Join(dir, "config.yaml")
+	writeConf := func(content string) {
+		if err := os.WriteFile(confFile, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	writeConf("global:\n  data_path: " + dir + "\nserver:\n  index_workers: 1\n")
+	c, err := parse(confFile)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	current.Store(c)
+
+	var calls [][2]*Conf
+	OnReload(func(old, new *Conf) {
+		calls = append(calls, [2]*Conf{old, new})
+	})
+
+	// Unchanged settings don't notify the listeners
+	result, err := Reload()
+	if err != nil || len(result.Changed) != 0 || len(calls) != 0 {
+		t.Fatalf("Reload() of the same file = %+v, %v, %d calls", result, err, len(calls))
+	}
+
+	writeConf("global:\n  data_path: " + dir + "\n  port: 12345\nserver:\n  index_workers: 1\n" +
+		"  search:\n    timeout_ms: 2000\n  filters:\n    include: [\"*.go\"]\n")
+	result, err = Reload()
+	if err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	wantChanged := []string{"server.filters.include", "server.search.timeout_ms"}
+	if !slices.Equal(result.Changed, wantChanged) || !slices.Equal(result.RestartRequired, []string{"global.port"}) {
+		t.Errorf("Reload() = %+v, want changed %v and restart required global.port", result, wantChanged)
+	}
+	if Get() == c || Get().Server.Search.TimeoutMs != 2000 || Get().Global.Port != c.Global.Port {
+		t.Errorf("Reload() expected the new config with the current port, got %+v", Get())
+	}
+	if len(calls) != 1 || calls[0][0] != c || calls[0][1] != Get() {
+		t.Errorf("Reload() expected the listener to be called with the old and new config, got %d calls", len(calls))
+	}
+
+	// Invalid files are not applied
+	reloaded := Get()
+	for _, content := range []string{"server: [", "server:\n  search:\n    timeout_ms: abc\n",
+		"server:\n  filters:\n    include: []\n"} {
+		writeConf(content)
+		if _, err := Reload(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Reload() of %q error = %v, want %v", content, err, ErrInvalidConfig)
+		}
+		if Get() != reloaded {
+			t.Errorf("Reload() of %q replaced the config", content)
+		}
+	}
+
+	// An empty include is only rejected by reloads, the server still starts with it
+	writeConf("server:\n  filters:\n    include: []\n")
+	if c, err := parse(confFile); err != nil || len(c.Server.Filters.Include) != 0 {
+		t.Errorf("parse() of an empty include = %v, %v, want it accepted", c, err)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	savedFile := confFile
+	defer func() { confFile = savedFile }()
+
+	confFile = filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(confFile, []byte("server:\n  index_workers: 1\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	reloadMutex.Lock()
+	loadedState = statFile(confFile)
+	reloadMutex.Unlock()
+
+	reloads := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchFile(ctx, 10*time.Millisecond, func() {
+		reloadMutex.Lock()
+		loadedState = statFile(confFile)
+		reloadMutex.Unlock()
+		reloads <- struct{}{}
+	})
+
+	select {
+	case <-reloads:
+		t.Fatal("WatchFile() reloaded an unchanged file")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(confFile, []byte("server:\n  index_workers: 12\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	select {
+	case <-reloads:
+	case <-time.After(2 * time.Second):
+		t.Fatal("WatchFile() didn't reload the changed file")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/codetrek/haystack/client"
 	"github.com/codetrek/haystack/conf"
 	"github.com/codetrek/haystack/server"
+	"github.com/codetrek/haystack/shared/auth"
 	"github.com/codetrek/haystack/shared/running"
 )
 
@@ -25,6 +26,8 @@ func main() {
 
 	lockFile := filepath.Join(conf.Get().Global.DataPath, "server.lock")
 	running.RegisterLockFile(lockFile)
+	running.RegisterSocketFile(filepath.Join(conf.Get().Global.DataPath, "server.sock"))
+	auth.RegisterTokenFile(filepath.Join(conf.Get().Global.DataPath, "tokens.json"))
 
 	if running.IsDaemonMode() {
 		server.Run()
@@ -16,6 +16,9 @@ const (
 	WorkspacePrefix = "ws:"
 	KeywordPrefix   = "kw:"
 	MergeIndexKey   = "merge-index"
+
+	// ReversedKeywordPrefix is the prefix of the reversed keywords, they are used to look up keywords by suffix
+	ReversedKeywordPrefix = "rk:"
 )
 
 func EncodeWorkspaceKey(workspaceid string) []byte {
@@ -136,3 +139,42 @@ func EncodeKeywordIndexValue(docids []string) []byte {
 func DecodeKeywordIndexValue(data string) []string {
 	return strings.Split(data, "|")
 }
+
+// EncodeReversedKeywordKey encodes the key of a keyword in the reversed keyword index
+// The keyword is stored reversed, so keywords ending with the same suffix are stored together
+func EncodeReversedKeywordKey(workspaceid string, keyword string) []byte {
+	return []byte(fmt.Sprintf("%s%s|%s", ReversedKeywordPrefix, workspaceid, ReverseKeyword(keyword)))
+}
+
+// EncodeReversedKeywordSearchKey encodes the key prefix of the reversed keywords ending with suffix
+func EncodeReversedKeywordSearchKey(workspaceid string, suffix string) []byte {
+	return []byte(fmt.Sprintf("%s%s|%s", ReversedKeywordPrefix, workspaceid, ReverseKeyword(suffix)))
+}
+
+// DecodeReversedKeywordKey decodes the key of the reversed keyword index, the keyword is returned in its original order
+func DecodeReversedKeywordKey(key string) (string, string) {
+	if !strings.HasPrefix(key, ReversedKeywordPrefix) {
+		return "", ""
+	}
+
+	key = strings.TrimPrefix(key, ReversedKeywordPrefix)
+
+	parts := strings.Split(key, "|")
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	workspaceid := parts[0]
+	keyword := ReverseKeyword(parts[1])
+
+	return workspaceid, keyword
+}
+
+// ReverseKeyword reverses a keyword, keywords are ASCII so it's reversed by bytes
+func ReverseKeyword(keyword string) string {
+	reversed := []byte(keyword)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	return string(reversed)
+}
@@ -71,6 +71,7 @@ func flushPendingWrites(closing bool) {
 
 	wordsCount := 0
 	docsCount := 0
+	changed := map[string]struct{}{}
 	for _, wp := range pendingWrites {
 		for kw, relatedDocs := range wp.Keywords {
 			// Skip the keyword if it has been updated in the last 2 seconds
@@ -84,6 +85,7 @@ func flushPendingWrites(closing bool) {
 
 			writeKeywordIndex(batch, wp.WorkspaceID, kw, relatedDocs.DocIds, nil)
 			delete(wp.Keywords, kw)
+			changed[wp.WorkspaceID] = struct{}{}
 
 			// delete empty workspace
 			if len(wp.Keywords) == 0 {
@@ -92,7 +94,11 @@ func flushPendingWrites(closing bool) {
 		}
 	}
 
-	batch.Commit()
+	if batch.Commit() == nil {
+		for workspaceid := range changed {
+			notifyWorkspaceChanged(workspaceid)
+		}
+	}
 }
 
 // updateKeywordIndexCached updates the keyword index in write cached
@@ -138,6 +144,7 @@ func flushPendingDeletes(closing bool, maxKeywordIndexSize int) {
 
 	batch := NewBatch(db)
 
+	changed := map[string]struct{}{}
 	for _, wp := range pendingDeletes {
 		for kw, relatedDocs := range wp.Keywords {
 			// Skip the keyword if it has been updated in the last 2 seconds
@@ -148,6 +155,7 @@ func flushPendingDeletes(closing bool, maxKeywordIndexSize int) {
 
 			removeDocumentsFromKeywordIndex(batch, wp.WorkspaceID, kw, relatedDocs.DocIds, maxKeywordIndexSize)
 			delete(wp.Keywords, kw)
+			changed[wp.WorkspaceID] = struct{}{}
 
 			// delete empty workspace
 			if len(wp.Keywords) == 0 {
@@ -156,7 +164,11 @@ func flushPendingDeletes(closing bool, maxKeywordIndexSize int) {
 		}
 	}
 
-	batch.Commit()
+	if batch.Commit() == nil {
+		for workspaceid := range changed {
+			notifyWorkspaceChanged(workspaceid)
+		}
+	}
 }
 
 var removeKeywordsFromDocumentCached = func(workspaceid string, docid string, keywords []string) {
@@ -177,6 +189,7 @@ var writeKeywordIndex = func(batch pebble.Batch, workspaceid string, kw string,
 		key = EncodeKeywordIndexKey(workspaceid, kw, len(docids))
 	}
 	batch.Put(key, content)
+	writeReversedKeyword(batch, workspaceid, kw)
 }
 
 // removeDocumentsFromKeywordIndex removes a document from the keywords index
@@ -202,6 +215,8 @@ func removeDocumentsFromKeywordIndex(batch pebble.Batch, workspaceid string, kw
 
 	keys := []string{}
 	docids := map[string]struct{}{}
+	// kept is the number of rows not rewritten
+	kept := 0
 	db.Scan(EncodeKeywordIndexKeyPrefix(workspaceid, kw), func(key, value []byte) bool {
 		changed := false
 		tmpids := []string{}
@@ -223,6 +238,8 @@ func removeDocumentsFromKeywordIndex(batch pebble.Batch, workspaceid string, kw
 			for _, id := range tmpids {
 				docids[id] = struct{}{}
 			}
+		} else {
+			kept++
 		}
 		return true
 	})
@@ -252,6 +269,11 @@ func removeDocumentsFromKeywordIndex(batch pebble.Batch, workspaceid string, kw
 	for _, key := range keys {
 		batch.Delete([]byte(key))
 	}
+
+	// The keyword is no longer in any document of the workspace
+	if count == 0 && kept == 0 {
+		batch.Delete(EncodeReversedKeywordKey(workspaceid, kw))
+	}
 }
 
 // saveDocument saves a document to the database
@@ -297,6 +319,9 @@ func (t *saveNewDocumentsTask) Run() {
 	err := batch.Commit()
 	if err != nil {
 		log.Println("Failed to save new documents:", err)
+	} else {
+		notifyWorkspaceChanged(t.WorkspaceID)
+		notifyDocumentsChanged(documentsChange(t.WorkspaceID, t.Docs, true))
 	}
 
 	t.done <- err
@@ -382,6 +407,9 @@ func (t *updateDocumentsTask) Run() {
 	err := batch.Commit()
 	if err != nil {
 		log.Println("Failed to update documents:", err)
+	} else {
+		notifyWorkspaceChanged(t.WorkspaceID)
+		notifyDocumentsChanged(documentsChange(t.WorkspaceID, t.Docs, false))
 	}
 	t.done <- err
 }
@@ -436,6 +464,9 @@ func (t *deleteDocumentTask) Run() {
 	err = batch.Commit()
 	if err != nil {
 		log.Println("Failed to delete document:", err)
+	} else {
+		notifyWorkspaceChanged(t.WorkspaceID)
+		notifyDocumentsChanged(documentsChange(t.WorkspaceID, []*Document{doc}, true))
 	}
 
 	t.done <- err
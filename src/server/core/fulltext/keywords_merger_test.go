@@ -478,6 +478,8 @@ func TestMergeKeywordsIndexMultipleWorkspaces(t *testing.T) {
 		writtenData[workspaceID][keyword] = docIDs
 	}
 
+	originalNewBatch := NewBatch
+	defer func() { NewBatch = originalNewBatch }()
 	NewBatch = func(db pebble.DB) pebble.Batch {
 		return mockBatch
 	}
@@ -694,6 +696,8 @@ func TestMergeKeywordsIndexTimeout(t *testing.T) {
 		// No-op for this test
 	}
 
+	originalNewBatch := NewBatch
+	defer func() { NewBatch = originalNewBatch }()
 	NewBatch = func(db pebble.DB) pebble.Batch {
 		return &mockBatchWriteWithFuncs{
 			deleteFunc: func(key []byte) error { return nil },
@@ -0,0 +1,66 @@
+package fulltext
+
+import "sync"
+
+var (
+	changeListeners      []func(workspaceid string)
+	changeListenersMutex sync.RWMutex
+
+	documentListeners      []func(change *DocumentsChange)
+	documentListenersMutex sync.RWMutex
+)
+
+// DocumentsChange is the documents of a workspace changed by a write
+// ListChanged is set if the documents are added or deleted rather than updated
+type DocumentsChange struct {
+	WorkspaceID string
+	RelPaths    []string
+	ListChanged bool
+}
+
+// OnWorkspaceChanged registers a listener which is called after changes of the documents or keywords
+// of a workspace are committed. Listeners are called on the write queue, so they should return quickly.
+func OnWorkspaceChanged(listener func(workspaceid string)) {
+	changeListenersMutex.Lock()
+	defer changeListenersMutex.Unlock()
+
+	changeListeners = append(changeListeners, listener)
+}
+
+// notifyWorkspaceChanged calls the listeners of workspace changes
+func notifyWorkspaceChanged(workspaceid string) {
+	changeListenersMutex.RLock()
+	defer changeListenersMutex.RUnlock()
+
+	for _, listener := range changeListeners {
+		listener(workspaceid)
+	}
+}
+
+// OnDocumentsChanged registers a listener which is called with the paths of the documents after they are saved,
+// updated or deleted. Listeners are called on the write queue, so they should return quickly.
+func OnDocumentsChanged(listener func(change *DocumentsChange)) {
+	documentListenersMutex.Lock()
+	defer documentListenersMutex.Unlock()
+
+	documentListeners = append(documentListeners, listener)
+}
+
+// notifyDocumentsChanged calls the listeners of document changes
+func notifyDocumentsChanged(change *DocumentsChange) {
+	documentListenersMutex.RLock()
+	defer documentListenersMutex.RUnlock()
+
+	for _, listener := range documentListeners {
+		listener(change)
+	}
+}
+
+// documentsChange returns the change of the documents
+func documentsChange(workspaceid string, docs []*Document, listChanged bool) *DocumentsChange {
+	change := &DocumentsChange{WorkspaceID: workspaceid, ListChanged: listChanged}
+	for _, doc := range docs {
+		change.RelPaths = append(change.RelPaths, doc.RelPath)
+	}
+	return change
+}
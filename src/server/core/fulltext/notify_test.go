@@ -0,0 +1,50 @@
+package fulltext
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestOnDocumentsChanged(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	var mutex sync.Mutex
+	changes := []DocumentsChange{}
+	OnDocumentsChanged(func(change *DocumentsChange) {
+		if change.WorkspaceID != "notify-test" {
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		changes = append(changes, *change)
+	})
+
+	docs := []*Document{
+		{ID: "doc1", RelPath: "a.go", Words: []string{"alpha"}},
+		{ID: "doc2", RelPath: "b.go", Words: []string{"beta"}},
+	}
+	if err := SaveNewDocuments("notify-test", docs); err != nil {
+		t.Fatalf("SaveNewDocuments failed: %v", err)
+	}
+	if err := UpdateDocuments("notify-test", docs[:1]); err != nil {
+		t.Fatalf("UpdateDocuments failed: %v", err)
+	}
+	if err := DeleteDocument("notify-test", "doc2"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+
+	// Only adding and deleting documents changes the list
+	expected := []DocumentsChange{
+		{WorkspaceID: "notify-test", RelPaths: []string{"a.go", "b.go"}, ListChanged: true},
+		{WorkspaceID: "notify-test", RelPaths: []string{"a.go"}},
+		{WorkspaceID: "notify-test", RelPaths: []string{"b.go"}, ListChanged: true},
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+}
@@ -0,0 +1,66 @@
+package fulltext
+
+import (
+	"log"
+	"time"
+
+	"github.com/codetrek/haystack/server/core/pebble"
+	"github.com/dustin/go-humanize"
+)
+
+// ReversedKeywordsIndexKey marks that the reversed keywords of all indexed keywords are written
+// Databases created before the reversed keyword index are back-filled once on start
+const ReversedKeywordsIndexKey = "reversed-keywords-index"
+
+// ScanReversedKeywords scans the indexed keywords of the workspace ending with suffix
+// A keyword is only stored once in the reversed keyword index, callback is called once for each keyword
+func ScanReversedKeywords(workspaceid string, suffix string, callback func(keyword string) bool) {
+	db.Scan(EncodeReversedKeywordSearchKey(workspaceid, suffix), func(key, value []byte) bool {
+		_, keyword := DecodeReversedKeywordKey(string(key))
+		if keyword == "" {
+			return true
+		}
+		return callback(keyword)
+	})
+}
+
+// writeReversedKeyword adds a keyword to the reversed keyword index, it's idempotent
+func writeReversedKeyword(batch pebble.Batch, workspaceid string, kw string) {
+	batch.Put(EncodeReversedKeywordKey(workspaceid, kw), []byte{})
+}
+
+type backfillReversedKeywordsTask struct{}
+
+// Run writes the reversed keywords of all indexed keywords if they were indexed before the reversed keyword index
+func (t *backfillReversedKeywordsTask) Run() {
+	if done, err := db.Get([]byte(ReversedKeywordsIndexKey)); err != nil || done != nil {
+		return
+	}
+
+	start := time.Now()
+	batch := NewBatch(db)
+
+	count := 0
+	lastWorkspaceId, lastKeyword := "", ""
+	db.Scan([]byte(KeywordPrefix), func(key, value []byte) bool {
+		workspaceid, keyword, _, _ := DecodeKeywordIndexKey(string(key))
+		if keyword == "" || (workspaceid == lastWorkspaceId && keyword == lastKeyword) {
+			return true
+		}
+
+		lastWorkspaceId, lastKeyword = workspaceid, keyword
+		writeReversedKeyword(batch, workspaceid, keyword)
+		count++
+		return true
+	})
+
+	batch.Put([]byte(ReversedKeywordsIndexKey), []byte(time.Now().Format(time.RFC3339)))
+	if err := batch.Commit(); err != nil {
+		log.Println("Failed to back-fill the reversed keyword index:", err)
+		return
+	}
+
+	if count > 0 {
+		log.Printf("Back-filled %s reversed keywords in %s", humanize.Comma(int64(count)), time.Since(start))
+	}
+}
@@ -0,0 +1,88 @@
+package fulltext
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReversedKeywordKey(t *testing.T) {
+	key := EncodeReversedKeywordKey("1", "requesthandler")
+	if string(key) != "rk:1|reldnahtseuqer" {
+		t.Errorf("Key mismatch, got %s", key)
+	}
+
+	workspaceid, keyword := DecodeReversedKeywordKey(string(key))
+	if workspaceid != "1" || keyword != "requesthandler" {
+		t.Errorf("Decoded mismatch, got %s %s", workspaceid, keyword)
+	}
+
+	if prefix := EncodeReversedKeywordSearchKey("1", "handler"); !bytes.HasPrefix(key, prefix) {
+		t.Errorf("Key %s should start with the search key %s", key, prefix)
+	}
+}
+
+func scanReversedKeywords(workspaceid string, suffix string) []string {
+	keywords := []string{}
+	ScanReversedKeywords(workspaceid, suffix, func(keyword string) bool {
+		keywords = append(keywords, keyword)
+		return true
+	})
+	return keywords
+}
+
+func TestReversedKeywordIndex(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	batch := NewBatch(db)
+	writeKeywordIndex(batch, "1", "requesthandler", []string{"doc1"}, nil)
+	writeKeywordIndex(batch, "1", "errorhandler", []string{"doc1", "doc2"}, nil)
+	writeKeywordIndex(batch, "1", "handlers", []string{"doc2"}, nil)
+	writeKeywordIndex(batch, "2", "filehandler", []string{"doc3"}, nil)
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	expected := []string{"errorhandler", "requesthandler"}
+	if got := scanReversedKeywords("1", "handler"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// The keyword stays in the index until it's removed from all documents
+	batch = NewBatch(db)
+	removeDocumentsFromKeywordIndex(batch, "1", "errorhandler", []string{"doc1"}, MaxKeywordIndexSize)
+	batch.Commit()
+	if got := scanReversedKeywords("1", "handler"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	batch = NewBatch(db)
+	removeDocumentsFromKeywordIndex(batch, "1", "errorhandler", []string{"doc2"}, MaxKeywordIndexSize)
+	batch.Commit()
+	expected = []string{"requesthandler"}
+	if got := scanReversedKeywords("1", "handler"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestBackfillReversedKeywords(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	// Keywords indexed before the reversed keyword index
+	db.Put(EncodeKeywordIndexKey("1", "confighandler", 1), EncodeKeywordIndexValue([]string{"doc1"}))
+	db.Put(EncodeKeywordIndexKey("1", "confighandler", 1), EncodeKeywordIndexValue([]string{"doc2"}))
+	db.Delete([]byte(ReversedKeywordsIndexKey))
+
+	(&backfillReversedKeywordsTask{}).Run()
+
+	expected := []string{"confighandler"}
+	if got := scanReversedKeywords("1", "handler"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if done, _ := db.Get([]byte(ReversedKeywordsIndexKey)); done == nil {
+		t.Error("The back-fill should be marked as done")
+	}
+}
@@ -46,6 +46,22 @@ func Search(workspaceid string, query string, limit int) SearchResult {
 	return results
 }
 
+// ScanDocIds scans the documents of the keywords starting with query, a document may be passed more than once
+// if it contains multiple keywords starting with query. It stops once callback returns false.
+func ScanDocIds(workspaceid string, query string, callback func(docid string) bool) {
+	db.Scan(EncodeKeywordSearchKey(workspaceid, query), func(key, value []byte) bool {
+		for _, docid := range DecodeKeywordIndexValue(string(value)) {
+			if docid == "" {
+				continue
+			}
+			if !callback(docid) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
 func ScanFiles(workspaceId string, callback func(docid, relPath string) bool) {
 	db.Scan(EncodeDocumentPathKey(workspaceId, ""), func(key, value []byte) bool {
 		_, docid := DecodeDocumentPathKey(string(key))
@@ -55,3 +71,15 @@ func ScanFiles(workspaceId string, callback func(docid, relPath string) bool) {
 		return callback(docid, string(value))
 	})
 }
+
+// ScanKeywords scans the indexed keywords of the workspace starting with prefix
+// A keyword may be stored in multiple rows, callback is called for each row with the document count of the row
+func ScanKeywords(workspaceid string, prefix string, callback func(keyword string, doccount int) bool) {
+	db.Scan(EncodeKeywordSearchKey(workspaceid, prefix), func(key, value []byte) bool {
+		_, keyword, doccount, _ := DecodeKeywordIndexKey(string(key))
+		if keyword == "" {
+			return true
+		}
+		return callback(keyword, doccount)
+	})
+}
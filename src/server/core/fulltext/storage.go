@@ -82,6 +82,8 @@ func Init() error {
 		}
 	}()
 
+	writeQueue <- &backfillReversedKeywordsTask{}
+
 	go func() {
 		timer := time.NewTicker(1 * time.Second)
 		defer timer.Stop()
@@ -93,7 +93,12 @@ func (t *deleteWorkspaceTask) Run() {
 	batch.DeletePrefix(EncodeDocumentMetaKey(t.WorkspaceID, ""))
 	batch.DeletePrefix(EncodeDocumentWordsKey(t.WorkspaceID, ""))
 	batch.DeletePrefix(EncodeKeywordSearchKey(t.WorkspaceID, ""))
-	t.done <- batch.Commit()
+	batch.DeletePrefix(EncodeReversedKeywordSearchKey(t.WorkspaceID, ""))
+	err := batch.Commit()
+	if err == nil {
+		notifyWorkspaceChanged(t.WorkspaceID)
+	}
+	t.done <- err
 }
 
 func (t *deleteWorkspaceTask) Wait() error {
@@ -2,6 +2,7 @@ package workspace
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -16,6 +17,11 @@ import (
 	"github.com/codetrek/haystack/utils"
 )
 
+var (
+	ErrNotFound = errors.New("workspace not found")
+	ErrExists   = errors.New("workspace already exists")
+)
+
 var (
 	workspaces     map[string]*Workspace
 	workspacePaths map[string]*Workspace
@@ -110,7 +116,66 @@ func GetByPath(path string) (*Workspace, error) {
 		return workspace, nil
 	}
 
-	return nil, fmt.Errorf("workspace not found")
+	return nil, ErrNotFound
+}
+
+// AllWorkspaces is the pattern matching all workspaces
+const AllWorkspaces = "all"
+
+// Match returns the workspaces matching any of the patterns, sorted by id
+// A pattern is an absolute workspace path, a glob of workspace paths, e.g. /home/user/projects/*, or "all"
+func Match(patterns []string) ([]*Workspace, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	matched := map[string]*Workspace{}
+	for _, pattern := range patterns {
+		if pattern == AllWorkspaces {
+			for id, workspace := range workspaces {
+				if !workspace.deleted {
+					matched[id] = workspace
+				}
+			}
+			continue
+		}
+
+		pattern = utils.NormalizePath(pattern)
+		if !filepath.IsAbs(pattern) {
+			return nil, fmt.Errorf("workspace is not absolute: %s", pattern)
+		}
+
+		if workspace, ok := workspacePaths[pattern]; ok && !workspace.deleted {
+			matched[workspace.ID] = workspace
+			continue
+		}
+
+		for path, workspace := range workspacePaths {
+			ok, err := filepath.Match(pattern, path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid workspace pattern `%s`: %v", pattern, err)
+			}
+			if ok && !workspace.deleted {
+				matched[workspace.ID] = workspace
+			}
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, ErrNotFound
+	}
+
+	result := make([]*Workspace, 0, len(matched))
+	for _, workspace := range matched {
+		result = append(result, workspace)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		ri, _ := strconv.Atoi(result[i].ID)
+		rj, _ := strconv.Atoi(result[j].ID)
+		return ri < rj
+	})
+
+	return result, nil
 }
 
 func Get(workspaceId string) (*Workspace, error) {
@@ -119,7 +184,7 @@ func Get(workspaceId string) (*Workspace, error) {
 
 	workspace, ok := workspaces[workspaceId]
 	if !ok || workspace.deleted {
-		return nil, fmt.Errorf("workspace not found")
+		return nil, ErrNotFound
 	}
 
 	return workspace, nil
@@ -133,7 +198,7 @@ func Create(workspacePath string) (*Workspace, error) {
 
 	workspace := workspacePaths[workspacePath]
 	if workspace != nil {
-		return nil, fmt.Errorf("workspace already exists")
+		return nil, ErrExists
 	}
 
 	// Validate the workspace path
@@ -195,7 +260,7 @@ func Delete(workspaceId string) error {
 
 	workspace, ok := workspaces[workspaceId]
 	if !ok {
-		return fmt.Errorf("workspace not found")
+		return ErrNotFound
 	}
 
 	workspace.SetDeleted()
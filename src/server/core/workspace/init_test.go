@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -221,3 +222,63 @@ func TestWorkspaceConcurrency(t *testing.T) {
 	}
 	accessWg.Wait()
 }
+
+func TestMatch(t *testing.T) {
+	mutex.Lock()
+	savedWorkspaces, savedPaths := workspaces, workspacePaths
+	workspaces = map[string]*Workspace{
+		"1": {ID: "1", Path: "/projects/app"},
+		"2": {ID: "2", Path: "/projects/lib"},
+		"3": {ID: "3", Path: "/other/tool"},
+		"4": {ID: "4", Path: "/projects/old", deleted: true},
+	}
+	workspacePaths = map[string]*Workspace{}
+	for _, ws := range workspaces {
+		workspacePaths[ws.Path] = ws
+	}
+	mutex.Unlock()
+
+	defer func() {
+		mutex.Lock()
+		workspaces, workspacePaths = savedWorkspaces, savedPaths
+		mutex.Unlock()
+	}()
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "single path", patterns: []string{"/projects/lib"}, want: []string{"2"}},
+		{name: "list of paths", patterns: []string{"/other/tool", "/projects/app"}, want: []string{"1", "3"}},
+		{name: "glob skips deleted", patterns: []string{"/projects/*"}, want: []string{"1", "2"}},
+		{name: "path of deleted", patterns: []string{"/projects/old"}, wantErr: true},
+		{name: "paths skip deleted", patterns: []string{"/projects/old", "/projects/app"}, want: []string{"1"}},
+		{name: "all", patterns: []string{"all"}, want: []string{"1", "2", "3"}},
+		{name: "duplicates", patterns: []string{"/projects/app", "/projects/*"}, want: []string{"1", "2"}},
+		{name: "not absolute", patterns: []string{"projects/app"}, wantErr: true},
+		{name: "no match", patterns: []string{"/nowhere/*"}, wantErr: true},
+		{name: "bad pattern", patterns: []string{"/projects/["}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Match(tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Match() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			ids := []string{}
+			for _, ws := range got {
+				ids = append(ids, ws.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Match() got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
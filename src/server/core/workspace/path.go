@@ -0,0 +1,106 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrAbsolutePath is returned for absolute paths, paths of the API are relative to the workspace
+	ErrAbsolutePath = errors.New("path must be relative to the workspace")
+	// ErrPathTraversal is returned for paths pointing outside of the workspace by ".."
+	ErrPathTraversal = errors.New("path is outside of the workspace")
+	// ErrSymlinkEscape is returned for paths resolved outside of the workspace by a symlink
+	ErrSymlinkEscape = errors.New("path is linked outside of the workspace")
+	// ErrInvalidPath is returned for paths which are not file names, e.g. containing NUL
+	ErrInvalidPath = errors.New("path is invalid")
+	// ErrWorkspaceRoot is returned by ResolveFilePath for the root of the workspace
+	ErrWorkspaceRoot = errors.New("path is the root of the workspace")
+)
+
+// PathError is the error of resolving a path of the workspace, Err is one of the errors above
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("invalid path `%s`: %v", e.Path, e.Err)
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// ResolvePath returns the clean path relative to the workspace of a path of a request, "" is the root
+// The path must be relative and stay in the workspace, a path through a symlink is rejected if the symlink points
+// outside of the workspace. The path doesn't need to exist, its nearest existing parent is checked instead.
+func (w *Workspace) ResolvePath(path string) (string, error) {
+	if strings.ContainsRune(path, 0) {
+		return "", &PathError{Path: path, Err: ErrInvalidPath}
+	}
+
+	// Rooted paths like "/etc" or "\etc" are absolute on all platforms
+	slashed := filepath.ToSlash(path)
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" || strings.HasPrefix(slashed, "/") {
+		return "", &PathError{Path: path, Err: ErrAbsolutePath}
+	}
+
+	relPath := filepath.Clean(filepath.FromSlash(path))
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", &PathError{Path: path, Err: ErrPathTraversal}
+	}
+	if relPath == "." {
+		return "", nil
+	}
+
+	if err := w.checkSymlinks(relPath); err != nil {
+		return "", &PathError{Path: path, Err: err}
+	}
+	return relPath, nil
+}
+
+// ResolveFilePath returns the clean path relative to the workspace of a file, the root is rejected
+func (w *Workspace) ResolveFilePath(path string) (string, error) {
+	relPath, err := w.ResolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	if relPath == "" {
+		return "", &PathError{Path: path, Err: ErrWorkspaceRoot}
+	}
+	return relPath, nil
+}
+
+// checkSymlinks returns ErrSymlinkEscape if the nearest existing path of relPath resolves outside of the workspace
+func (w *Workspace) checkSymlinks(relPath string) error {
+	root, err := filepath.EvalSymlinks(w.Path)
+	if err != nil {
+		// Nothing could be resolved in a workspace which doesn't exist
+		return nil
+	}
+
+	for path := relPath; path != "."; path = filepath.Dir(path) {
+		fullPath := filepath.Join(w.Path, path)
+		resolved, err := filepath.EvalSymlinks(fullPath)
+		if os.IsNotExist(err) {
+			// A dangling symlink could be created at its target, which can't be checked
+			if _, lerr := os.Lstat(fullPath); lerr == nil {
+				return ErrInvalidPath
+			}
+			continue
+		} else if err != nil {
+			return ErrInvalidPath
+		}
+
+		rel, err := filepath.Rel(root, resolved)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return ErrSymlinkEscape
+		}
+		return nil
+	}
+	return nil
+}
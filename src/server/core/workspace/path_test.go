@@ -0,0 +1,75 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "haystack-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	wsPath := filepath.Join(tempDir, "ws")
+	outside := filepath.Join(tempDir, "outside")
+	for _, dir := range []string{filepath.Join(wsPath, "src", "core"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+	}
+	links := map[string]string{
+		"escape":   outside,
+		"internal": filepath.Join(wsPath, "src"),
+		"dangling": filepath.Join(outside, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(wsPath, name)); err != nil {
+			t.Skipf("Symlinks are not supported: %v", err)
+		}
+	}
+
+	ws := &Workspace{ID: "path-test", Path: wsPath}
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{path: "", want: ""},
+		{path: ".", want: ""},
+		{path: "src/core/", want: filepath.Join("src", "core")},
+		{path: "src/../main.go", want: "main.go"},
+		{path: "src/new/file.go", want: filepath.Join("src", "new", "file.go")},
+		{path: "internal/core", want: filepath.Join("internal", "core")},
+		{path: "..", err: ErrPathTraversal},
+		{path: "../../etc", err: ErrPathTraversal},
+		{path: "src/../../ws/main.go", err: ErrPathTraversal},
+		{path: "/etc/passwd", err: ErrAbsolutePath},
+		{path: filepath.Join(wsPath, "main.go"), err: ErrAbsolutePath},
+		{path: "escape", err: ErrSymlinkEscape},
+		{path: "escape/new.go", err: ErrSymlinkEscape},
+		{path: "dangling", err: ErrInvalidPath},
+		{path: "main.go\x00.txt", err: ErrInvalidPath},
+	}
+
+	for _, tt := range tests {
+		got, err := ws.ResolvePath(tt.path)
+		if tt.err != nil {
+			var pathErr *PathError
+			if !errors.Is(err, tt.err) || !errors.As(err, &pathErr) || pathErr.Path != tt.path {
+				t.Errorf("ResolvePath(%q) error = %v, want %v", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ResolvePath(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+
+	if _, err := ws.ResolveFilePath("src/.."); !errors.Is(err, ErrWorkspaceRoot) {
+		t.Errorf("ResolveFilePath() of the root error = %v, want %v", err, ErrWorkspaceRoot)
+	}
+}
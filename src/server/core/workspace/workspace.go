@@ -136,6 +136,15 @@ func (w *Workspace) GetFilters() types.Filters {
 	return t
 }
 
+// UsesGlobalFilters returns true if any of the filters of the workspace is of the global filters
+func (w *Workspace) UsesGlobalFilters() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.Filters == nil || w.UseGlobalFilters || len(w.Filters.Include) == 0 ||
+		(!w.Filters.Exclude.UseGitIgnore && len(w.Filters.Exclude.Customized) == 0)
+}
+
 func (w *Workspace) SetDeleted() {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
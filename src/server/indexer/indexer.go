@@ -5,8 +5,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
 
+	"github.com/codetrek/haystack/conf"
 	"github.com/codetrek/haystack/server/core/fulltext"
 	"github.com/codetrek/haystack/server/core/workspace"
 	"github.com/codetrek/haystack/shared/running"
@@ -26,6 +28,7 @@ func Run(wg *sync.WaitGroup) {
 	scanner.Start(wg)
 	parser.Start(wg)
 	writer.Start(wg)
+	conf.OnReload(onConfigReload)
 	log.Println("Indexer started.")
 
 	go func() {
@@ -38,6 +41,29 @@ func Run(wg *sync.WaitGroup) {
 	}()
 }
 
+// onConfigReload applies the reloaded configuration of the indexer
+// Workspaces using the global filters are synced again, so files are indexed by the new filters.
+func onConfigReload(old, new *conf.Conf) {
+	if new.Server.IndexWorkers != old.Server.IndexWorkers {
+		parser.Resize(new.Server.IndexWorkers)
+	}
+
+	if reflect.DeepEqual(new.Server.Filters, old.Server.Filters) {
+		return
+	}
+	for _, workspacePath := range workspace.GetAllPaths() {
+		ws, err := workspace.GetByPath(workspacePath)
+		if err != nil || !ws.UsesGlobalFilters() {
+			continue
+		}
+
+		log.Printf("Global filters changed, syncing workspace `%s`", ws.Path)
+		if err := Sync(ws); err != nil {
+			log.Printf("Failed to sync workspace `%s`: %v", ws.Path, err)
+		}
+	}
+}
+
 func CreateWorkspace(workspacePath string, useGlobalFilter bool, filters *types.Filters) (*workspace.Workspace, error) {
 	w, err := workspace.Create(workspacePath)
 	if err != nil {
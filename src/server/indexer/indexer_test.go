@@ -0,0 +1,133 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// workerCount returns the number of the running workers of the parser
+func (p *Parser) workerCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.workers)
+}
+
+func TestParserResize(t *testing.T) {
+	p := NewParser()
+
+	// Workers are only started once the parser is started
+	p.Resize(2)
+	if p.workerCount() != 0 {
+		t.Fatalf("got %d workers before Start, want 0", p.workerCount())
+	}
+
+	wg := &sync.WaitGroup{}
+	p.Start(wg)
+	if got := p.workerCount(); got != conf.Get().Server.IndexWorkers {
+		t.Errorf("got %d workers, want index_workers %d", got, conf.Get().Server.IndexWorkers)
+	}
+
+	p.Resize(4)
+	if p.workerCount() != 4 {
+		t.Errorf("got %d workers, want 4", p.workerCount())
+	}
+
+	// The stopped workers exit, the others keep running
+	stopped := p.workers[1:]
+	p.Resize(1)
+	if p.workerCount() != 1 {
+		t.Errorf("got %d workers, want 1", p.workerCount())
+	}
+	for _, worker := range stopped {
+		<-worker.done
+	}
+
+	// All workers exit once the parser stops, and it's not resized any more
+	p.Stop()
+	wg.Wait()
+	p.Resize(2)
+	if p.workerCount() != 0 {
+		t.Errorf("got %d workers once stopped, want 0", p.workerCount())
+	}
+}
+
+// queuedWorkspaces returns the paths of the workspaces queued to be scanned
+func (s *Scanner) queuedWorkspaces() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paths := []string{}
+	for e := s.queue.Front(); e != nil; e = e.Next() {
+		paths = append(paths, e.Value.(*workspace.Workspace).Path)
+	}
+	return paths
+}
+
+func TestOnConfigReload(t *testing.T) {
+	tempDir := t.TempDir()
+	conf.Get().Global.DataPath = filepath.Join(tempDir, "data")
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer fulltext.CloseAndWait()
+	if err := workspace.Init(); err != nil {
+		t.Fatalf("Workspace Init failed: %v", err)
+	}
+
+	// The scanner isn't started, so the synced workspaces stay in its queue
+	savedScanner, savedParser := scanner, parser
+	scanner, parser = NewScanner(), NewParser()
+	defer func() { scanner, parser = savedScanner, savedParser }()
+	wg := &sync.WaitGroup{}
+	parser.Start(wg)
+	defer func() {
+		parser.Stop()
+		wg.Wait()
+	}()
+
+	globalPath, ownPath := filepath.Join(tempDir, "global"), filepath.Join(tempDir, "own")
+	for _, path := range []string{globalPath, ownPath} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		ws, err := workspace.Create(path)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		defer workspace.Delete(ws.ID)
+
+		if path == ownPath {
+			ws.UseGlobalFilters = false
+			ws.Filters = &types.Filters{Include: []string{"*.go"},
+				Exclude: types.Exclude{Customized: []string{"testdata/"}}}
+			ws.Save()
+		}
+	}
+
+	old := conf.Get()
+	changed := *old
+	changed.Server.IndexWorkers = old.Server.IndexWorkers + 2
+
+	// Only the number of workers changes
+	onConfigReload(old, &changed)
+	if parser.workerCount() != changed.Server.IndexWorkers || len(scanner.queuedWorkspaces()) != 0 {
+		t.Errorf("got %d workers and synced %v, want %d workers and no sync", parser.workerCount(),
+			scanner.queuedWorkspaces(), changed.Server.IndexWorkers)
+	}
+
+	// The workspaces using the global filters are synced by the new filters
+	filtered := changed
+	filtered.Server.Filters = types.Filters{Include: []string{"*.go"}, Exclude: old.Server.Filters.Exclude}
+	onConfigReload(&changed, &filtered)
+	if synced := scanner.queuedWorkspaces(); len(synced) != 1 || synced[0] != globalPath {
+		t.Errorf("got synced workspaces %v, want %s", synced, globalPath)
+	}
+}
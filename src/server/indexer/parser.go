@@ -23,8 +23,18 @@ type ParseFile struct {
 }
 
 // Parser handles concurrent file parsing operations
+// The number of workers follows conf.Server.IndexWorkers, it's changed once the configuration is reloaded.
 type Parser struct {
-	ch   chan ParseFile
+	ch chan ParseFile
+
+	mutex   sync.Mutex
+	wg      *sync.WaitGroup
+	workers []*parserWorker
+	nextID  int
+	stopped bool
+}
+
+type parserWorker struct {
 	stop chan struct{}
 	done chan struct{}
 }
@@ -32,38 +42,70 @@ type Parser struct {
 // NewParser creates a new Parser instance
 func NewParser() *Parser {
 	return &Parser{
-		ch:   make(chan ParseFile, 32),
-		stop: make(chan struct{}),
-		done: make(chan struct{}),
+		ch: make(chan ParseFile, 32),
 	}
 }
 
 // Start initializes the parser with worker goroutines
 func (p *Parser) Start(wg *sync.WaitGroup) {
-	for i := 0; i < conf.Get().Server.IndexWorkers; i++ {
-		wg.Add(1)
-		go p.run(i, wg)
+	p.mutex.Lock()
+	p.wg = wg
+	p.mutex.Unlock()
+
+	p.Resize(conf.Get().Server.IndexWorkers)
+}
+
+// Resize starts or stops workers to have n of them, the stopped ones finish their current files first
+func (p *Parser) Resize(n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.stopped || p.wg == nil || n == len(p.workers) {
+		return
+	}
+	if len(p.workers) > 0 {
+		log.Printf("Resizing parser from %d to %d workers", len(p.workers), n)
+	}
+
+	for len(p.workers) < n {
+		worker := &parserWorker{stop: make(chan struct{}), done: make(chan struct{})}
+		p.workers = append(p.workers, worker)
+		p.wg.Add(1)
+		go p.run(p.nextID, worker)
+		p.nextID++
+	}
+
+	for len(p.workers) > n {
+		close(p.workers[len(p.workers)-1].stop)
+		p.workers = p.workers[:len(p.workers)-1]
 	}
 }
 
 func (p *Parser) Stop() {
-	close(p.stop)
-	for range conf.Get().Server.IndexWorkers {
-		<-p.done
+	p.mutex.Lock()
+	p.stopped = true
+	workers := p.workers
+	p.workers = nil
+	p.mutex.Unlock()
+
+	for _, worker := range workers {
+		close(worker.stop)
+	}
+	for _, worker := range workers {
+		<-worker.done
 	}
-	close(p.done)
 	defer log.Printf("Parser stopped")
 }
 
 // run executes the parsing logic in a worker goroutine
-func (p *Parser) run(id int, wg *sync.WaitGroup) {
+func (p *Parser) run(id int, worker *parserWorker) {
 	log.Printf("Parser %d started", id)
-	defer wg.Done()
+	defer p.wg.Done()
+	defer close(worker.done)
 
 	for {
 		select {
-		case <-p.stop:
-			p.done <- struct{}{}
+		case <-worker.stop:
 			return
 		case file := <-p.ch:
 			p.processFile(file)
@@ -159,6 +201,11 @@ func parse(file ParseFile) (*fulltext.Document, bool, error) {
 
 var re = regexp.MustCompile(`[a-zA-Z0-9_][a-zA-Z0-9_-]+`)
 
+// ParseKeywords extracts the unique keywords of a content, the same way the content of files is indexed
+func ParseKeywords(content string) []string {
+	return parseString(content)
+}
+
 // parseString extracts unique words from a string
 func parseString(str string) []string {
 	words := re.FindAllString(str, -1)
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/server"
+	"github.com/codetrek/haystack/shared/running"
+)
+
+// configPollInterval is how often the configuration file is checked for changes
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads the configuration on SIGHUP and once the configuration file is changed
+func watchConfig(wg *sync.WaitGroup) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer signal.Stop(hangup)
+
+		for {
+			select {
+			case <-hangup:
+				server.ReloadConfig("SIGHUP")
+			case <-running.GetShutdown().Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		log.Printf("Watching config file `%s`", conf.File())
+		conf.WatchFile(running.GetShutdown(), configPollInterval, func() {
+			server.ReloadConfig("file watcher")
+		})
+	}()
+}
@@ -0,0 +1,220 @@
+package searcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+const (
+	DefaultReadFileLines = 200
+	MaxReadFileLines     = 2000
+	// MaxReadFileBytes limits the content returned by a read, the range is truncated once it's exceeded
+	MaxReadFileBytes = 256 * 1024
+
+	MaxListDirEntries = 1000
+)
+
+// ReadFile reads the lines from startLine to endLine of a file of the workspace, both inclusive and starting from 1
+// Only indexed files and overlays could be read, so the files excluded by the workspace filters are not readable.
+// endLine is capped by MaxReadFileLines lines from startLine, DefaultReadFileLines lines are read if it's 0.
+func ReadFile(ws *workspace.Workspace, path string, startLine, endLine int) (*types.ReadFileResult, error) {
+	relPath, err := ws.ResolveFilePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	startLine = max(startLine, 1)
+	if endLine <= 0 {
+		endLine = startLine + DefaultReadFileLines - 1
+	}
+	if endLine < startLine {
+		return nil, fmt.Errorf("invalid line range %d-%d", startLine, endLine)
+	}
+	endLine = min(endLine, startLine+MaxReadFileLines-1)
+
+	result := &types.ReadFileResult{
+		Workspace: ws.Path,
+		File:      relPath,
+		StartLine: startLine,
+		Lines:     []string{},
+	}
+
+	content, overlay, err := readContent(ws, relPath)
+	if err != nil {
+		return nil, err
+	}
+	result.Overlay = overlay
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	result.TotalLines = len(lines)
+	if content == "" {
+		result.TotalLines = 0
+	}
+
+	size := 0
+	for lineNumber := startLine; lineNumber <= endLine && lineNumber <= result.TotalLines; lineNumber++ {
+		line := strings.TrimSuffix(lines[lineNumber-1], "\r")
+		size += len(line) + 1
+		if size > MaxReadFileBytes && len(result.Lines) > 0 {
+			result.Truncate = true
+			break
+		}
+		result.Lines = append(result.Lines, line)
+	}
+	result.EndLine = startLine + len(result.Lines) - 1
+
+	return result, nil
+}
+
+// ReadFileContent reads the whole content of a file of the workspace, it's bounded as ReadFile but by the max
+// file size only. overlay is set if the content is of an unsaved editor buffer.
+func ReadFileContent(ws *workspace.Workspace, path string) (content string, overlay bool, err error) {
+	relPath, err := ws.ResolveFilePath(path)
+	if err != nil {
+		return "", false, err
+	}
+	return readContent(ws, relPath)
+}
+
+// readContent reads the content of the overlay of the file if any, or the content of the indexed file
+func readContent(ws *workspace.Workspace, relPath string) (string, bool, error) {
+	if o := bufferOverlays.active(ws)[indexer.GetDocumentId(filepath.Join(ws.Path, relPath))]; o != nil {
+		return o.content, true, nil
+	}
+
+	content, err := readIndexedFile(ws, relPath)
+	return content, false, err
+}
+
+// readIndexedFile reads the content of an indexed text file of the workspace
+func readIndexedFile(ws *workspace.Workspace, relPath string) (string, error) {
+	fullPath := filepath.Join(ws.Path, relPath)
+	doc, err := fulltext.GetDocument(ws.ID, indexer.GetDocumentId(fullPath), false)
+	if err != nil || doc == nil {
+		return "", fmt.Errorf("file `%s` is not indexed in the workspace", relPath)
+	}
+
+	filter, err := newFileFilter(ws, nil)
+	if err != nil {
+		return "", err
+	}
+	if !filter.wantPath(relPath) {
+		return "", fmt.Errorf("file `%s` is excluded by the workspace filters", relPath)
+	}
+
+	stat, err := os.Stat(fullPath)
+	if err != nil {
+		return "", err
+	}
+	if stat.IsDir() {
+		return "", fmt.Errorf("`%s` is a directory", relPath)
+	}
+	if stat.Size() > conf.Get().Server.MaxFileSize {
+		return "", fmt.Errorf("file `%s` exceeds the max file size %d", relPath, conf.Get().Server.MaxFileSize)
+	}
+
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", err
+	}
+	if !indexer.IsLikelyText(data) {
+		return "", fmt.Errorf("file `%s` is not text", relPath)
+	}
+
+	return string(data), nil
+}
+
+// ScanIndexedFiles calls fn for each indexed file of the workspace which is not excluded by the workspace filters,
+// the files are scanned in the order of their document ids. It stops once fn returns false.
+func ScanIndexedFiles(ws *workspace.Workspace, fn func(docid, relPath string) bool) error {
+	filter, err := newFileFilter(ws, nil)
+	if err != nil {
+		return err
+	}
+
+	fulltext.ScanFiles(ws.ID, func(docid, relPath string) bool {
+		if !filter.wantPath(relPath) {
+			return true
+		}
+		return fn(docid, relPath)
+	})
+	return nil
+}
+
+// ListDir lists the indexed children of a directory of the workspace, with the number of indexed files in each
+// child directory. An empty path is the root of the workspace.
+func ListDir(ws *workspace.Workspace, path string) (*types.ListDirResult, error) {
+	relPath, err := ws.ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := newFileFilter(ws, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if relPath != "" {
+		prefix = relPath + string(filepath.Separator)
+	}
+
+	result := &types.ListDirResult{
+		Workspace: ws.Path,
+		Path:      relPath,
+		Entries:   []types.DirEntry{},
+	}
+
+	children := map[string]*types.DirEntry{}
+	fulltext.ScanFiles(ws.ID, func(_, filePath string) bool {
+		filePath = filepath.Clean(filePath)
+		if !strings.HasPrefix(filePath, prefix) || !filter.wantPath(filePath) {
+			return true
+		}
+
+		result.TotalFiles++
+		name, _, isDir := strings.Cut(filePath[len(prefix):], string(filepath.Separator))
+		entry := children[name]
+		if entry == nil {
+			entry = &types.DirEntry{Name: name, Dir: isDir}
+			children[name] = entry
+		}
+		if isDir {
+			entry.Files++
+		}
+		return true
+	})
+
+	if result.TotalFiles == 0 && relPath != "" {
+		stat, err := os.Stat(filepath.Join(ws.Path, relPath))
+		if err != nil || !stat.IsDir() {
+			return nil, fmt.Errorf("directory `%s` is not found in the workspace", relPath)
+		}
+	}
+
+	for _, entry := range children {
+		result.Entries = append(result.Entries, *entry)
+	}
+	sort.Slice(result.Entries, func(i, j int) bool {
+		if result.Entries[i].Dir != result.Entries[j].Dir {
+			return result.Entries[i].Dir
+		}
+		return result.Entries[i].Name < result.Entries[j].Name
+	})
+
+	if len(result.Entries) > MaxListDirEntries {
+		result.Entries = result.Entries[:MaxListDirEntries]
+		result.Truncate = true
+	}
+
+	return result, nil
+}
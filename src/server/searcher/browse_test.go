@@ -0,0 +1,118 @@
+package searcher
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestBrowse(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "haystack-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	conf.Get().Global.DataPath = filepath.Join(tempDir, "data")
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer fulltext.CloseAndWait()
+
+	wsPath := filepath.Join(tempDir, "ws")
+	ws := &workspace.Workspace{ID: "browse-test", Path: wsPath}
+	defer ClearOverlays(ws, nil)
+
+	files := map[string]string{
+		"main.go":           "package main\n\nfunc main() {\n}\n",
+		"src/a.go":          "package src\n",
+		"src/core/b.go":     "package core\n",
+		"src/core/c.go":     "package core\n",
+		"docs/unindexed.md": "# Docs\n",
+	}
+	docs := []*fulltext.Document{}
+	for relPath, content := range files {
+		fullPath := filepath.Join(wsPath, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if relPath != "docs/unindexed.md" {
+			docs = append(docs, &fulltext.Document{ID: indexer.GetDocumentId(fullPath), RelPath: relPath})
+		}
+	}
+	if err := fulltext.SaveNewDocuments(ws.ID, docs); err != nil {
+		t.Fatalf("SaveNewDocuments failed: %v", err)
+	}
+
+	// Only the indexed files are listed, directories first
+	list, err := ListDir(ws, "")
+	if err != nil {
+		t.Fatalf("ListDir() error = %v", err)
+	}
+	want := []types.DirEntry{{Name: "src", Dir: true, Files: 3}, {Name: "main.go"}}
+	if !reflect.DeepEqual(list.Entries, want) || list.TotalFiles != 4 {
+		t.Errorf("ListDir() got %v, %d files, want %v", list.Entries, list.TotalFiles, want)
+	}
+
+	list, err = ListDir(ws, "src/")
+	if err != nil {
+		t.Fatalf("ListDir() error = %v", err)
+	}
+	want = []types.DirEntry{{Name: "core", Dir: true, Files: 2}, {Name: "a.go"}}
+	if !reflect.DeepEqual(list.Entries, want) || list.Path != "src" {
+		t.Errorf("ListDir(src) got %s %v, want %v", list.Path, list.Entries, want)
+	}
+
+	if _, err := ListDir(ws, "missing"); err == nil {
+		t.Error("ListDir() of a missing directory got no error")
+	}
+	if _, err := ListDir(ws, "../"); err == nil {
+		t.Error("ListDir() out of the workspace got no error")
+	}
+	if _, err := ListDir(ws, filepath.Join(wsPath, "src")); err == nil {
+		t.Error("ListDir() of an absolute path got no error")
+	}
+
+	read, err := ReadFile(ws, "main.go", 2, 3)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !reflect.DeepEqual(read.Lines, []string{"", "func main() {"}) || read.EndLine != 3 || read.TotalLines != 4 {
+		t.Errorf("ReadFile() got %q, lines %d-%d of %d", read.Lines, read.StartLine, read.EndLine, read.TotalLines)
+	}
+
+	// The range is capped by the end of the file
+	read, err = ReadFile(ws, "main.go", 4, 0)
+	if err != nil || !reflect.DeepEqual(read.Lines, []string{"}"}) || read.EndLine != 4 {
+		t.Errorf("ReadFile() got %q, end line %d, error %v", read.Lines, read.EndLine, err)
+	}
+
+	if _, err := ReadFile(ws, "main.go", 3, 2); err == nil {
+		t.Error("ReadFile() of an invalid range got no error")
+	}
+	if _, err := ReadFile(ws, "docs/unindexed.md", 0, 0); err == nil {
+		t.Error("ReadFile() of an unindexed file got no error")
+	}
+	if _, err := ReadFile(ws, "../outside.go", 0, 0); err == nil {
+		t.Error("ReadFile() out of the workspace got no error")
+	}
+
+	// Overlays are read instead of the files on disk
+	if _, err := SetOverlay(ws, &types.OverlaySetRequest{Path: "src/a.go", Content: "package src\n\nvar x = 1\n"}); err != nil {
+		t.Fatalf("SetOverlay() error = %v", err)
+	}
+	read, err = ReadFile(ws, "src/a.go", 0, 0)
+	if err != nil || !read.Overlay || read.TotalLines != 3 {
+		t.Errorf("ReadFile() of an overlay got %+v, error %v", read, err)
+	}
+}
@@ -0,0 +1,296 @@
+package searcher
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// searchCache is an LRU cache of content search results
+// Entries are invalidated once the documents of any of their workspaces change
+type searchCache struct {
+	mutex sync.Mutex
+
+	bytes   int64
+	lru     *list.List // of *cacheEntry, the front is the most recently used
+	entries map[string]*list.Element
+
+	// generations are increased when a workspace changes,
+	// so results of searches started before the change are not cached
+	generations map[string]uint64
+	// epoch is increased once the cache is cleared, it's added to the generations of all the workspaces
+	epoch uint64
+
+	hits          int64
+	misses        int64
+	evictions     int64
+	invalidations int64
+}
+
+type cacheEntry struct {
+	key        string
+	workspaces []string // ids of the workspaces searched
+	results    []types.SearchContentResult
+	summary    types.SearchContentSummary
+	size       int64
+
+	// modTimes are the modification times of the result files when they are cached
+	// Files changed on disk are only re-indexed once they are searched, so a cached entry is stale if any differs
+	modTimes map[string]int64
+}
+
+// isFresh returns true if none of the result files has changed on disk since it's cached
+func (e *cacheEntry) isFresh() bool {
+	for path, modTime := range e.modTimes {
+		stat, err := os.Stat(path)
+		if err != nil || stat.ModTime().UnixNano() != modTime {
+			return false
+		}
+	}
+
+	return true
+}
+
+var resultCache = newSearchCache()
+
+func newSearchCache() *searchCache {
+	return &searchCache{
+		lru:         list.New(),
+		entries:     map[string]*list.Element{},
+		generations: map[string]uint64{},
+	}
+}
+
+// maxBytes returns the memory budget of the cache, 0 means the cache is disabled
+func (c *searchCache) maxBytes() int64 {
+	return max(conf.Get().Server.Search.CacheSize, 0) * 1024 * 1024
+}
+
+// key returns the cache key of a search, which is the normalized request
+// returns false if the results of the request should not be cached
+func (c *searchCache) key(workspaces []*workspace.Workspace, req *types.SearchContentRequest) (string, bool) {
+	if c.maxBytes() == 0 {
+		return "", false
+	}
+
+	// Statistics of explained searches are of the search itself
+	if req.Explain {
+		return "", false
+	}
+
+	// Unsaved overlays change without changing the documents of the workspaces
+	if bufferOverlays.hasOverlays(workspaces) {
+		return "", false
+	}
+
+	// Relative times depend on the time of the search
+	if req.Filters != nil && (reRelativeTime.MatchString(req.Filters.ModifiedAfter) ||
+		reRelativeTime.MatchString(req.Filters.ModifiedBefore)) {
+		return "", false
+	}
+
+	normalized := *req
+	normalized.Workspace = ""
+	normalized.Workspaces = workspaceIds(workspaces)
+	normalized.Query = strings.Join(strings.Fields(req.Query), " ")
+	normalized.TimeoutMs = 0
+
+	limit := getSearchLimit(req)
+	normalized.Limit = &limit
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", false
+	}
+
+	return string(data), true
+}
+
+// get returns the cached entry of the key, nil if it's not cached or it's stale
+func (c *searchCache) get(key string) *cacheEntry {
+	c.mutex.Lock()
+	element, ok := c.entries[key]
+	c.mutex.Unlock()
+
+	// Check the result files without holding the lock
+	if !ok || !element.Value.(*cacheEntry).isFresh() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if ok && c.entries[key] == element {
+			c.remove(element)
+			c.invalidations++
+		}
+		c.misses++
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.hits++
+	if c.entries[key] == element {
+		c.lru.MoveToFront(element)
+	}
+	return element.Value.(*cacheEntry)
+}
+
+// snapshot returns the generations of the workspaces before a search starts
+func (c *searchCache) snapshot(ids []string) []uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	generations := make([]uint64, len(ids))
+	for i, id := range ids {
+		generations[i] = c.generations[id] + c.epoch
+	}
+
+	return generations
+}
+
+// put caches the results of a search, unless any of the workspaces has changed since the snapshot
+func (c *searchCache) put(key string, ids []string, generations []uint64,
+	results []types.SearchContentResult, summary types.SearchContentSummary) {
+	entry := &cacheEntry{
+		key:        key,
+		workspaces: ids,
+		results:    results,
+		summary:    summary,
+		size:       estimateResultsSize(key, results),
+		modTimes:   map[string]int64{},
+	}
+
+	for _, result := range results {
+		path := filepath.Join(result.Workspace, result.File)
+		stat, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		entry.modTimes[path] = stat.ModTime().UnixNano()
+	}
+
+	maxBytes := c.maxBytes()
+	if entry.size > maxBytes {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, id := range ids {
+		if c.generations[id]+c.epoch != generations[i] {
+			return
+		}
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+
+	for c.bytes > maxBytes && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// invalidate removes the entries of a workspace, it's called once the documents of the workspace change
+func (c *searchCache) invalidate(workspaceid string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generations[workspaceid]++
+
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		for _, id := range element.Value.(*cacheEntry).workspaces {
+			if id == workspaceid {
+				c.remove(element)
+				c.invalidations++
+				break
+			}
+		}
+		element = next
+	}
+}
+
+// clear removes all the entries, it's called once the search configuration changes
+func (c *searchCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.epoch++
+	c.invalidations += int64(c.lru.Len())
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	c.bytes = 0
+}
+
+func (c *searchCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *searchCache) stats() types.SearchCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return types.SearchCacheStats{
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Entries:       c.lru.Len(),
+		Bytes:         c.bytes,
+		MaxBytes:      c.maxBytes(),
+		Evictions:     c.evictions,
+		Invalidations: c.invalidations,
+	}
+}
+
+// CacheStats returns the statistics of the search result cache
+func CacheStats() types.SearchCacheStats {
+	return resultCache.stats()
+}
+
+// workspaceIds returns the sorted ids of the workspaces
+func workspaceIds(workspaces []*workspace.Workspace) []string {
+	ids := make([]string, 0, len(workspaces))
+	for _, ws := range workspaces {
+		ids = append(ids, ws.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// estimateResultsSize estimates the memory used by the cached results, it counts the strings and a fixed overhead
+func estimateResultsSize(key string, results []types.SearchContentResult) int64 {
+	const overhead = 64
+
+	var lineSize = func(line types.SearchContentLine) int64 {
+		return int64(len(line.Content)) + overhead
+	}
+
+	size := int64(len(key)) + overhead
+	for _, result := range results {
+		size += int64(len(result.Workspace)+len(result.File)) + overhead
+		for _, match := range result.Lines {
+			size += lineSize(match.Line) + int64(len(match.Term)) + overhead
+			for _, lines := range [][]types.SearchContentLine{match.Before, match.Span, match.After} {
+				for _, line := range lines {
+					size += lineSize(line)
+				}
+			}
+		}
+	}
+
+	return size
+}
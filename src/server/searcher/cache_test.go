@@ -0,0 +1,134 @@
+package searcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// newCacheResults writes the file into dir and returns a result of it
+func newCacheResults(t *testing.T, dir string, file string, content string) []types.SearchContentResult {
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return []types.SearchContentResult{{
+		Workspace: dir,
+		File:      file,
+		Lines: []types.LineMatch{{
+			Line: types.SearchContentLine{LineNumber: 1, Content: content},
+		}},
+	}}
+}
+
+func TestSearchCacheKey(t *testing.T) {
+	cache := newSearchCache()
+	workspaces := []*workspace.Workspace{{ID: "2", Path: "/b"}, {ID: "1", Path: "/a"}}
+
+	key1, ok := cache.key(workspaces, &types.SearchContentRequest{Workspace: "/a", Query: " foo   bar ", TimeoutMs: 100})
+	if !ok {
+		t.Fatal("key() expected the request to be cacheable")
+	}
+	key2, _ := cache.key(workspaces[1:], &types.SearchContentRequest{Workspaces: []string{"all"}, Query: "foo bar"})
+	key3, _ := cache.key([]*workspace.Workspace{workspaces[1], workspaces[0]}, &types.SearchContentRequest{Query: "foo bar"})
+	if key1 == key2 {
+		t.Error("key() expected different keys for different workspaces")
+	}
+	if key1 != key3 {
+		t.Errorf("key() expected the same key for the normalized request, got %s and %s", key1, key3)
+	}
+
+	if _, ok := cache.key(workspaces, &types.SearchContentRequest{
+		Query:   "foo",
+		Filters: &types.SearchFilters{ModifiedAfter: "7d"},
+	}); ok {
+		t.Error("key() expected relative times not to be cacheable")
+	}
+}
+
+func TestSearchCache(t *testing.T) {
+	saved := conf.Get().Server.Search.CacheSize
+	defer func() { conf.Get().Server.Search.CacheSize = saved }()
+	conf.Get().Server.Search.CacheSize = 1 // MB
+
+	cache := newSearchCache()
+	dir := t.TempDir()
+
+	// Put and get
+	cache.put("a", []string{"1"}, cache.snapshot([]string{"1"}), newCacheResults(t, dir, "a.go", "foo"), types.SearchContentSummary{TotalHits: 1})
+	cache.put("b", []string{"1", "2"}, cache.snapshot([]string{"1", "2"}), newCacheResults(t, dir, "b.go", "foo"), types.SearchContentSummary{})
+	cache.put("c", []string{"2"}, cache.snapshot([]string{"2"}), newCacheResults(t, dir, "c.go", "foo"), types.SearchContentSummary{})
+
+	entry := cache.get("a")
+	if entry == nil || entry.summary.TotalHits != 1 || entry.results[0].File != "a.go" {
+		t.Fatalf("get() got %+v, want the entry of a", entry)
+	}
+	if cache.get("missing") != nil {
+		t.Error("get() expected nil for a missing key")
+	}
+
+	// Invalidate the entries of workspace 1
+	cache.invalidate("1")
+	if cache.get("a") != nil || cache.get("b") != nil {
+		t.Error("invalidate() expected the entries of workspace 1 to be removed")
+	}
+	if cache.get("c") == nil {
+		t.Error("invalidate() expected the entries of workspace 2 to be kept")
+	}
+
+	// A search started before a change is not cached
+	generations := cache.snapshot([]string{"2"})
+	cache.invalidate("2")
+	cache.put("d", []string{"2"}, generations, newCacheResults(t, dir, "d.go", "foo"), types.SearchContentSummary{})
+	if cache.get("d") != nil {
+		t.Error("put() expected stale results not to be cached")
+	}
+
+	// Entries are stale once a result file changes on disk
+	cache.put("h", []string{"4"}, cache.snapshot([]string{"4"}), newCacheResults(t, dir, "h.go", "foo"), types.SearchContentSummary{})
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "h.go"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if cache.get("h") != nil {
+		t.Error("get() expected the entry of a changed file to be stale")
+	}
+
+	// Evict the least recently used entries once the budget is exceeded
+	big := strings.Repeat("x", 400*1024)
+	cache.put("e", []string{"3"}, cache.snapshot([]string{"3"}), newCacheResults(t, dir, "e.go", big), types.SearchContentSummary{})
+	cache.put("f", []string{"3"}, cache.snapshot([]string{"3"}), newCacheResults(t, dir, "f.go", big), types.SearchContentSummary{})
+	cache.get("e")
+	cache.put("g", []string{"3"}, cache.snapshot([]string{"3"}), newCacheResults(t, dir, "g.go", big), types.SearchContentSummary{})
+	if cache.get("f") != nil {
+		t.Error("put() expected the least recently used entry to be evicted")
+	}
+	if cache.get("e") == nil || cache.get("g") == nil {
+		t.Error("put() expected the recently used entries to be kept")
+	}
+
+	stats := cache.stats()
+	if stats.Bytes > stats.MaxBytes || stats.Evictions != 1 || stats.Invalidations != 4 || stats.Entries != 2 {
+		t.Errorf("stats() got %+v", stats)
+	}
+	if stats.Hits == 0 || stats.Misses == 0 {
+		t.Errorf("stats() expected hits and misses, got %+v", stats)
+	}
+
+	// Clearing removes all the entries, and the searches started before it are not cached
+	generations = cache.snapshot([]string{"5"})
+	cache.clear()
+	if cache.get("e") != nil || cache.get("g") != nil || cache.stats().Bytes != 0 {
+		t.Error("clear() expected all the entries to be removed")
+	}
+	cache.put("i", []string{"5"}, generations, newCacheResults(t, dir, "i.go", "foo"), types.SearchContentSummary{})
+	if cache.get("i") != nil {
+		t.Error("put() expected results of a search before clear() not to be cached")
+	}
+}
@@ -0,0 +1,95 @@
+package searcher
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// workspaceStats are the statistics of searching a workspace, they are reported if explain is requested
+type workspaceStats struct {
+	candidates     int
+	filesRead      atomic.Int64
+	filesSkipped   atomic.Int64
+	filesRemoved   atomic.Int64
+	filesMatched   atomic.Int64
+	filesTruncated atomic.Int64
+
+	compileTime time.Duration
+	collectTime time.Duration
+	matchTime   time.Duration
+}
+
+// explain returns the query plan of the engine with the statistics of the workspace
+// The candidates of the clauses and terms are only known once the documents are collected
+func (stats *workspaceStats) explain(engine *SimpleContentSearchEngine, multiline bool) types.SearchExplainWorkspace {
+	scope := engine.Scope
+	if scope == "" {
+		scope = types.SearchScopeLine
+	}
+
+	explain := types.SearchExplainWorkspace{
+		Workspace: engine.Workspace.Path,
+		Tree:      engine.String(),
+		Scope:     scope,
+		Clauses:   []types.SearchExplainClause{},
+
+		Candidates:     stats.candidates,
+		FilesRead:      int(stats.filesRead.Load()),
+		FilesSkipped:   int(stats.filesSkipped.Load()),
+		FilesRemoved:   int(stats.filesRemoved.Load()),
+		FilesMatched:   int(stats.filesMatched.Load()),
+		FilesTruncated: int(stats.filesTruncated.Load()),
+
+		CompileUs: stats.compileTime.Microseconds(),
+		CollectUs: stats.collectTime.Microseconds(),
+		MatchUs:   stats.matchTime.Microseconds(),
+	}
+
+	if scope == types.SearchScopeWindow {
+		explain.Window = engine.Window
+	}
+
+	for _, orClause := range engine.OrClauses {
+		clause := types.SearchExplainClause{
+			Regex:      orClause.Regex.String(),
+			Terms:      []types.SearchExplainTerm{},
+			Candidates: orClause.candidates,
+		}
+
+		if multiline && scope == types.SearchScopeLine {
+			clause.MultilineRegex = orClause.MultilineRegex.String()
+		}
+
+		for _, term := range orClause.AndTerms {
+			clause.Terms = append(clause.Terms, types.SearchExplainTerm{
+				Pattern:    term.Pattern,
+				Prefix:     term.Prefix,
+				Suffix:     term.Suffix,
+				Infix:      term.Infix,
+				Regex:      term.Regex.String(),
+				Expansions: term.Expansions,
+				Variants:   term.Variants,
+				Estimate:   term.estimate,
+				Skipped:    term.skipped,
+				Candidates: term.candidates,
+			})
+		}
+
+		for _, term := range orClause.plan {
+			clause.Plan = append(clause.Plan, term.Pattern)
+			clause.Intersections = append(clause.Intersections, term.candidates)
+		}
+
+		for _, near := range orClause.Near {
+			clause.Near = append(clause.Near, fmt.Sprintf("%s NEAR/%d %s",
+				orClause.AndTerms[near.Left].Pattern, near.Distance, orClause.AndTerms[near.Right].Pattern))
+		}
+
+		explain.Clauses = append(explain.Clauses, clause)
+	}
+
+	return explain
+}
@@ -0,0 +1,90 @@
+package searcher
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestExplain(t *testing.T) {
+	engine := NewSimpleContentSearchEngine(&workspace.Workspace{Path: "/ws"})
+	if err := engine.Compile("@window:3 Mutex NEAR/2 Lock | Unlock", false); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	// Candidates are set by CollectDocuments
+	engine.OrClauses[0].AndTerms[0].candidates = 5
+	engine.OrClauses[0].AndTerms[1].candidates = 7
+	engine.OrClauses[0].candidates = 3
+	engine.OrClauses[0].plan = []*SimpleContentSearchEngineTerm{
+		engine.OrClauses[0].AndTerms[1], engine.OrClauses[0].AndTerms[0],
+	}
+	engine.OrClauses[1].candidates = 2
+
+	stats := &workspaceStats{candidates: 4, compileTime: 1500 * time.Microsecond}
+	stats.filesRead.Add(3)
+	stats.filesSkipped.Add(1)
+	stats.filesMatched.Add(2)
+
+	explain := stats.explain(engine, true)
+	if explain.Workspace != "/ws" || explain.Tree != "Mutex AND Lock | Unlock" {
+		t.Errorf("got workspace %q and tree %q", explain.Workspace, explain.Tree)
+	}
+	if explain.Scope != types.SearchScopeWindow || explain.Window != 3 {
+		t.Errorf("got scope %s:%d, want window:3", explain.Scope, explain.Window)
+	}
+	if explain.Candidates != 4 || explain.FilesRead != 3 || explain.FilesSkipped != 1 || explain.FilesMatched != 2 {
+		t.Errorf("got file statistics %+v", explain)
+	}
+	if explain.CompileUs != 1500 {
+		t.Errorf("compile time got %dus, want 1500us", explain.CompileUs)
+	}
+
+	if len(explain.Clauses) != 2 {
+		t.Fatalf("got %d clauses, want 2", len(explain.Clauses))
+	}
+	clause := explain.Clauses[0]
+	if clause.Candidates != 3 || len(clause.Terms) != 2 || clause.Terms[1].Candidates != 7 || clause.Terms[1].Prefix != "lock" {
+		t.Errorf("got clause %+v", clause)
+	}
+	if !reflect.DeepEqual(clause.Plan, []string{"Lock", "Mutex"}) || !reflect.DeepEqual(clause.Intersections, []int{7, 5}) {
+		t.Errorf("got plan %v and intersections %v", clause.Plan, clause.Intersections)
+	}
+	if len(clause.Near) != 1 || clause.Near[0] != "Mutex NEAR/2 Lock" {
+		t.Errorf("got near %v", clause.Near)
+	}
+	// Multi-line matching is ignored by the window scope
+	if clause.Regex == "" || clause.MultilineRegex != "" {
+		t.Errorf("got regex %q and multi-line regex %q", clause.Regex, clause.MultilineRegex)
+	}
+}
+
+func TestExplainIntersections(t *testing.T) {
+	workspaces := newIndexedWorkspaces(t, map[string]string{
+		"a.go": "alpha beta",
+		"b.go": "beta gamma",
+		"c.go": "alpha gamma",
+		"d.go": "alpha",
+	})
+
+	engine := NewSimpleContentSearchEngine(workspaces[0])
+	if err := engine.Compile("@file alpha beta gamma", false); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if _, err := engine.CollectDocuments(); err != nil {
+		t.Fatalf("CollectDocuments() error = %v", err)
+	}
+
+	// Terms are intersected from the rarest, the candidates left are reported after each of them
+	clause := (&workspaceStats{}).explain(engine, false).Clauses[0]
+	if !reflect.DeepEqual(clause.Plan, []string{"beta", "gamma", "alpha"}) {
+		t.Errorf("got plan %v", clause.Plan)
+	}
+	if !reflect.DeepEqual(clause.Intersections, []int{2, 1, 0}) || clause.Candidates != 0 {
+		t.Errorf("got intersections %v and %d candidates, want [2 1 0] and none", clause.Intersections,
+			clause.Candidates)
+	}
+}
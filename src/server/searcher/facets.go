@@ -0,0 +1,137 @@
+package searcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// languages maps the file extensions to the languages of the facets
+var languages = map[string]string{
+	".go":    "Go",
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".cxx":   "C++",
+	".hh":    "C++",
+	".hpp":   "C++",
+	".hxx":   "C++",
+	".cs":    "C#",
+	".java":  "Java",
+	".kt":    "Kotlin",
+	".kts":   "Kotlin",
+	".scala": "Scala",
+	".swift": "Swift",
+	".m":     "Objective-C",
+	".mm":    "Objective-C++",
+	".rs":    "Rust",
+	".py":    "Python",
+	".rb":    "Ruby",
+	".php":   "PHP",
+	".pl":    "Perl",
+	".lua":   "Lua",
+	".dart":  "Dart",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".mjs":   "JavaScript",
+	".cjs":   "JavaScript",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".vue":   "Vue",
+	".html":  "HTML",
+	".htm":   "HTML",
+	".css":   "CSS",
+	".scss":  "SCSS",
+	".less":  "Less",
+	".sh":    "Shell",
+	".bash":  "Shell",
+	".zsh":   "Shell",
+	".ps1":   "PowerShell",
+	".sql":   "SQL",
+	".proto": "Protocol Buffers",
+	".json":  "JSON",
+	".yaml":  "YAML",
+	".yml":   "YAML",
+	".toml":  "TOML",
+	".xml":   "XML",
+	".md":    "Markdown",
+	".gn":    "GN",
+	".gni":   "GN",
+	".mojom": "Mojom",
+	".idl":   "IDL",
+}
+
+// isCountMode returns true if the mode only counts the hits rather than returning them
+func isCountMode(mode string) bool {
+	return mode == types.SearchModeCount || mode == types.SearchModeFacets || mode == types.SearchModeEstimate
+}
+
+// ValidateMode checks the mode of a content search request
+func ValidateMode(mode string) error {
+	if mode == "" || mode == types.SearchModeResults || isCountMode(mode) {
+		return nil
+	}
+
+	return fmt.Errorf("unknown search mode: %s", mode)
+}
+
+// newSearchContentCounts creates the counts of a search in the mode, nil if the mode returns the matched lines
+func newSearchContentCounts(mode string) *types.SearchContentCounts {
+	if !isCountMode(mode) {
+		return nil
+	}
+
+	counts := &types.SearchContentCounts{}
+	if mode == types.SearchModeFacets {
+		counts.Directories = map[string]types.SearchFacet{}
+		counts.Extensions = map[string]types.SearchFacet{}
+		counts.Languages = map[string]types.SearchFacet{}
+	}
+
+	return counts
+}
+
+// addFile counts the hits of a matched file
+func addFile(counts *types.SearchContentCounts, relPath string, hits int) {
+	counts.TotalHits += hits
+	counts.TotalFiles++
+
+	if counts.Directories == nil {
+		return
+	}
+
+	var add = func(facets map[string]types.SearchFacet, key string) {
+		facet := facets[key]
+		facet.Hits += hits
+		facet.Files++
+		facets[key] = facet
+	}
+
+	add(counts.Directories, topLevelDirectory(relPath))
+
+	ext := strings.ToLower(filepath.Ext(relPath))
+	if ext == "" {
+		add(counts.Extensions, "(none)")
+	} else {
+		add(counts.Extensions, ext)
+	}
+
+	language, ok := languages[ext]
+	if !ok {
+		language = "Other"
+	}
+	add(counts.Languages, language)
+}
+
+// topLevelDirectory returns the first directory of a relative path, "." if the file is in the root
+func topLevelDirectory(relPath string) string {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if i := strings.Index(relPath, "/"); i > 0 {
+		return relPath[:i]
+	}
+
+	return "."
+}
@@ -0,0 +1,48 @@
+package searcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestAddFile(t *testing.T) {
+	counts := newSearchContentCounts(types.SearchModeFacets)
+	addFile(counts, "src/a.go", 3)
+	addFile(counts, "src/web/b.ts", 2)
+	addFile(counts, "Makefile", 1)
+
+	if counts.TotalHits != 6 || counts.TotalFiles != 3 {
+		t.Errorf("got %d hits in %d files, want 6 hits in 3 files", counts.TotalHits, counts.TotalFiles)
+	}
+
+	wantDirectories := map[string]types.SearchFacet{"src": {Hits: 5, Files: 2}, ".": {Hits: 1, Files: 1}}
+	if !reflect.DeepEqual(counts.Directories, wantDirectories) {
+		t.Errorf("directories got %v, want %v", counts.Directories, wantDirectories)
+	}
+
+	wantExtensions := map[string]types.SearchFacet{".go": {Hits: 3, Files: 1}, ".ts": {Hits: 2, Files: 1}, "(none)": {Hits: 1, Files: 1}}
+	if !reflect.DeepEqual(counts.Extensions, wantExtensions) {
+		t.Errorf("extensions got %v, want %v", counts.Extensions, wantExtensions)
+	}
+
+	wantLanguages := map[string]types.SearchFacet{"Go": {Hits: 3, Files: 1}, "TypeScript": {Hits: 2, Files: 1}, "Other": {Hits: 1, Files: 1}}
+	if !reflect.DeepEqual(counts.Languages, wantLanguages) {
+		t.Errorf("languages got %v, want %v", counts.Languages, wantLanguages)
+	}
+
+	// The count mode has no facets
+	counts = newSearchContentCounts(types.SearchModeCount)
+	addFile(counts, "src/a.go", 3)
+	if counts.TotalHits != 3 || counts.Directories != nil {
+		t.Errorf("count mode got %+v", counts)
+	}
+
+	if newSearchContentCounts("") != nil || newSearchContentCounts(types.SearchModeResults) != nil {
+		t.Error("newSearchContentCounts() expected nil for the results mode")
+	}
+	if ValidateMode("histogram") == nil {
+		t.Error("ValidateMode() expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,199 @@
+package searcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+	"github.com/codetrek/haystack/utils"
+)
+
+var reRelativeTime = regexp.MustCompile(`^(\d+)(s|m|h|d|w)$`)
+
+// fileFilter decides if a document should be searched, only the indexed metadata is used, so no file I/O is needed
+type fileFilter struct {
+	workspacePath string
+
+	pathFilter    string
+	globalInclude *utils.SimpleFilter
+	include       *utils.SimpleFilter
+	exclude       *utils.SimpleFilter
+
+	// modifiedAfter and modifiedBefore are unix nanoseconds, 0 means no limit
+	modifiedAfter  int64
+	modifiedBefore int64
+	// minSize and maxSize are in bytes, 0 means no limit
+	minSize int64
+	maxSize int64
+}
+
+// newFileFilter creates the file filter of the workspace from the filters of a request
+func newFileFilter(workspace *workspace.Workspace, filters *types.SearchFilters) (*fileFilter, error) {
+	f := &fileFilter{
+		workspacePath: workspace.Path,
+	}
+
+	if len(workspace.GetFilters().Include) > 0 {
+		f.globalInclude = utils.NewSimpleFilter(workspace.GetFilters().Include, workspace.Path)
+	}
+
+	if filters == nil {
+		return f, nil
+	}
+
+	if filters.Path != "" {
+		relPath, err := workspace.ResolvePath(filters.Path)
+		if err != nil {
+			return nil, err
+		}
+		if relPath != "" {
+			f.pathFilter = strings.ToLower(filepath.Join(workspace.Path, relPath) + string(filepath.Separator))
+		}
+	}
+
+	if filters.Include != "" {
+		f.include = utils.NewSimpleFilter(strings.Split(filters.Include, ","), workspace.Path)
+	}
+
+	if filters.Exclude != "" {
+		f.exclude = utils.NewSimpleFilter(strings.Split(filters.Exclude, ","), workspace.Path)
+	}
+
+	now := time.Now()
+	if filters.ModifiedAfter != "" {
+		t, err := ParseTimeFilter(filters.ModifiedAfter, now)
+		if err != nil {
+			return nil, err
+		}
+		f.modifiedAfter = t.UnixNano()
+	}
+
+	if filters.ModifiedBefore != "" {
+		t, err := ParseTimeFilter(filters.ModifiedBefore, now)
+		if err != nil {
+			return nil, err
+		}
+		f.modifiedBefore = t.UnixNano()
+	}
+
+	f.minSize = filters.MinSize
+	f.maxSize = filters.MaxSize
+	return f, nil
+}
+
+// hasMetadata returns true if the filter needs the metadata of documents
+func (f *fileFilter) hasMetadata() bool {
+	return f.modifiedAfter != 0 || f.modifiedBefore != 0 || f.minSize > 0 || f.maxSize > 0
+}
+
+// wantFile returns true if the document should be included in the search
+func (f *fileFilter) wantFile(doc *fulltext.Document) bool {
+	if f.modifiedAfter != 0 && doc.ModifiedTime < f.modifiedAfter {
+		return false
+	}
+
+	if f.modifiedBefore != 0 && doc.ModifiedTime >= f.modifiedBefore {
+		return false
+	}
+
+	if f.minSize > 0 && doc.Size < f.minSize {
+		return false
+	}
+
+	if f.maxSize > 0 && doc.Size > f.maxSize {
+		return false
+	}
+
+	return f.wantPath(doc.RelPath)
+}
+
+// wantPath returns true if the relative path should be included in the search
+func (f *fileFilter) wantPath(relPath string) bool {
+	fullPath := filepath.Join(f.workspacePath, relPath)
+	if len(f.pathFilter) > 0 && !strings.HasPrefix(strings.ToLower(fullPath), f.pathFilter) {
+		return false
+	}
+
+	// File not included by workspace filters
+	if f.globalInclude != nil && !f.globalInclude.Match(fullPath, false) {
+		return false
+	}
+
+	// Excluded by filter
+	if f.exclude != nil && f.exclude.Match(fullPath, false) {
+		return false
+	}
+
+	// Not included by include filter
+	if f.include != nil && !f.include.Match(fullPath, false) {
+		return false
+	}
+
+	return true
+}
+
+// ValidateFilters checks the values of the filters which need to be parsed, the path must be in every workspace
+func ValidateFilters(workspaces []*workspace.Workspace, filters *types.SearchFilters) error {
+	if filters == nil {
+		return nil
+	}
+
+	for _, ws := range workspaces {
+		if _, err := ws.ResolvePath(filters.Path); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if _, err := ParseTimeFilter(filters.ModifiedAfter, now); filters.ModifiedAfter != "" && err != nil {
+		return err
+	}
+
+	if _, err := ParseTimeFilter(filters.ModifiedBefore, now); filters.ModifiedBefore != "" && err != nil {
+		return err
+	}
+
+	if filters.MinSize < 0 || filters.MaxSize < 0 {
+		return fmt.Errorf("size filters could not be negative")
+	}
+
+	return nil
+}
+
+// ParseTimeFilter parses the time of modified_after and modified_before
+// It's an RFC 3339 time, a date like 2006-01-02 in local time,
+// or a time relative to now like 30m, 12h, 7d or 2w, which means that long ago
+func ParseTimeFilter(value string, now time.Time) (time.Time, error) {
+	if m := reRelativeTime.FindStringSubmatch(value); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time `%s`: %v", value, err)
+		}
+
+		unit := map[string]time.Duration{
+			"s": time.Second,
+			"m": time.Minute,
+			"h": time.Hour,
+			"d": 24 * time.Hour,
+			"w": 7 * 24 * time.Hour,
+		}[m[2]]
+
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time `%s`, expected a time like 7d, 12h, 2006-01-02 or RFC 3339", value)
+}
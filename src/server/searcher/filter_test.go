@@ -0,0 +1,85 @@
+package searcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestParseTimeFilter(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "30m", want: now.Add(-30 * time.Minute)},
+		{value: "12h", want: now.Add(-12 * time.Hour)},
+		{value: "7d", want: now.Add(-7 * 24 * time.Hour)},
+		{value: "2w", want: now.Add(-14 * 24 * time.Hour)},
+		{value: "2025-03-01T08:00:00Z", want: time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{value: "2025-03-01", want: time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)},
+		{value: "7y", wantErr: true},
+		{value: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTimeFilter(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ParseTimeFilter() got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	ws := &workspace.Workspace{Path: "/projects/app"}
+	now := time.Now()
+
+	recent := &fulltext.Document{RelPath: "src/a.go", Size: 100, ModifiedTime: now.Add(-time.Hour).UnixNano()}
+	old := &fulltext.Document{RelPath: "src/b.go", Size: 5000, ModifiedTime: now.Add(-30 * 24 * time.Hour).UnixNano()}
+
+	tests := []struct {
+		name       string
+		filters    *types.SearchFilters
+		wantRecent bool
+		wantOld    bool
+	}{
+		{name: "no filters", filters: nil, wantRecent: true, wantOld: true},
+		{name: "modified after", filters: &types.SearchFilters{ModifiedAfter: "7d"}, wantRecent: true, wantOld: false},
+		{name: "modified before", filters: &types.SearchFilters{ModifiedBefore: "7d"}, wantRecent: false, wantOld: true},
+		{name: "min size", filters: &types.SearchFilters{MinSize: 1000}, wantRecent: false, wantOld: true},
+		{name: "max size", filters: &types.SearchFilters{MaxSize: 1000}, wantRecent: true, wantOld: false},
+		{name: "path and size", filters: &types.SearchFilters{Path: "lib", MaxSize: 1000}, wantRecent: false, wantOld: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newFileFilter(ws, tt.filters)
+			if err != nil {
+				t.Fatalf("newFileFilter() error = %v", err)
+			}
+			if got := filter.wantFile(recent); got != tt.wantRecent {
+				t.Errorf("wantFile(recent) got %t, want %t", got, tt.wantRecent)
+			}
+			if got := filter.wantFile(old); got != tt.wantOld {
+				t.Errorf("wantFile(old) got %t, want %t", got, tt.wantOld)
+			}
+		})
+	}
+
+	if err := ValidateFilters(nil, &types.SearchFilters{ModifiedAfter: "soon"}); err == nil {
+		t.Error("ValidateFilters() expected an error for an invalid time")
+	}
+	if err := ValidateFilters(nil, &types.SearchFilters{MinSize: -1}); err == nil {
+		t.Error("ValidateFilters() expected an error for a negative size")
+	}
+}
@@ -0,0 +1,190 @@
+package searcher
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+const (
+	// MaxFuzzyDistance is the maximum edit distance of a fuzzy term
+	MaxFuzzyDistance = 3
+	// MaxFuzzyExpansions is the maximum number of keywords a fuzzy term is expanded to
+	MaxFuzzyExpansions = 32
+)
+
+// bkNode is a node of a BK-tree, children are keyed by their edit distance to the node
+type bkNode struct {
+	keyword  string
+	children map[int]*bkNode
+}
+
+func (n *bkNode) insert(keyword string) {
+	for {
+		distance := fuzzy.LevenshteinDistance(n.keyword, keyword)
+		if distance == 0 {
+			return
+		}
+
+		child, ok := n.children[distance]
+		if !ok {
+			if n.children == nil {
+				n.children = map[int]*bkNode{}
+			}
+			n.children[distance] = &bkNode{keyword: keyword}
+			return
+		}
+		n = child
+	}
+}
+
+// search calls callback for each keyword within maxDistance of term
+func (n *bkNode) search(term string, maxDistance int, callback func(keyword string, distance int)) {
+	distance := fuzzy.LevenshteinDistance(n.keyword, term)
+	if distance <= maxDistance {
+		callback(n.keyword, distance)
+	}
+
+	// By the triangle inequality, only children in [distance-maxDistance, distance+maxDistance] could match
+	for d, child := range n.children {
+		if d >= distance-maxDistance && d <= distance+maxDistance {
+			child.search(term, maxDistance, callback)
+		}
+	}
+}
+
+// keywordDictionary is the BK-tree of all indexed keywords of a workspace
+type keywordDictionary struct {
+	root      *bkNode
+	docCounts map[string]int
+}
+
+// keywordDictionaryEntry is the dictionary of a workspace, it's built once it's used
+// The mutex is of the workspace, so dictionaries of different workspaces are built at the same time.
+type keywordDictionaryEntry struct {
+	mutex sync.Mutex
+	dict  *keywordDictionary
+}
+
+var (
+	keywordDictionaries      = map[string]*keywordDictionaryEntry{}
+	keywordDictionariesMutex sync.Mutex
+)
+
+// newKeywordDictionary builds the keyword dictionary from keywords and their document counts
+func newKeywordDictionary(docCounts map[string]int) *keywordDictionary {
+	dict := &keywordDictionary{
+		docCounts: docCounts,
+	}
+
+	// Insert keywords in sorted order so the tree is the same for the same keywords
+	keywords := make([]string, 0, len(docCounts))
+	for keyword := range docCounts {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		if dict.root == nil {
+			dict.root = &bkNode{keyword: keyword}
+			continue
+		}
+		dict.root.insert(keyword)
+	}
+
+	return dict
+}
+
+// getKeywordDictionary returns the keyword dictionary of the workspace, it's built once the workspace is changed
+func getKeywordDictionary(workspaceid string) *keywordDictionary {
+	keywordDictionariesMutex.Lock()
+	entry := keywordDictionaries[workspaceid]
+	if entry == nil {
+		entry = &keywordDictionaryEntry{}
+		keywordDictionaries[workspaceid] = entry
+	}
+	keywordDictionariesMutex.Unlock()
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	if entry.dict != nil {
+		return entry.dict
+	}
+
+	docCounts := map[string]int{}
+	fulltext.ScanKeywords(workspaceid, "", func(keyword string, doccount int) bool {
+		docCounts[keyword] += doccount
+		return true
+	})
+
+	entry.dict = newKeywordDictionary(docCounts)
+	return entry.dict
+}
+
+// invalidateKeywordDictionary drops the keyword dictionary of a changed or deleted workspace
+// A dictionary being built by a search is of the keywords before the change, it's only used by that search.
+func invalidateKeywordDictionary(workspaceid string) {
+	keywordDictionariesMutex.Lock()
+	defer keywordDictionariesMutex.Unlock()
+
+	delete(keywordDictionaries, workspaceid)
+}
+
+// expand returns the keywords within maxDistance of term
+// ordered by edit distance, then by document count, at most MaxFuzzyExpansions keywords are returned
+func (d *keywordDictionary) expand(term string, maxDistance int) []string {
+	if d.root == nil {
+		return []string{}
+	}
+
+	type candidate struct {
+		keyword  string
+		distance int
+	}
+
+	candidates := []candidate{}
+	d.root.search(term, maxDistance, func(keyword string, distance int) {
+		candidates = append(candidates, candidate{keyword, distance})
+	})
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		if d.docCounts[candidates[i].keyword] != d.docCounts[candidates[j].keyword] {
+			return d.docCounts[candidates[i].keyword] > d.docCounts[candidates[j].keyword]
+		}
+		return candidates[i].keyword < candidates[j].keyword
+	})
+
+	keywords := []string{}
+	for _, c := range candidates {
+		if len(keywords) >= MaxFuzzyExpansions {
+			break
+		}
+		keywords = append(keywords, c.keyword)
+	}
+
+	return keywords
+}
+
+// fuzzyDistance returns the edit distance of a fuzzy term
+// distance is the requested distance, 0 means it depends on the length of the term
+func fuzzyDistance(term string, distance int) int {
+	if distance > 0 {
+		return min(distance, MaxFuzzyDistance)
+	}
+
+	if len(term) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// expandFuzzyTerm expands a fuzzy term to the indexed keywords of the workspace
+var expandFuzzyTerm = func(workspaceid string, term string, distance int) []string {
+	return getKeywordDictionary(workspaceid).expand(term, distance)
+}
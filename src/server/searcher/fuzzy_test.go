@@ -0,0 +1,142 @@
+package searcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeywordDictionaryExpand(t *testing.T) {
+	dict := newKeywordDictionary(map[string]int{
+		"receive":  10,
+		"received": 3,
+		"receiver": 5,
+		"recipe":   1,
+		"deceive":  2,
+		"mutex":    7,
+	})
+
+	tests := []struct {
+		name     string
+		term     string
+		distance int
+		want     []string
+	}{
+		{
+			name:     "exact keyword first",
+			term:     "receive",
+			distance: 1,
+			want:     []string{"receive", "receiver", "received", "deceive"},
+		},
+		{
+			name:     "transposed letters",
+			term:     "recieve",
+			distance: 2,
+			want:     []string{"receive", "recipe"},
+		},
+		{
+			name:     "nothing within distance",
+			term:     "lock",
+			distance: 1,
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dict.expand(tt.term, tt.distance)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expand() got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	empty := newKeywordDictionary(map[string]int{})
+	if got := empty.expand("receive", 2); len(got) != 0 {
+		t.Errorf("expand() on empty dictionary got %v, want nothing", got)
+	}
+}
+
+func TestFuzzyDistance(t *testing.T) {
+	if got := fuzzyDistance("lock", 0); got != 1 {
+		t.Errorf("fuzzyDistance(lock) got %d, want 1", got)
+	}
+	if got := fuzzyDistance("receive", 0); got != 2 {
+		t.Errorf("fuzzyDistance(receive) got %d, want 2", got)
+	}
+	if got := fuzzyDistance("receive", 10); got != MaxFuzzyDistance {
+		t.Errorf("fuzzyDistance(receive, 10) got %d, want %d", got, MaxFuzzyDistance)
+	}
+}
+
+func TestCompileFuzzy(t *testing.T) {
+	original := expandFuzzyTerm
+	defer func() { expandFuzzyTerm = original }()
+
+	expandFuzzyTerm = func(workspaceid string, term string, distance int) []string {
+		if term == "recieve" {
+			return []string{"receive", "receiver"}
+		}
+		return []string{}
+	}
+
+	engine := &SimpleContentSearchEngine{}
+	if err := engine.Compile("~recieve msg", false); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	want := map[string][]string{"recieve": {"receive", "receiver"}}
+	if got := engine.Expansions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expansions() got %v, want %v", got, want)
+	}
+
+	if got := engine.IsLineMatch("func Receive(msg string)"); len(got) != 1 {
+		t.Errorf("IsLineMatch() got %d matches, want 1", len(got))
+	}
+	if got := engine.IsLineMatch("func Receiving(msg string)"); len(got) != 0 {
+		t.Errorf("IsLineMatch() got %d matches on a different keyword, want 0", len(got))
+	}
+
+	// Unknown fuzzy term matches nothing, and wildcard terms are never fuzzy
+	engine = &SimpleContentSearchEngine{Fuzzy: true}
+	if err := engine.Compile("zzz rec*", false); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	want = map[string][]string{"zzz": {"zzz"}}
+	if got := engine.Expansions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expansions() got %v, want %v", got, want)
+	}
+}
+
+func TestGetKeywordDictionary(t *testing.T) {
+	workspaces := newIndexedWorkspaces(t, map[string]string{"a.go": "receive receiver"}, map[string]string{"b.go": "mutex"})
+	defer invalidateKeywordDictionary(workspaces[0].ID)
+	defer invalidateKeywordDictionary(workspaces[1].ID)
+
+	// Each workspace has its own dictionary, it's reused until the workspace changes
+	dict := getKeywordDictionary(workspaces[0].ID)
+	if !reflect.DeepEqual(dict.docCounts, map[string]int{"receive": 1, "receiver": 1}) {
+		t.Errorf("got keywords %v", dict.docCounts)
+	}
+	if other := getKeywordDictionary(workspaces[1].ID); !reflect.DeepEqual(other.docCounts, map[string]int{"mutex": 1}) {
+		t.Errorf("got keywords %v of the other workspace", other.docCounts)
+	}
+	if getKeywordDictionary(workspaces[0].ID) != dict {
+		t.Error("expected the dictionary to be reused")
+	}
+
+	// A changed or deleted workspace drops its dictionary only
+	other := getKeywordDictionary(workspaces[1].ID)
+	invalidateKeywordDictionary(workspaces[0].ID)
+	keywordDictionariesMutex.Lock()
+	_, ok := keywordDictionaries[workspaces[0].ID]
+	keywordDictionariesMutex.Unlock()
+	if ok {
+		t.Error("expected the dictionary to be removed")
+	}
+	if getKeywordDictionary(workspaces[0].ID) == dict {
+		t.Error("expected the dictionary to be built again")
+	}
+	if getKeywordDictionary(workspaces[1].ID) != other {
+		t.Error("expected the dictionary of the other workspace to be kept")
+	}
+}
@@ -0,0 +1,105 @@
+package searcher
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// splitLines splits the content into lines, and returns the byte offset of each line in the content
+// The trailing '\r' of each line is removed, so the lines are the same as bufio.ScanLines returns
+func splitLines(content string) ([]string, []int) {
+	lines := strings.Split(content, "\n")
+	offsets := make([]int, len(lines))
+
+	offset := 0
+	for i, line := range lines {
+		offsets[i] = offset
+		offset += len(line) + 1
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	// The content ends with a line break, there is no more line after it
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		offsets = offsets[:len(offsets)-1]
+	}
+
+	return lines, offsets
+}
+
+// lineOfOffset returns the 0-based line index of the byte offset
+func lineOfOffset(offsets []int, offset int) int {
+	return sort.Search(len(offsets), func(i int) bool {
+		return offsets[i] > offset
+	}) - 1
+}
+
+// matchContentMultiline matches the whole content of a file, and the matches could span multiple lines
+// window is the maximum number of lines a match may span, 0 means no limit
+// acceptHit is called for each hit, the matching stops once it returns false or maxPerFile is reached
+// returns the matches, the lines of the content and whether the matches are truncated by maxPerFile or acceptHit
+func matchContentMultiline(engine *SimpleContentSearchEngine, content string, window int, maxPerFile int,
+	acceptHit func() bool) ([]types.LineMatch, []string, bool) {
+	lines, offsets := splitLines(content)
+	matches := []types.LineMatch{}
+
+	for _, match := range engine.IsTextMatch(content) {
+		start, end := match[0], match[1]
+		if end <= start {
+			continue
+		}
+
+		startLine := lineOfOffset(offsets, start)
+		endLine := lineOfOffset(offsets, end-1)
+		if window > 0 && endLine-startLine+1 > window {
+			continue
+		}
+
+		if !acceptHit() {
+			return matches, lines, true
+		}
+
+		startColumn := min(start-offsets[startLine], len(lines[startLine]))
+		endColumn := min(end-offsets[endLine], len(lines[endLine]))
+
+		lineMatch := types.LineMatch{
+			Line: types.SearchContentLine{
+				LineNumber: startLine + 1,
+				Content:    lines[startLine],
+				Match:      []int{startColumn, len(lines[startLine])},
+			},
+			Range: &types.SearchContentRange{
+				StartLine:   startLine + 1,
+				StartColumn: startColumn,
+				EndLine:     endLine + 1,
+				EndColumn:   endColumn,
+			},
+		}
+
+		if startLine == endLine {
+			lineMatch.Line.Match = []int{startColumn, endColumn}
+		}
+
+		for i := startLine + 1; i <= endLine; i++ {
+			spanEnd := len(lines[i])
+			if i == endLine {
+				spanEnd = endColumn
+			}
+
+			lineMatch.Span = append(lineMatch.Span, types.SearchContentLine{
+				LineNumber: i + 1,
+				Content:    lines[i],
+				Match:      []int{0, spanEnd},
+			})
+		}
+
+		matches = append(matches, lineMatch)
+		if len(matches) >= maxPerFile {
+			return matches, lines, true
+		}
+	}
+
+	return matches, lines, false
+}
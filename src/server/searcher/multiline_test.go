@@ -0,0 +1,194 @@
+package searcher
+
+import (
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantLines   []string
+		wantOffsets []int
+	}{
+		{
+			name:        "single line",
+			content:     "hello",
+			wantLines:   []string{"hello"},
+			wantOffsets: []int{0},
+		},
+		{
+			name:        "trailing line break",
+			content:     "hello\nworld\n",
+			wantLines:   []string{"hello", "world"},
+			wantOffsets: []int{0, 6},
+		},
+		{
+			name:        "crlf",
+			content:     "hello\r\nworld",
+			wantLines:   []string{"hello", "world"},
+			wantOffsets: []int{0, 7},
+		},
+		{
+			name:        "empty lines",
+			content:     "a\n\nb",
+			wantLines:   []string{"a", "", "b"},
+			wantOffsets: []int{0, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, offsets := splitLines(tt.content)
+			if len(lines) != len(tt.wantLines) {
+				t.Fatalf("splitLines() got %d lines, want %d", len(lines), len(tt.wantLines))
+			}
+			for i := range lines {
+				if lines[i] != tt.wantLines[i] {
+					t.Errorf("line %d: got %q, want %q", i, lines[i], tt.wantLines[i])
+				}
+				if offsets[i] != tt.wantOffsets[i] {
+					t.Errorf("offset %d: got %d, want %d", i, offsets[i], tt.wantOffsets[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatchContentMultiline(t *testing.T) {
+	content := "func receive(\n\tctx int,\n\tmsg string) error {\n\treturn nil\n}\n"
+
+	tests := []struct {
+		name      string
+		query     string
+		window    int
+		wantCount int
+		wantStart [2]int // line, column
+		wantEnd   [2]int // line, column
+	}{
+		{
+			name:      "terms across lines",
+			query:     "receive error",
+			window:    0,
+			wantCount: 1,
+			wantStart: [2]int{1, 5},
+			wantEnd:   [2]int{3, 18},
+		},
+		{
+			name:      "window is too small",
+			query:     "receive error",
+			window:    2,
+			wantCount: 0,
+		},
+		{
+			name:      "window is large enough",
+			query:     "receive error",
+			window:    3,
+			wantCount: 1,
+			wantStart: [2]int{1, 5},
+			wantEnd:   [2]int{3, 18},
+		},
+		{
+			name:      "single line match",
+			query:     "return",
+			window:    0,
+			wantCount: 1,
+			wantStart: [2]int{4, 1},
+			wantEnd:   [2]int{4, 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &SimpleContentSearchEngine{}
+			if err := engine.Compile(tt.query, false); err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			matches, lines, _ := matchContentMultiline(engine, content, tt.window, 100, func() bool { return true })
+			if len(lines) != 5 {
+				t.Errorf("got %d lines, want 5", len(lines))
+			}
+			if len(matches) != tt.wantCount {
+				t.Fatalf("got %d matches, want %d", len(matches), tt.wantCount)
+			}
+			if tt.wantCount == 0 {
+				return
+			}
+
+			r := matches[0].Range
+			if r == nil {
+				t.Fatal("range is not set")
+			}
+			if r.StartLine != tt.wantStart[0] || r.StartColumn != tt.wantStart[1] {
+				t.Errorf("start got %d@%d, want %d@%d", r.StartLine, r.StartColumn, tt.wantStart[0], tt.wantStart[1])
+			}
+			if r.EndLine != tt.wantEnd[0] || r.EndColumn != tt.wantEnd[1] {
+				t.Errorf("end got %d@%d, want %d@%d", r.EndLine, r.EndColumn, tt.wantEnd[0], tt.wantEnd[1])
+			}
+			if len(matches[0].Span) != r.EndLine-r.StartLine {
+				t.Errorf("got %d span lines, want %d", len(matches[0].Span), r.EndLine-r.StartLine)
+			}
+		})
+	}
+}
+
+func TestMatchContentMultilineLimits(t *testing.T) {
+	engine := &SimpleContentSearchEngine{}
+	if err := engine.Compile("foo", false); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	content := "foo\nfoo\nfoo\nfoo\n"
+
+	matches, _, truncate := matchContentMultiline(engine, content, 0, 2, func() bool { return true })
+	if len(matches) != 2 || !truncate {
+		t.Errorf("per file limit: got %d matches, truncate %t, want 2 matches and truncated", len(matches), truncate)
+	}
+
+	accepted := 0
+	matches, _, truncate = matchContentMultiline(engine, content, 0, 100, func() bool {
+		accepted++
+		return accepted <= 3
+	})
+	if len(matches) != 3 || !truncate {
+		t.Errorf("total limit: got %d matches, truncate %t, want 3 matches and truncated", len(matches), truncate)
+	}
+}
+
+func TestMatchContentMultilineWrapped(t *testing.T) {
+	// The parameters between the terms are longer than MaxKeywordDistance
+	content := "func (s *Server) handleRequest(ctx context.Context,\n" +
+		"\trequest *types.SearchContentRequest, options *RequestOptions) error {\n" +
+		"\treturn nil\n}\n"
+
+	tests := []struct {
+		name      string
+		window    int
+		wantCount int
+	}{
+		{"whole file", 0, 1},
+		{"window of the signature", 2, 1},
+		{"window of a line", 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &SimpleContentSearchEngine{MultilineWindow: tt.window}
+			if err := engine.Compile("handleRequest error", false); err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			matches, _, _ := matchContentMultiline(engine, content, tt.window, 100, func() bool { return true })
+			if len(matches) != tt.wantCount {
+				t.Fatalf("got %d matches, want %d", len(matches), tt.wantCount)
+			}
+			if tt.wantCount == 0 {
+				return
+			}
+			if r := matches[0].Range; r.StartLine != 1 || r.EndLine != 2 {
+				t.Errorf("got lines %d-%d, want 1-2", r.StartLine, r.EndLine)
+			}
+		})
+	}
+}
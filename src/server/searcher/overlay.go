@@ -0,0 +1,281 @@
+package searcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+const (
+	DefaultOverlayTTL = 10 * time.Minute
+	MaxOverlayTTL     = 24 * time.Hour
+
+	// MaxOverlaysPerWorkspace limits the memory held by the unsaved buffers of a workspace
+	MaxOverlaysPerWorkspace = 256
+)
+
+// overlay is the content of an unsaved editor buffer, which is searched instead of the file on disk
+type overlay struct {
+	relPath  string
+	docid    string
+	content  string
+	hash     string
+	keywords []string // sorted, as the content would be indexed
+
+	createdAt time.Time
+	expiresAt time.Time
+
+	// diskModTime is the modification time of the file on disk when the overlay is set, 0 if it doesn't exist
+	// The file is saved once it changes, and the overlay is dropped
+	diskModTime int64
+}
+
+// document returns the document of the overlay, the content is not on disk, so it's never refreshed
+func (o *overlay) document() *fulltext.Document {
+	return &fulltext.Document{
+		ID:           o.docid,
+		RelPath:      o.relPath,
+		Size:         int64(len(o.content)),
+		ModifiedTime: o.createdAt.UnixNano(),
+		Hash:         o.hash,
+	}
+}
+
+// overlayStore holds the overlays of the workspaces, by workspace id and then by document id
+type overlayStore struct {
+	mutex      sync.Mutex
+	workspaces map[string]map[string]*overlay
+}
+
+var bufferOverlays = &overlayStore{
+	workspaces: map[string]map[string]*overlay{},
+}
+
+// diskModTime returns the modification time of the file, 0 if it doesn't exist
+func diskModTime(fullPath string) int64 {
+	stat, err := os.Stat(fullPath)
+	if err != nil {
+		return 0
+	}
+	return stat.ModTime().UnixNano()
+}
+
+// SetOverlay registers the content of an unsaved buffer of the workspace
+// If the content is the same as the file on disk, the buffer is saved and its overlay is removed instead
+// returns the active overlays of the workspace
+func SetOverlay(ws *workspace.Workspace, req *types.OverlaySetRequest) ([]types.Overlay, error) {
+	relPath, err := ws.ResolveFilePath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(req.Content)) > conf.Get().Server.MaxFileSize {
+		return nil, fmt.Errorf("overlay of `%s` exceeds the max file size %d", relPath, conf.Get().Server.MaxFileSize)
+	}
+
+	if !indexer.IsLikelyText([]byte(req.Content)) {
+		return nil, fmt.Errorf("overlay of `%s` is not text", relPath)
+	}
+
+	ttl := DefaultOverlayTTL
+	if req.TtlMs > 0 {
+		ttl = min(time.Duration(req.TtlMs)*time.Millisecond, MaxOverlayTTL)
+	}
+
+	fullPath := filepath.Join(ws.Path, relPath)
+	hash := indexer.GetContentHash([]byte(req.Content))
+	now := time.Now()
+	o := &overlay{
+		relPath:     relPath,
+		docid:       indexer.GetDocumentId(fullPath),
+		content:     req.Content,
+		hash:        hash,
+		keywords:    indexer.ParseKeywords(req.Content),
+		createdAt:   now,
+		expiresAt:   now.Add(ttl),
+		diskModTime: diskModTime(fullPath),
+	}
+
+	saved := false
+	if content, err := os.ReadFile(fullPath); err == nil {
+		saved = indexer.GetContentHash(content) == hash
+	}
+
+	bufferOverlays.mutex.Lock()
+	defer bufferOverlays.mutex.Unlock()
+
+	wsOverlays := bufferOverlays.prune(ws)
+	if saved {
+		delete(wsOverlays, o.docid)
+		return bufferOverlays.list(ws), nil
+	}
+
+	if _, ok := wsOverlays[o.docid]; !ok && len(wsOverlays) >= MaxOverlaysPerWorkspace {
+		return nil, errors.New("too many overlays in the workspace, clear some of them first")
+	}
+
+	if wsOverlays == nil {
+		wsOverlays = map[string]*overlay{}
+		bufferOverlays.workspaces[ws.ID] = wsOverlays
+	}
+
+	wsOverlays[o.docid] = o
+	return bufferOverlays.list(ws), nil
+}
+
+// ClearOverlays removes the overlays of the paths, all overlays of the workspace if paths is empty
+// returns the active overlays of the workspace
+func ClearOverlays(ws *workspace.Workspace, paths []string) ([]types.Overlay, error) {
+	docids := []string{}
+	for _, path := range paths {
+		relPath, err := ws.ResolveFilePath(path)
+		if err != nil {
+			return nil, err
+		}
+		docids = append(docids, indexer.GetDocumentId(filepath.Join(ws.Path, relPath)))
+	}
+
+	bufferOverlays.mutex.Lock()
+	defer bufferOverlays.mutex.Unlock()
+
+	if len(paths) == 0 {
+		delete(bufferOverlays.workspaces, ws.ID)
+	}
+	for _, docid := range docids {
+		delete(bufferOverlays.workspaces[ws.ID], docid)
+	}
+
+	return bufferOverlays.list(ws), nil
+}
+
+// ListOverlays returns the active overlays of the workspace
+func ListOverlays(ws *workspace.Workspace) []types.Overlay {
+	bufferOverlays.mutex.Lock()
+	defer bufferOverlays.mutex.Unlock()
+
+	return bufferOverlays.list(ws)
+}
+
+// list returns the active overlays of the workspace sorted by path, the caller must hold the lock
+func (s *overlayStore) list(ws *workspace.Workspace) []types.Overlay {
+	result := []types.Overlay{}
+	for _, o := range s.prune(ws) {
+		result = append(result, types.Overlay{
+			Path:      o.relPath,
+			Hash:      o.hash,
+			Size:      len(o.content),
+			ExpiresAt: o.expiresAt.UnixMilli(),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// prune removes the expired overlays and the ones whose file has been saved since they are set
+// returns the active overlays of the workspace, the caller must hold the lock
+func (s *overlayStore) prune(ws *workspace.Workspace) map[string]*overlay {
+	wsOverlays := s.workspaces[ws.ID]
+	now := time.Now()
+	for docid, o := range wsOverlays {
+		if now.After(o.expiresAt) || diskModTime(filepath.Join(ws.Path, o.relPath)) != o.diskModTime {
+			delete(wsOverlays, docid)
+		}
+	}
+
+	if len(wsOverlays) == 0 {
+		delete(s.workspaces, ws.ID)
+		return nil
+	}
+	return wsOverlays
+}
+
+// active returns a snapshot of the active overlays of the workspace by document id
+func (s *overlayStore) active(ws *workspace.Workspace) map[string]*overlay {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := map[string]*overlay{}
+	for docid, o := range s.prune(ws) {
+		result[docid] = o
+	}
+	return result
+}
+
+// hasOverlays returns true if any of the workspaces has active overlays
+func (s *overlayStore) hasOverlays(workspaces []*workspace.Workspace) bool {
+	for _, ws := range workspaces {
+		if len(s.active(ws)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchKeywords returns true if the keywords could contain the documents of the query, it's the check of
+// CollectDocuments for content which is not indexed. Terms skipped by the planner match any keywords.
+func (q *SimpleContentSearchEngine) MatchKeywords(keywords []string) bool {
+	for _, orClause := range q.OrClauses {
+		if orClause.matchKeywords(keywords) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *SimpleContentSearchEngineAndClause) matchKeywords(keywords []string) bool {
+	for _, term := range q.AndTerms {
+		if !term.matchKeywords(keywords) {
+			return false
+		}
+	}
+	return len(q.AndTerms) > 0
+}
+
+// matchKeywords returns true if any of the sorted keywords matches the term as the index would
+func (q *SimpleContentSearchEngineTerm) matchKeywords(keywords []string) bool {
+	var anyKeyword = func(match func(keyword string) bool) bool {
+		for _, keyword := range keywords {
+			if match(keyword) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case q.skipped:
+		return true
+	case q.Suffix != "":
+		return anyKeyword(func(keyword string) bool { return strings.HasSuffix(keyword, q.Suffix) })
+	case q.Infix != "":
+		return anyKeyword(func(keyword string) bool { return strings.Contains(keyword, q.Infix) })
+	case q.Expansions != nil:
+		for _, expansion := range q.Expansions {
+			if i := sort.SearchStrings(keywords, expansion); i < len(keywords) && keywords[i] == expansion {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, prefix := range q.prefixes() {
+		if i := sort.SearchStrings(keywords, prefix); i < len(keywords) && strings.HasPrefix(keywords[i], prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package searcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestMatchKeywords(t *testing.T) {
+	keywords := indexer.ParseKeywords("func newRequestHandler(tab_group TabGroup) { mutex.Lock() }")
+
+	tests := []struct {
+		query    string
+		variants bool
+		want     bool
+	}{
+		{"mutex", false, true},
+		{"mut lock", false, true},
+		{"mutex lock", false, true},
+		{"mutex missing", false, false},
+		{"missing | lock", false, true},
+		{"*Handler", false, true},
+		{"*quest*", false, true},
+		{"*Server", false, false},
+		{"tab-group", false, false},
+		{"tab-group", true, true},
+	}
+
+	for _, tt := range tests {
+		engine := &SimpleContentSearchEngine{Variants: tt.variants}
+		if err := engine.Compile(tt.query, false); err != nil {
+			t.Fatalf("Compile(%q) error = %v", tt.query, err)
+		}
+		if got := engine.MatchKeywords(keywords); got != tt.want {
+			t.Errorf("MatchKeywords(%q) got %t, want %t", tt.query, got, tt.want)
+		}
+	}
+
+	// Terms skipped by the planner match any keywords
+	engine := &SimpleContentSearchEngine{}
+	engine.Compile("missing", false)
+	engine.OrClauses[0].AndTerms[0].skipped = true
+	if !engine.MatchKeywords(keywords) {
+		t.Error("MatchKeywords() of a skipped term got false")
+	}
+}
+
+func TestOverlays(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "haystack-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ws := &workspace.Workspace{ID: "overlay-test", Path: tempDir}
+	defer ClearOverlays(ws, nil)
+
+	if err := os.WriteFile(filepath.Join(tempDir, "a.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var paths = func(overlays []types.Overlay) []string {
+		result := []string{}
+		for _, o := range overlays {
+			result = append(result, o.Path)
+		}
+		return result
+	}
+
+	// The content of the file on disk is not an overlay
+	overlays, err := SetOverlay(ws, &types.OverlaySetRequest{Path: "a.go", Content: "package a\n"})
+	if err != nil || len(overlays) != 0 {
+		t.Errorf("SetOverlay() got %v, error %v", paths(overlays), err)
+	}
+
+	// Files don't need to exist on disk, but they must be in the workspace
+	SetOverlay(ws, &types.OverlaySetRequest{Path: "a.go", Content: "package a\n\nfunc unsaved() {}\n"})
+	if _, err := SetOverlay(ws, &types.OverlaySetRequest{Path: filepath.Join(tempDir, "b.go"), Content: "b"}); err == nil {
+		t.Error("SetOverlay() of an absolute path got no error")
+	}
+	overlays, err = SetOverlay(ws, &types.OverlaySetRequest{Path: "b.go", Content: "package b\n"})
+	if err != nil || len(overlays) != 2 || overlays[0].Path != "a.go" || overlays[1].Path != "b.go" {
+		t.Errorf("SetOverlay() got %v, error %v", paths(overlays), err)
+	}
+
+	active := bufferOverlays.active(ws)
+	o := active[indexer.GetDocumentId(filepath.Join(tempDir, "a.go"))]
+	if o == nil || o.document().RelPath != "a.go" || len(o.keywords) != 3 {
+		t.Fatalf("active() got %v", active)
+	}
+
+	for _, path := range []string{"../c.go", "/elsewhere/c.go", "."} {
+		if _, err := SetOverlay(ws, &types.OverlaySetRequest{Path: path, Content: "x"}); err == nil {
+			t.Errorf("SetOverlay(%q) should fail", path)
+		}
+	}
+
+	// Overlays are dropped once their files are saved
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(tempDir, "a.go"), future, future)
+	if got := paths(ListOverlays(ws)); len(got) != 1 || got[0] != "b.go" {
+		t.Errorf("ListOverlays() after save got %v", got)
+	}
+
+	// and once they expire
+	SetOverlay(ws, &types.OverlaySetRequest{Path: "c.go", Content: "package c\n", TtlMs: 1})
+	time.Sleep(10 * time.Millisecond)
+	if got := paths(ListOverlays(ws)); len(got) != 1 || got[0] != "b.go" {
+		t.Errorf("ListOverlays() after expiry got %v", got)
+	}
+
+	if !bufferOverlays.hasOverlays([]*workspace.Workspace{ws}) {
+		t.Error("hasOverlays() got false")
+	}
+
+	overlays, err = ClearOverlays(ws, []string{"b.go"})
+	if err != nil || len(overlays) != 0 || bufferOverlays.hasOverlays([]*workspace.Workspace{ws}) {
+		t.Errorf("ClearOverlays() got %v, error %v", paths(overlays), err)
+	}
+}
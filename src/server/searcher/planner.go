@@ -0,0 +1,146 @@
+package searcher
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/codetrek/haystack/server/core/fulltext"
+)
+
+// errTooManyKeywords is returned by the planner if a term matches more than maxKeywords indexed keywords
+type errTooManyKeywords struct {
+	pattern     string
+	maxKeywords int
+}
+
+func (e *errTooManyKeywords) Error() string {
+	return fmt.Sprintf("term `%s` matches more than %d keywords, use a longer pattern or add a rarer term",
+		e.pattern, e.maxKeywords)
+}
+
+// planTerms estimates the number of documents of each term, and returns the terms ordered from the rarest
+// Terms matching more than maxKeywords keywords are skipped, and reported as warnings, their hits are still
+// verified by the content of the files collected by the other terms. If all terms are skipped, it's an error.
+func planTerms(workspaceId string, terms []*SimpleContentSearchEngineTerm,
+	maxKeywords int) ([]*SimpleContentSearchEngineTerm, []string, error) {
+	plan := []*SimpleContentSearchEngineTerm{}
+	warnings := []string{}
+	var tooMany error
+	for _, term := range terms {
+		term.skipped = false
+		if err := term.plan(workspaceId, maxKeywords); err != nil {
+			term.skipped = true
+			if tooMany == nil {
+				tooMany = err
+			}
+			continue
+		}
+		plan = append(plan, term)
+	}
+
+	if len(plan) == 0 && tooMany != nil {
+		return nil, nil, tooMany
+	}
+
+	for _, term := range terms {
+		if term.skipped {
+			warnings = append(warnings, fmt.Sprintf("term `%s` matches more than %d keywords, "+
+				"it's only matched in the files of the other terms", term.Pattern, maxKeywords))
+		}
+	}
+
+	sort.SliceStable(plan, func(i, j int) bool {
+		return plan[i].estimate < plan[j].estimate
+	})
+
+	if len(terms) > 1 {
+		patterns := []string{}
+		for _, term := range plan {
+			patterns = append(patterns, fmt.Sprintf("%s(~%d)", term.Pattern, term.estimate))
+		}
+		log.Printf("Planned terms: %s", strings.Join(patterns, " => "))
+	}
+
+	return plan, warnings, nil
+}
+
+// plan estimates the number of documents of the term by the document counts of its keywords
+// Terms starting with wildcards are expanded to their keywords, it fails if the term matches too many keywords
+func (q *SimpleContentSearchEngineTerm) plan(workspaceId string, maxKeywords int) error {
+	q.estimate = 0
+
+	switch {
+	case q.Suffix != "":
+		keywords := []string{}
+		fulltext.ScanReversedKeywords(workspaceId, q.Suffix, func(keyword string) bool {
+			keywords = append(keywords, keyword)
+			return len(keywords) <= maxKeywords
+		})
+		if len(keywords) > maxKeywords {
+			return &errTooManyKeywords{q.Pattern, maxKeywords}
+		}
+		sort.Strings(keywords)
+		q.Expansions = keywords
+
+	case q.Infix != "":
+		// Keywords containing the infix could be anywhere in the index, so all keywords are scanned
+		// A keyword may be stored in multiple rows, they are in order, so it's only compared to the last one
+		keywords := []string{}
+		fulltext.ScanKeywords(workspaceId, "", func(keyword string, _ int) bool {
+			if strings.Contains(keyword, q.Infix) && (len(keywords) == 0 || keywords[len(keywords)-1] != keyword) {
+				keywords = append(keywords, keyword)
+			}
+			return len(keywords) <= maxKeywords
+		})
+		if len(keywords) > maxKeywords {
+			return &errTooManyKeywords{q.Pattern, maxKeywords}
+		}
+		sort.Strings(keywords)
+		q.Expansions = keywords
+
+	case q.Expansions == nil:
+		// A keyword may be stored in multiple rows, so keywords are counted when they change
+		count, last := 0, ""
+		for _, prefix := range q.prefixes() {
+			fulltext.ScanKeywords(workspaceId, prefix, func(keyword string, doccount int) bool {
+				if keyword != last {
+					last = keyword
+					count++
+				}
+				q.estimate += doccount
+				return count <= maxKeywords
+			})
+		}
+		if count > maxKeywords {
+			return &errTooManyKeywords{q.Pattern, maxKeywords}
+		}
+		return nil
+	}
+
+	for _, keyword := range q.Expansions {
+		fulltext.ScanKeywords(workspaceId, keyword+"|", func(_ string, doccount int) bool {
+			q.estimate += doccount
+			return true
+		})
+	}
+
+	return nil
+}
+
+// intersect returns the documents of candidates containing the term
+// The documents of the term are streamed, it stops once all candidates are found
+func (q *SimpleContentSearchEngineTerm) intersect(workspaceId string,
+	candidates map[string]struct{}) map[string]struct{} {
+	found := make(map[string]struct{})
+	q.ScanDocuments(workspaceId, func(docid string) bool {
+		if _, ok := candidates[docid]; ok {
+			found[docid] = struct{}{}
+		}
+		return len(found) < len(candidates)
+	})
+
+	log.Printf("CollectDocuments: |--`%s` kept %d of %d documents", q.String(), len(found), len(candidates))
+	return found
+}
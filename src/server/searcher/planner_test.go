@@ -0,0 +1,191 @@
+package searcher
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+)
+
+func TestWildcardLiterals(t *testing.T) {
+	tests := []struct {
+		pattern string
+		suffix  string
+		infix   string
+	}{
+		{"*Handler", "handler", ""},
+		{"?andler", "andler", ""},
+		{"*Request*Handler", "handler", ""},
+		{"*Handler*", "", "handler"},
+		{"*foo.bar", "", "foo"},
+		{"*a", "", ""},
+		{"Handler*", "", ""},
+	}
+
+	for _, tt := range tests {
+		suffix, infix := wildcardLiterals(tt.pattern)
+		if suffix != tt.suffix || infix != tt.infix {
+			t.Errorf("wildcardLiterals(%q) got (%q, %q), want (%q, %q)",
+				tt.pattern, suffix, infix, tt.suffix, tt.infix)
+		}
+	}
+}
+
+func TestCompileLeadingWildcard(t *testing.T) {
+	engine := &SimpleContentSearchEngine{}
+	if err := engine.Compile("*Handler", false); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	term := engine.OrClauses[0].AndTerms[0]
+	if term.Prefix != "" || term.Suffix != "handler" {
+		t.Errorf("Compile() got prefix %q and suffix %q", term.Prefix, term.Suffix)
+	}
+
+	tests := []struct {
+		line string
+		want [][]int
+	}{
+		{"h := requestHandler{}", [][]int{{5, 19}}},
+		{"Handler", [][]int{{0, 7}}},
+		{"x.ErrorHandler(y)", [][]int{{2, 14}}},
+		// The suffix ends a keyword
+		{"NewHandlerFactory()", [][]int{}},
+	}
+
+	for _, tt := range tests {
+		if got := engine.IsLineMatch(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("IsLineMatch(%q) got %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestPlanTerms(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "haystack-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	conf.Get().Global.DataPath = tempDir
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer fulltext.CloseAndWait()
+
+	err = fulltext.SaveNewDocuments("1", []*fulltext.Document{
+		{ID: "doc1", RelPath: "a.go", Words: []string{"handler", "requesthandler", "rare"}},
+		{ID: "doc2", RelPath: "b.go", Words: []string{"handler", "errorhandler", "getconfig"}},
+		{ID: "doc3", RelPath: "c.go", Words: []string{"handler", "getvalue", "configs"}},
+	})
+	if err != nil {
+		t.Fatalf("SaveNewDocuments failed: %v", err)
+	}
+
+	// Keywords are flushed to the index in the background
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		found := false
+		fulltext.ScanKeywords("1", "rare|", func(string, int) bool {
+			found = true
+			return false
+		})
+		if found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Keywords are not flushed to the index")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	var compile = func(query string) *SimpleContentSearchEngine {
+		engine := NewSimpleContentSearchEngine(&workspace.Workspace{ID: "1"})
+		if err := engine.Compile(query, false); err != nil {
+			t.Fatalf("Compile(%q) error = %v", query, err)
+		}
+		return engine
+	}
+
+	var patterns = func(terms []*SimpleContentSearchEngineTerm) []string {
+		result := []string{}
+		for _, term := range terms {
+			result = append(result, term.Pattern)
+		}
+		return result
+	}
+
+	// The rarest term is intersected first
+	engine := compile("handler rare")
+	result, err := engine.CollectDocuments()
+	if err != nil {
+		t.Fatalf("CollectDocuments() error = %v", err)
+	}
+	clause := engine.OrClauses[0]
+	if got := patterns(clause.plan); !reflect.DeepEqual(got, []string{"rare", "handler"}) {
+		t.Errorf("plan got %v", got)
+	}
+	if clause.AndTerms[0].estimate != 3 || clause.AndTerms[1].estimate != 1 {
+		t.Errorf("estimates got %d, %d", clause.AndTerms[0].estimate, clause.AndTerms[1].estimate)
+	}
+	if !reflect.DeepEqual(result.DocIds, map[string]struct{}{"doc1": {}}) {
+		t.Errorf("CollectDocuments() got %v", result.DocIds)
+	}
+
+	// Suffix terms are looked up in the reversed keyword index, infix terms in all keywords
+	for query, want := range map[string][]string{
+		"*Handler":  {"errorhandler", "handler", "requesthandler"},
+		"*config*":  {"configs", "getconfig"},
+		"*missing":  {},
+		"*nfigs":    {"configs"},
+		"*Value":    {"getvalue"},
+		"*est*dler": {"errorhandler", "handler", "requesthandler"},
+	} {
+		engine := compile(query)
+		if _, err := engine.CollectDocuments(); err != nil {
+			t.Fatalf("CollectDocuments(%q) error = %v", query, err)
+		}
+		if got := engine.OrClauses[0].AndTerms[0].Expansions; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expansions of %q got %v, want %v", query, got, want)
+		}
+	}
+
+	// Infix terms scan the keywords of the index without building the keyword dictionary
+	keywordDictionariesMutex.Lock()
+	_, built := keywordDictionaries["1"]
+	keywordDictionariesMutex.Unlock()
+	if built {
+		t.Error("expected infix terms not to build the keyword dictionary")
+	}
+	_, _, err = planTerms("1", compile("*dle*").OrClauses[0].AndTerms, 2)
+	if !errors.As(err, new(*errTooManyKeywords)) {
+		t.Errorf("planTerms() got error %v, want too many keywords of the infix", err)
+	}
+
+	// A term matching too many keywords is skipped if there are other terms, otherwise it's an error
+	terms := compile("get rare").OrClauses[0].AndTerms
+	plan, warnings, err := planTerms("1", terms, 1)
+	if err != nil || len(warnings) != 1 || !reflect.DeepEqual(patterns(plan), []string{"rare"}) || !terms[0].skipped {
+		t.Errorf("planTerms() got plan %v, warnings %v, error %v", patterns(plan), warnings, err)
+	}
+
+	terms = compile("get").OrClauses[0].AndTerms
+	_, _, err = planTerms("1", terms, 1)
+	var tooMany *errTooManyKeywords
+	if !errors.As(err, &tooMany) {
+		t.Errorf("planTerms() got error %v, want too many keywords", err)
+	}
+
+	engine = compile("get | rare")
+	conf.Get().Server.Search.MaxKeywordExpansions = 1
+	defer func() { conf.Get().Server.Search.MaxKeywordExpansions = conf.DefaultMaxSearchKeywordExpansions }()
+	result, err = engine.CollectDocuments()
+	if err != nil || len(result.DocIds) != 1 || len(engine.Warnings()) != 1 {
+		t.Errorf("CollectDocuments() got %v, warnings %v, error %v", result.DocIds, engine.Warnings(), err)
+	}
+}
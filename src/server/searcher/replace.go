@@ -0,0 +1,323 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// diffContextLines is the number of unchanged lines around the changes of a diff hunk
+const diffContextLines = 3
+
+// replacer replaces the matches of the term of a query in the files of a workspace
+type replacer struct {
+	workspace   *workspace.Workspace
+	term        *SimpleContentSearchEngineTerm
+	replacement string
+}
+
+// newReplacer compiles the query of the request for the workspace
+// Only a query with a single term could be replaced, as a replacement could not tell which term it refers to.
+// Lines are rewritten by the term alone, so scopes, NEAR and variants, which the search would match by, are rejected.
+func newReplacer(workspace *workspace.Workspace, req *types.ReplaceRequest) (*replacer, error) {
+	if req.Scope != nil {
+		return nil, errors.New("replace doesn't support a search scope")
+	}
+	if req.Variants {
+		return nil, errors.New("replace doesn't support variants, replace each spelling of the term instead")
+	}
+
+	engine := NewSimpleContentSearchEngine(workspace)
+	engine.CaptureWildcards = true
+	if req.Fuzzy != nil {
+		engine.Fuzzy = true
+		engine.FuzzyDistance = req.Fuzzy.Distance
+	}
+	if err := engine.Compile(req.Query, !req.IgnoreCase); err != nil {
+		return nil, err
+	}
+
+	if engine.Scope != "" {
+		return nil, errors.New("replace doesn't support scope directives, e.g. @line or @file")
+	}
+	for _, orClause := range engine.OrClauses {
+		if len(orClause.Near) > 0 {
+			return nil, errors.New("replace doesn't support NEAR")
+		}
+	}
+	if len(engine.OrClauses) != 1 || len(engine.OrClauses[0].AndTerms) != 1 {
+		return nil, errors.New("replace requires a query with a single term")
+	}
+
+	return &replacer{
+		workspace:   workspace,
+		term:        engine.OrClauses[0].AndTerms[0],
+		replacement: req.Replacement,
+	}, nil
+}
+
+// replaceLine replaces all matches of the term in a line, it returns the new line and the number of replacements
+func (r *replacer) replaceLine(line string) (string, int) {
+	matches := r.term.Regex.FindAllStringSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return line, 0
+	}
+
+	result := []byte{}
+	last := 0
+	for _, match := range matches {
+		// match[4:6] is the term, the wildcards of the term follow it, so they are $0, $1, $2... of the replacement
+		result = append(result, line[last:match[4]]...)
+		result = r.term.Regex.ExpandString(result, r.replacement, line, match[4:])
+		last = match[5]
+	}
+	result = append(result, line[last:]...)
+
+	return string(result), len(matches)
+}
+
+// replaceFile replaces the matches of the term in a file
+// It returns the replacement of the file with the hash of its current content, and the new content
+func (r *replacer) replaceFile(relPath string, withDiff bool) (types.ReplaceFile, []byte, error) {
+	file := types.ReplaceFile{
+		Workspace: r.workspace.Path,
+		File:      relPath,
+	}
+
+	content, err := os.ReadFile(filepath.Join(r.workspace.Path, relPath))
+	if err != nil {
+		return file, nil, err
+	}
+	file.Hash = indexer.GetContentHash(content)
+
+	lines := strings.Split(string(content), "\n")
+	newLines := make([]string, len(lines))
+	for i, line := range lines {
+		var n int
+		newLines[i], n = r.replaceLine(line)
+		file.Replacements += n
+	}
+
+	if withDiff && file.Replacements > 0 {
+		// The empty string after the last line break is not a line
+		diffLines, diffNewLines := lines, newLines
+		if len(lines) > 0 && lines[len(lines)-1] == "" {
+			diffLines, diffNewLines = lines[:len(lines)-1], newLines[:len(lines)-1]
+		}
+		file.Diff = unifiedDiff(filepath.ToSlash(relPath), diffLines, diffNewLines)
+	}
+
+	return file, []byte(strings.Join(newLines, "\n")), nil
+}
+
+// newReplacers creates the replacers of the workspaces, keyed by the workspace path
+func newReplacers(workspaces []*workspace.Workspace, req *types.ReplaceRequest) (map[string]*replacer, error) {
+	replacers := map[string]*replacer{}
+	for _, ws := range workspaces {
+		r, err := newReplacer(ws, req)
+		if err != nil {
+			return nil, err
+		}
+		replacers[ws.Path] = r
+	}
+
+	return replacers, nil
+}
+
+// PreviewReplace searches the query and returns the unified diffs of replacing its matches in the matched files
+// Files are not changed, the hashes of the previews should be passed to ApplyReplace to rewrite them
+func PreviewReplace(ctx context.Context, workspaces []*workspace.Workspace,
+	req *types.ReplaceRequest) (*types.ReplacePreviewResult, error) {
+	replacers, err := newReplacers(workspaces, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files are searched as the term is replaced
+	search := req.SearchContentRequest
+	search.CaseSensitive = !req.IgnoreCase
+	results := SearchContent(ctx, workspaces, &search)
+	preview := &types.ReplacePreviewResult{
+		Files:    []types.ReplaceFile{},
+		Truncate: results.Truncate,
+	}
+
+	for _, result := range results.Results {
+		// Unsaved buffers are edited by their editors, the files on disk are not what's matched
+		r := replacers[result.Workspace]
+		if r == nil || result.Overlay {
+			continue
+		}
+
+		file, _, err := r.replaceFile(result.File, true)
+		if err != nil {
+			log.Printf("Failed to preview the replacement of `%s`: %v", result.File, err)
+			continue
+		}
+
+		// Matches of other scopes, e.g. across lines, are not replaced
+		if file.Replacements == 0 {
+			continue
+		}
+
+		preview.Files = append(preview.Files, file)
+		preview.TotalReplacements += file.Replacements
+	}
+
+	return preview, nil
+}
+
+// ApplyReplace rewrites the files of a preview and re-indexes them
+// A file is only rewritten if its content still matches the hash of the preview, otherwise it's a conflict
+func ApplyReplace(workspaces []*workspace.Workspace, req *types.ReplaceApplyRequest) (*types.ReplaceApplyResult, error) {
+	replacers, err := newReplacers(workspaces, &req.ReplaceRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.ReplaceApplyResult{
+		Files: []types.ReplaceFile{},
+	}
+
+	for _, previewed := range req.Files {
+		file, err := applyReplaceFile(replacers[previewed.Workspace], previewed)
+		if err != nil {
+			previewed.Error = err.Error()
+			previewed.Diff = ""
+			result.Conflicts = append(result.Conflicts, previewed)
+			continue
+		}
+
+		result.Files = append(result.Files, file)
+		result.TotalReplacements += file.Replacements
+	}
+
+	return result, nil
+}
+
+// applyReplaceFile rewrites a file of the preview
+func applyReplaceFile(r *replacer, previewed types.ReplaceFile) (types.ReplaceFile, error) {
+	if r == nil {
+		return previewed, fmt.Errorf("workspace is not in the request: %s", previewed.Workspace)
+	}
+
+	// Only indexed files could be rewritten, and they must still be in the workspace
+	relPath, err := r.workspace.ResolveFilePath(previewed.File)
+	if err != nil {
+		return previewed, err
+	}
+	previewed.File = relPath
+
+	fullPath := filepath.Join(r.workspace.Path, relPath)
+	doc, err := fulltext.GetDocument(r.workspace.ID, indexer.GetDocumentId(fullPath), false)
+	if err != nil {
+		return previewed, err
+	}
+	if doc == nil {
+		return previewed, fmt.Errorf("file is not indexed: %s", previewed.File)
+	}
+
+	stat, err := os.Stat(fullPath)
+	if err != nil {
+		return previewed, err
+	}
+
+	file, content, err := r.replaceFile(previewed.File, false)
+	if err != nil {
+		return previewed, err
+	}
+
+	if file.Hash != previewed.Hash {
+		return previewed, errors.New("file is changed since the preview")
+	}
+
+	if file.Replacements == 0 {
+		return previewed, errors.New("nothing to replace")
+	}
+
+	if err := os.WriteFile(fullPath, content, stat.Mode().Perm()); err != nil {
+		return previewed, err
+	}
+
+	if err := indexer.AddOrSyncFile(r.workspace, previewed.File); err != nil {
+		log.Printf("Failed to re-index `%s` in workspace `%s`: %v", previewed.File, r.workspace.Path, err)
+	}
+
+	log.Printf("Replaced %d matches in `%s` of workspace `%s`", file.Replacements, previewed.File, r.workspace.Path)
+	return file, nil
+}
+
+// unifiedDiff returns the unified diff of a file whose lines are replaced one by one
+// newLines[i] is the replacement of oldLines[i], it may contain line breaks
+func unifiedDiff(file string, oldLines []string, newLines []string) string {
+	changed := []int{}
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			changed = append(changed, i)
+		}
+	}
+
+	if len(changed) == 0 {
+		return ""
+	}
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- a/%s\n+++ b/%s\n", file, file)
+
+	// offset is the number of lines added to the new file by the previous hunks
+	offset := 0
+	for i := 0; i < len(changed); {
+		// Changes whose context lines overlap are in the same hunk
+		j := i
+		for j+1 < len(changed) && changed[j+1]-changed[j] <= 2*diffContextLines+1 {
+			j++
+		}
+
+		start := max(changed[i]-diffContextLines, 0)
+		end := min(changed[j]+diffContextLines+1, len(oldLines))
+
+		hunk := []string{}
+		oldCount, newCount := 0, 0
+		for k := start; k < end; {
+			if oldLines[k] == newLines[k] {
+				hunk = append(hunk, " "+oldLines[k])
+				oldCount++
+				newCount++
+				k++
+				continue
+			}
+
+			// Consecutive changed lines are removed together, then added together
+			added := []string{}
+			for ; k < end && oldLines[k] != newLines[k]; k++ {
+				hunk = append(hunk, "-"+oldLines[k])
+				oldCount++
+				for _, line := range strings.Split(newLines[k], "\n") {
+					added = append(added, "+"+line)
+					newCount++
+				}
+			}
+			hunk = append(hunk, added...)
+		}
+
+		fmt.Fprintf(&diff, "@@ -%d,%d +%d,%d @@\n", start+1, oldCount, start+1+offset, newCount)
+		for _, line := range hunk {
+			diff.WriteString(line)
+			diff.WriteString("\n")
+		}
+
+		offset += newCount - oldCount
+		i = j + 1
+	}
+
+	return diff.String()
+}
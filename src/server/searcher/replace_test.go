@@ -0,0 +1,169 @@
+package searcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestReplaceLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		ignoreCase  bool
+		replacement string
+		line        string
+		want        string
+		wantCount   int
+	}{
+		{
+			name:        "plain term",
+			query:       "oldName",
+			replacement: "newName",
+			line:        "x := oldName(oldName)",
+			want:        "x := newName(newName)",
+			wantCount:   2,
+		},
+		{
+			name:        "whole term",
+			query:       "Mutex",
+			replacement: "sync.$0",
+			line:        "var mu Mutex",
+			want:        "var mu sync.Mutex",
+			wantCount:   1,
+		},
+		{
+			name:        "wildcard groups",
+			query:       "get*Config",
+			replacement: "load${1}Config",
+			line:        "cfg := getServerConfig() + getConfig()",
+			want:        "cfg := loadServerConfig() + loadConfig()",
+			wantCount:   2,
+		},
+		{
+			name:        "case sensitive by default",
+			query:       "foo",
+			replacement: "bar",
+			line:        "foo(); FOO; Foo",
+			want:        "bar(); FOO; Foo",
+			wantCount:   1,
+		},
+		{
+			name:        "ignore case",
+			query:       "Lock",
+			ignoreCase:  true,
+			replacement: "Acquire",
+			line:        "mu.Lock(); lock()",
+			want:        "mu.Acquire(); Acquire()",
+			wantCount:   2,
+		},
+		{
+			name:        "prefix of longer identifiers",
+			query:       "foo",
+			replacement: "bar",
+			line:        "foo(); foobar := food; foo_bar; foo",
+			want:        "bar(); foobar := food; foo_bar; bar",
+			wantCount:   2,
+		},
+		{
+			name:        "wildcard ends a word",
+			query:       "get*",
+			replacement: "load${1}",
+			line:        "getServerConfig(); get",
+			want:        "loadServerConfig(); load",
+			wantCount:   2,
+		},
+		{
+			name:        "not at the start of a word",
+			query:       "name",
+			replacement: "title",
+			line:        "rename(name)",
+			want:        "rename(title)",
+			wantCount:   1,
+		},
+		{
+			name:        "no match",
+			query:       "missing",
+			replacement: "found",
+			line:        "nothing here",
+			want:        "nothing here",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newReplacer(&workspace.Workspace{}, &types.ReplaceRequest{
+				SearchContentRequest: types.SearchContentRequest{Query: tt.query},
+				Replacement:          tt.replacement,
+				IgnoreCase:           tt.ignoreCase,
+			})
+			if err != nil {
+				t.Fatalf("newReplacer() error = %v", err)
+			}
+
+			got, count := r.replaceLine(tt.line)
+			if got != tt.want || count != tt.wantCount {
+				t.Errorf("replaceLine() got (%q, %d), want (%q, %d)", got, count, tt.want, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestNewReplacerRequiresSingleTerm(t *testing.T) {
+	for _, query := range []string{"foo bar", "foo | bar"} {
+		_, err := newReplacer(&workspace.Workspace{}, &types.ReplaceRequest{
+			SearchContentRequest: types.SearchContentRequest{Query: query},
+		})
+		if err == nil {
+			t.Errorf("newReplacer(%q) expected an error", query)
+		}
+	}
+}
+
+func TestNewReplacerRejectsSearchOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		req  types.SearchContentRequest
+		want string
+	}{
+		{"scope", types.SearchContentRequest{Query: "foo", Scope: &types.SearchScope{Type: types.SearchScopeFile}},
+			"scope"},
+		{"scope directive", types.SearchContentRequest{Query: "foo @window:3"}, "scope directives"},
+		{"near", types.SearchContentRequest{Query: "foo NEAR/3 bar"}, "NEAR"},
+		{"variants", types.SearchContentRequest{Query: "tab_group", Variants: true}, "variants"},
+	}
+
+	for _, tt := range tests {
+		_, err := newReplacer(&workspace.Workspace{}, &types.ReplaceRequest{SearchContentRequest: tt.req})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want the error of %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldLines := []string{"a", "foo", "foo", "b", "c", "d", "e", "f", "g", "h", "i", "j", "foo"}
+	newLines := []string{"a", "bar", "bar", "b", "c", "d", "e", "f", "g", "h", "i", "j", "bar\nbaz"}
+
+	want := "--- a/x.go\n+++ b/x.go\n" +
+		"@@ -1,6 +1,6 @@\n a\n-foo\n-foo\n+bar\n+bar\n b\n c\n d\n" +
+		"@@ -10,4 +10,5 @@\n h\n i\n j\n-foo\n+bar\n+baz\n"
+	if got := unifiedDiff("x.go", oldLines, newLines); got != want {
+		t.Errorf("unifiedDiff() got\n%s\nwant\n%s", got, want)
+	}
+
+	// Hunks are merged once their context lines are adjacent
+	oldLines = []string{"foo", "a", "b", "c", "d", "e", "f", "foo"}
+	newLines = []string{"bar", "a", "b", "c", "d", "e", "f", "bar"}
+	want = "--- a/x.go\n+++ b/x.go\n" +
+		"@@ -1,8 +1,8 @@\n-foo\n+bar\n a\n b\n c\n d\n e\n f\n-foo\n+bar\n"
+	if got := unifiedDiff("x.go", oldLines, newLines); got != want {
+		t.Errorf("unifiedDiff() got\n%s\nwant\n%s", got, want)
+	}
+
+	if got := unifiedDiff("x.go", []string{"a"}, []string{"a"}); got != "" {
+		t.Errorf("unifiedDiff() got %q for unchanged lines, want empty", got)
+	}
+}
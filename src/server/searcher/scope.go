@@ -0,0 +1,261 @@
+package searcher
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/codetrek/haystack/shared/types"
+)
+
+var reWord = regexp.MustCompile(`[a-zA-Z0-9_]+`)
+
+// TermHit is a hit of a single term of an AND clause
+type TermHit struct {
+	Term  int // index of the term in AndTerms
+	Line  int // 0-based line index
+	Start int // byte offset of the hit in the line
+	End   int // byte offset of the hit end in the line, exclusive
+	Word  int // index of the first word of the hit in the file, only set if the clause has NEAR constraints
+}
+
+// IsScoped returns true if the terms are matched separately instead of in order within a line
+// That's the case for the window and file scopes, and for any query using NEAR/n
+func (q *SimpleContentSearchEngine) IsScoped() bool {
+	if q.Scope == types.SearchScopeWindow || q.Scope == types.SearchScopeFile {
+		return true
+	}
+
+	for _, orClause := range q.OrClauses {
+		if len(orClause.Near) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchScoped matches all lines of a file, all terms of an AND clause must co-occur in the scope of the engine
+// returns the clause and the hits of each term of the first matching OR clause, sorted by position
+func (q *SimpleContentSearchEngine) MatchScoped(lines []string) (*SimpleContentSearchEngineAndClause, []TermHit) {
+	var wordStarts [][]int
+	var wordBase []int
+
+	for _, orClause := range q.OrClauses {
+		if len(orClause.Near) > 0 && wordStarts == nil {
+			wordStarts, wordBase = indexWords(lines)
+		}
+
+		hits := orClause.matchScoped(lines, q.Scope, q.Window, wordStarts, wordBase)
+		if len(hits) > 0 {
+			return orClause, hits
+		}
+	}
+
+	return nil, []TermHit{}
+}
+
+func (q *SimpleContentSearchEngineAndClause) matchScoped(lines []string, scope string, window int,
+	wordStarts [][]int, wordBase []int) []TermHit {
+	if len(q.AndTerms) == 0 {
+		return nil
+	}
+
+	// Collect the hits of each term
+	termHits := make([][]TermHit, len(q.AndTerms))
+	for i, term := range q.AndTerms {
+		if term.Regex == nil {
+			return nil
+		}
+
+		for lineIdx, line := range lines {
+			for _, match := range term.Regex.FindAllStringSubmatchIndex(line, -1) {
+				hit := TermHit{
+					Term:  i,
+					Line:  lineIdx,
+					Start: match[4],
+					End:   match[5],
+				}
+				if wordStarts != nil {
+					hit.Word = wordBase[lineIdx] + sort.SearchInts(wordStarts[lineIdx], hit.Start)
+				}
+				termHits[i] = append(termHits[i], hit)
+			}
+		}
+
+		if len(termHits[i]) == 0 {
+			return nil
+		}
+	}
+
+	// Only keep the hits having a hit of the other term nearby
+	sameLine := scope == "" || scope == types.SearchScopeLine
+	for _, near := range q.Near {
+		left := keepNear(termHits[near.Left], termHits[near.Right], near.Distance, sameLine)
+		right := keepNear(termHits[near.Right], termHits[near.Left], near.Distance, sameLine)
+		termHits[near.Left], termHits[near.Right] = left, right
+	}
+
+	var covered func(line int) bool
+	switch scope {
+	case types.SearchScopeFile:
+		for _, hits := range termHits {
+			if len(hits) == 0 {
+				return nil
+			}
+		}
+		covered = func(int) bool { return true }
+	case types.SearchScopeWindow:
+		covered = coveredByWindows(termHits, len(lines), window)
+	default:
+		covered = coveredByWindows(termHits, len(lines), 1)
+	}
+
+	result := []TermHit{}
+	for _, hits := range termHits {
+		for _, hit := range hits {
+			if covered(hit.Line) {
+				result = append(result, hit)
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Line != result[j].Line {
+			return result[i].Line < result[j].Line
+		}
+		if result[i].Start != result[j].Start {
+			return result[i].Start < result[j].Start
+		}
+		return result[i].Term < result[j].Term
+	})
+
+	return result
+}
+
+// keepNear returns the hits having a hit of others at most distance words apart
+func keepNear(hits []TermHit, others []TermHit, distance int, sameLine bool) []TermHit {
+	result := []TermHit{}
+	for _, hit := range hits {
+		for _, other := range others {
+			if sameLine && hit.Line != other.Line {
+				continue
+			}
+
+			apart := hit.Word - other.Word
+			if apart < 0 {
+				apart = -apart
+			}
+
+			// apart-1 words between the two hits
+			if apart-1 <= distance {
+				result = append(result, hit)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// coveredByWindows returns a function telling if a line is in a window of `window` lines containing all terms
+func coveredByWindows(termHits [][]TermHit, totalLines int, window int) func(line int) bool {
+	if window <= 0 {
+		window = 1
+	}
+
+	// The terms present in each line
+	lineTerms := map[int]map[int]struct{}{}
+	for term, hits := range termHits {
+		for _, hit := range hits {
+			if lineTerms[hit.Line] == nil {
+				lineTerms[hit.Line] = map[int]struct{}{}
+			}
+			lineTerms[hit.Line][term] = struct{}{}
+		}
+	}
+
+	counts := make([]int, len(termHits))
+	present := 0
+	var add = func(line int, delta int) {
+		for term := range lineTerms[line] {
+			if counts[term] == 0 && delta > 0 {
+				present++
+			}
+			counts[term] += delta
+			if counts[term] == 0 && delta < 0 {
+				present--
+			}
+		}
+	}
+
+	covered := map[int]struct{}{}
+	lastCovered := -1
+	for end := 0; end < totalLines; end++ {
+		add(end, 1)
+		start := end - window + 1
+		if start > 0 {
+			add(start-1, -1)
+		}
+
+		if present == len(termHits) {
+			for line := max(start, lastCovered+1, 0); line <= end; line++ {
+				covered[line] = struct{}{}
+			}
+			lastCovered = end
+		}
+	}
+
+	return func(line int) bool {
+		_, ok := covered[line]
+		return ok
+	}
+}
+
+// indexWords returns the byte offsets of the words in each line
+// and the number of words before each line, used to measure the distance of NEAR/n in words
+func indexWords(lines []string) ([][]int, []int) {
+	starts := make([][]int, len(lines))
+	base := make([]int, len(lines))
+
+	total := 0
+	for i, line := range lines {
+		base[i] = total
+		for _, word := range reWord.FindAllStringIndex(line, -1) {
+			starts[i] = append(starts[i], word[0])
+		}
+		total += len(starts[i])
+	}
+
+	return starts, base
+}
+
+// matchContentScoped matches the whole content of a file within the scope of the engine
+// acceptHit is called for each hit, the matching stops once it returns false or maxPerFile is reached
+// returns the matches, the lines of the content and whether the matches are truncated by maxPerFile or acceptHit
+func matchContentScoped(engine *SimpleContentSearchEngine, content string, maxPerFile int,
+	acceptHit func() bool) ([]types.LineMatch, []string, bool) {
+	lines, _ := splitLines(content)
+	matches := []types.LineMatch{}
+
+	clause, hits := engine.MatchScoped(lines)
+	for _, hit := range hits {
+		if !acceptHit() {
+			return matches, lines, true
+		}
+
+		matches = append(matches, types.LineMatch{
+			Line: types.SearchContentLine{
+				LineNumber: hit.Line + 1,
+				Content:    lines[hit.Line],
+				Match:      []int{hit.Start, hit.End},
+			},
+			Term: clause.AndTerms[hit.Term].Pattern,
+		})
+
+		if len(matches) >= maxPerFile {
+			return matches, lines, true
+		}
+	}
+
+	return matches, lines, false
+}
@@ -0,0 +1,181 @@
+package searcher
+
+import (
+	"testing"
+
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestCompileScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		scope      string
+		wantScope  string
+		wantWindow int
+		wantNear   int
+		wantErr    bool
+	}{
+		{
+			name:      "default scope",
+			query:     "Mutex Unlock",
+			wantScope: "",
+		},
+		{
+			name:      "file directive",
+			query:     "@file Mutex Unlock",
+			wantScope: types.SearchScopeFile,
+		},
+		{
+			name:       "window directive",
+			query:      "Mutex @window:5 Unlock",
+			wantScope:  types.SearchScopeWindow,
+			wantWindow: 5,
+		},
+		{
+			name:      "directive overrides the request scope",
+			query:     "@line Mutex Unlock",
+			scope:     types.SearchScopeFile,
+			wantScope: types.SearchScopeLine,
+		},
+		{
+			name:     "near",
+			query:    "Mutex NEAR/3 Unlock",
+			wantNear: 1,
+		},
+		{
+			name:    "near without right term",
+			query:   "Mutex NEAR/3",
+			wantErr: true,
+		},
+		{
+			name:    "near without left term",
+			query:   "NEAR/3 Mutex",
+			wantErr: true,
+		},
+		{
+			name:    "unknown scope",
+			query:   "Mutex",
+			scope:   "page",
+			wantErr: true,
+		},
+		{
+			name:    "window without lines",
+			query:   "Mutex",
+			scope:   types.SearchScopeWindow,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &SimpleContentSearchEngine{Scope: tt.scope}
+			err := engine.Compile(tt.query, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if engine.Scope != tt.wantScope {
+				t.Errorf("scope got %q, want %q", engine.Scope, tt.wantScope)
+			}
+			if engine.Window != tt.wantWindow {
+				t.Errorf("window got %d, want %d", engine.Window, tt.wantWindow)
+			}
+			if len(engine.OrClauses[0].Near) != tt.wantNear {
+				t.Errorf("got %d NEAR constraints, want %d", len(engine.OrClauses[0].Near), tt.wantNear)
+			}
+			if len(engine.OrClauses[0].AndTerms) != 2 && tt.query != "Mutex" {
+				t.Errorf("got %d terms, want 2", len(engine.OrClauses[0].AndTerms))
+			}
+		})
+	}
+}
+
+func TestMatchContentScoped(t *testing.T) {
+	content := "var mu sync.Mutex\n\nfunc update() {\n\tmu.Lock()\n\tdefer mu.Unlock()\n}\n"
+
+	tests := []struct {
+		name      string
+		query     string
+		wantLines []int
+		wantTerms []string
+	}{
+		{
+			name:      "file scope",
+			query:     "@file Mutex Unlock",
+			wantLines: []int{1, 5},
+			wantTerms: []string{"Mutex", "Unlock"},
+		},
+		{
+			name:      "terms in reverse order",
+			query:     "@file Unlock Mutex",
+			wantLines: []int{1, 5},
+			wantTerms: []string{"Mutex", "Unlock"},
+		},
+		{
+			name:      "missing term",
+			query:     "@file Mutex RLock",
+			wantLines: []int{},
+		},
+		{
+			name:      "window is too small",
+			query:     "@window:4 Mutex Unlock",
+			wantLines: []int{},
+		},
+		{
+			name:      "window is large enough",
+			query:     "@window:5 Mutex Unlock",
+			wantLines: []int{1, 5},
+			wantTerms: []string{"Mutex", "Unlock"},
+		},
+		{
+			name:      "near in line scope",
+			query:     "Unlock NEAR/1 defer",
+			wantLines: []int{5, 5},
+			wantTerms: []string{"defer", "Unlock"},
+		},
+		{
+			name:      "near is too far",
+			query:     "Unlock NEAR/0 defer",
+			wantLines: []int{},
+		},
+		{
+			name:      "near across lines in file scope",
+			query:     "@file Lock NEAR/1 defer",
+			wantLines: []int{4, 5},
+			wantTerms: []string{"Lock", "defer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &SimpleContentSearchEngine{}
+			if err := engine.Compile(tt.query, false); err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			if !engine.IsScoped() {
+				t.Fatal("IsScoped() got false, want true")
+			}
+
+			matches, _, _ := matchContentScoped(engine, content, 100, func() bool { return true })
+			if len(matches) != len(tt.wantLines) {
+				t.Fatalf("got %d matches, want %d", len(matches), len(tt.wantLines))
+			}
+			for i, match := range matches {
+				if match.Line.LineNumber != tt.wantLines[i] {
+					t.Errorf("match %d: line got %d, want %d", i, match.Line.LineNumber, tt.wantLines[i])
+				}
+				if match.Term != tt.wantTerms[i] {
+					t.Errorf("match %d: term got %q, want %q", i, match.Term, tt.wantTerms[i])
+				}
+				hit := match.Line.Content[match.Line.Match[0]:match.Line.Match[1]]
+				if hit != match.Term {
+					t.Errorf("match %d: hit got %q, want %q", i, hit, match.Term)
+				}
+			}
+		})
+	}
+}
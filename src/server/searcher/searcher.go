@@ -2,12 +2,18 @@ package searcher
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/codetrek/haystack/conf"
@@ -24,6 +30,17 @@ import (
 func Run(wg *sync.WaitGroup) {
 	log.Println("Starting searcher...")
 
+	// Cached results are invalidated once the documents of their workspaces change
+	fulltext.OnWorkspaceChanged(resultCache.invalidate)
+	// Keyword dictionaries of fuzzy terms are built again once their workspaces change or are deleted
+	fulltext.OnWorkspaceChanged(invalidateKeywordDictionary)
+	// Limits, timeouts and workers are read by every search, but the cached results are of the old ones
+	conf.OnReload(func(old, new *conf.Conf) {
+		if !reflect.DeepEqual(new.Server.Search, old.Server.Search) {
+			resultCache.clear()
+		}
+	})
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -38,15 +55,77 @@ type QueryFilters struct {
 	Exclude *utils.SimpleFilter
 }
 
-// SearchContent searches the content of the workspace
+// SearchContent searches the content of the workspaces
 // query is a list of words to search for
-// returns a list of results
-func SearchContent(workspace *workspace.Workspace, req *types.SearchContentRequest) ([]types.SearchContentResult, bool) {
-	startTime := time.Now()
-	var isTimeout = func() bool {
-		return time.Since(startTime) > 10*time.Second
+// returns a list of results, ranked by the number of hits, then by workspace and file
+func SearchContent(ctx context.Context, workspaces []*workspace.Workspace,
+	req *types.SearchContentRequest) types.SearchContentResults {
+	finalResults := []types.SearchContentResult{}
+	summary := SearchContentStream(ctx, workspaces, req, func(result types.SearchContentResult) bool {
+		finalResults = append(finalResults, result)
+		return true
+	})
+
+	sort.SliceStable(finalResults, func(i, j int) bool {
+		if len(finalResults[i].Lines) != len(finalResults[j].Lines) {
+			return len(finalResults[i].Lines) > len(finalResults[j].Lines)
+		}
+		if finalResults[i].Workspace != finalResults[j].Workspace {
+			return finalResults[i].Workspace < finalResults[j].Workspace
+		}
+		return finalResults[i].File < finalResults[j].File
+	})
+
+	return types.SearchContentResults{
+		Results:    finalResults,
+		Truncate:   summary.Truncate,
+		Expansions: summary.Expansions,
+		Variants:   summary.Variants,
+		Warnings:   summary.Warnings,
+		Counts:     summary.Counts,
+		Explain:    summary.Explain,
 	}
+}
 
+// newSearchEngine returns the engine of the request, the query is compiled by the caller
+func newSearchEngine(workspace *workspace.Workspace, req *types.SearchContentRequest) *SimpleContentSearchEngine {
+	engine := NewSimpleContentSearchEngine(workspace)
+	if req.Scope != nil {
+		engine.Scope = req.Scope.Type
+		engine.Window = req.Scope.Window
+	}
+	if req.Fuzzy != nil {
+		engine.Fuzzy = true
+		engine.FuzzyDistance = req.Fuzzy.Distance
+	}
+	engine.Variants = req.Variants
+	if req.Multiline != nil {
+		engine.MultilineWindow = req.Multiline.Window
+	}
+	return engine
+}
+
+// ValidateQuery compiles the query of the request, so an invalid query is reported before the search starts
+// Fuzzy terms aren't expanded, as the expansions depend on the workspace.
+func ValidateQuery(req *types.SearchContentRequest) error {
+	engine := newSearchEngine(nil, req)
+	engine.validating = true
+	return engine.Compile(req.Query, req.CaseSensitive)
+}
+
+// getSearchTimeout returns the timeout of the search request
+// The request timeout is capped by conf.MaxSearchTimeoutMs, server's default is used if it's not set
+func getSearchTimeout(req *types.SearchContentRequest) time.Duration {
+	timeoutMs := conf.Get().Server.Search.TimeoutMs
+	if req.TimeoutMs > 0 {
+		timeoutMs = min(req.TimeoutMs, conf.MaxSearchTimeoutMs)
+	}
+
+	return time.Duration(timeoutMs) * time.Millisecond
+}
+
+// getSearchLimit returns the limits of the search request, which are capped by the server's limits
+func getSearchLimit(req *types.SearchContentRequest) types.SearchLimit {
 	limit := conf.Get().Server.Search.Limit
 	if req.Limit != nil {
 		if req.Limit.MaxResults > 0 && req.Limit.MaxResults < limit.MaxResults {
@@ -58,99 +137,360 @@ func SearchContent(workspace *workspace.Workspace, req *types.SearchContentReque
 		}
 	}
 
-	var globalInclude *utils.SimpleFilter
-	if len(workspace.GetFilters().Include) > 0 {
-		globalInclude = utils.NewSimpleFilter(workspace.GetFilters().Include, workspace.Path)
-	}
+	return limit
+}
 
-	var includeFilter *utils.SimpleFilter
-	var excludeFilter *utils.SimpleFilter
-	var pathFilter = ""
-	if req.Filters != nil {
-		pathFilter = strings.ToLower(
-			filepath.FromSlash(filepath.Clean(filepath.Join(workspace.Path, req.Filters.Path)) + "/"))
+// SearchContentStream searches the content of the workspaces and calls emit for each matched file
+// as soon as the file is matched. The search stops when ctx is done, the timeout is reached or emit returns false.
+// Workspaces are searched concurrently, and the limits apply to all of them together.
+// Candidate files of all workspaces are matched by one pool of conf.Server.Search.Workers workers, emit is never
+// called concurrently. Results are emitted in the order their files are matched, they aren't ranked across files
+// or workspaces, SearchContent ranks them once the search is done.
+// returns the summary of the search, Truncate is set if the results are truncated by the limits or the timeout
+// Results of complete searches are cached until the documents of any of the workspaces change.
+func SearchContentStream(ctx context.Context, workspaces []*workspace.Workspace, req *types.SearchContentRequest,
+	emit func(result types.SearchContentResult) bool) *types.SearchContentSummary {
+	key, cacheable := resultCache.key(workspaces, req)
+	if !cacheable {
+		summary, _ := searchContent(ctx, workspaces, req, emit)
+		return summary
+	}
 
-		if req.Filters.Include != "" {
-			includeFilter = utils.NewSimpleFilter(strings.Split(req.Filters.Include, ","), workspace.Path)
+	if entry := resultCache.get(key); entry != nil {
+		start := time.Now()
+		for _, result := range entry.results {
+			if ctx.Err() != nil || !emit(result) {
+				break
+			}
 		}
 
-		if req.Filters.Exclude != "" {
-			excludeFilter = utils.NewSimpleFilter(strings.Split(req.Filters.Exclude, ","), workspace.Path)
+		summary := entry.summary
+		summary.Cached = true
+		summary.TookMs = time.Since(start).Milliseconds()
+		return &summary
+	}
+
+	ids := workspaceIds(workspaces)
+	generations := resultCache.snapshot(ids)
+
+	results := []types.SearchContentResult{}
+	summary, complete := searchContent(ctx, workspaces, req, func(result types.SearchContentResult) bool {
+		results = append(results, result)
+		return emit(result)
+	})
+
+	if complete {
+		resultCache.put(key, ids, generations, results, *summary)
+	}
+
+	return summary
+}
+
+// searchContent searches the content of the workspaces, it's SearchContentStream without the cache
+// returns the summary, and whether the search is complete, i.e. it's neither cancelled nor timed out
+func searchContent(ctx context.Context, workspaces []*workspace.Workspace, req *types.SearchContentRequest,
+	emit func(result types.SearchContentResult) bool) (*types.SearchContentSummary, bool) {
+	start := time.Now()
+	summary := &types.SearchContentSummary{
+		Counts: newSearchContentCounts(req.Mode),
+	}
+	if req.Explain {
+		summary.Explain = &types.SearchExplain{
+			Workspaces: []types.SearchExplainWorkspace{},
 		}
 	}
+	defer func() {
+		summary.TookMs = time.Since(start).Milliseconds()
+	}()
 
-	// Check if the file should be included in the search
-	var wantFile = func(doc *fulltext.Document) bool {
-		fullPath := filepath.Join(workspace.Path, doc.RelPath)
-		if len(pathFilter) > 0 && !strings.HasPrefix(strings.ToLower(fullPath), pathFilter) {
-			return false
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, getSearchTimeout(req))
+	defer cancel()
+
+	s := &contentSearch{
+		ctx:     ctx,
+		cancel:  cancel,
+		req:     req,
+		limit:   getSearchLimit(req),
+		emit:    emit,
+		summary: summary,
+	}
+
+	// One pool of conf.Server.Search.Workers workers matches the candidate files of all workspaces
+	workers := max(conf.Get().Server.Search.Workers, 1)
+	jobs := make(chan func())
+	pool := sync.WaitGroup{}
+	for range workers {
+		pool.Add(1)
+		go func() {
+			defer pool.Done()
+			for job := range jobs {
+				job()
+			}
+		}()
+	}
+
+	// At most conf.Server.Search.Workers workspaces collect their candidates at the same time
+	semaphore := make(chan struct{}, workers)
+	wg := sync.WaitGroup{}
+	for _, workspace := range workspaces {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.searchWorkspace(workspace, semaphore, jobs)
+		}()
+	}
+	wg.Wait()
+	close(jobs)
+	pool.Wait()
+
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil
+	if timedOut {
+		log.Printf("Search `%s` in %d workspaces timed out", req.Query, len(workspaces))
+	}
+
+	summary.Truncate = s.limitReached() || timedOut
+	sort.Strings(summary.Warnings)
+	if summary.Explain != nil {
+		sort.Slice(summary.Explain.Workspaces, func(i, j int) bool {
+			return summary.Explain.Workspaces[i].Workspace < summary.Explain.Workspaces[j].Workspace
+		})
+
+		switch {
+		case timedOut:
+			summary.Explain.Truncation = types.TruncateByTimeout
+		case parent.Err() != nil || s.stopped:
+			summary.Explain.Truncation = types.TruncateByCancel
+		case s.limitReached():
+			summary.Explain.Truncation = types.TruncateByMaxResults
 		}
+	}
+
+	return summary, !timedOut && parent.Err() == nil && !s.stopped
+}
+
+// contentSearch is the state shared by the workspaces of a content search
+type contentSearch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	req    *types.SearchContentRequest
+	limit  types.SearchLimit
+
+	// totalHits is shared by all workers, a hit is only accepted if it's still within the limit
+	totalHits atomic.Int64
+
+	// emitMutex guards emit, stopped and summary
+	emitMutex sync.Mutex
+	emit      func(result types.SearchContentResult) bool
+	stopped   bool // emit returned false
+	summary   *types.SearchContentSummary
+}
+
+// acceptHit returns true if a hit is within MaxResults, hits are always accepted in the count modes
+func (s *contentSearch) acceptHit() bool {
+	return s.totalHits.Add(1) <= int64(s.limit.MaxResults) || s.summary.Counts != nil
+}
+
+func (s *contentSearch) limitReached() bool {
+	return s.totalHits.Load() >= int64(s.limit.MaxResults) && s.summary.Counts == nil
+}
+
+// hits is the number of hits of the file, the lines of the hits are not kept in the count modes
+func (s *contentSearch) emitResult(fileMatch types.SearchContentResult, hits int) {
+	s.emitMutex.Lock()
+	defer s.emitMutex.Unlock()
+
+	// The search may be cancelled while waiting for the lock
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	s.summary.TotalHits += hits
+	s.summary.TotalFiles++
+
+	// Matched lines are only counted in the count modes
+	if s.summary.Counts != nil {
+		addFile(s.summary.Counts, fileMatch.File, hits)
+		return
+	}
+
+	if !s.emit(fileMatch) {
+		s.stopped = true
+		s.cancel()
+	}
+}
+
+// addExpansions merges the expansions of fuzzy terms of a workspace into the summary
+func (s *contentSearch) addExpansions(expansions map[string][]string) {
+	s.emitMutex.Lock()
+	defer s.emitMutex.Unlock()
 
-		// File not included by workspace filters
-		if globalInclude != nil && !globalInclude.Match(fullPath, false) {
-			return false
+	for term, keywords := range expansions {
+		if s.summary.Expansions == nil {
+			s.summary.Expansions = map[string][]string{}
 		}
 
-		// Excluded by filter
-		if excludeFilter != nil && excludeFilter.Match(fullPath, false) {
-			return false
+		known := map[string]struct{}{}
+		for _, keyword := range s.summary.Expansions[term] {
+			known[keyword] = struct{}{}
+		}
+		for _, keyword := range keywords {
+			if _, ok := known[keyword]; !ok {
+				s.summary.Expansions[term] = append(s.summary.Expansions[term], keyword)
+			}
 		}
+	}
+}
+
+// addVariants sets the variants of the terms, they are the same in all workspaces
+func (s *contentSearch) addVariants(variants map[string][]string) {
+	s.emitMutex.Lock()
+	defer s.emitMutex.Unlock()
+
+	if s.summary.Variants == nil {
+		s.summary.Variants = variants
+	}
+}
+
+// addWarnings adds the warnings of the planner of a workspace to the summary
+func (s *contentSearch) addWarnings(workspace *workspace.Workspace, warnings []string) {
+	s.emitMutex.Lock()
+	defer s.emitMutex.Unlock()
+
+	for _, warning := range warnings {
+		s.summary.Warnings = append(s.summary.Warnings, workspace.Path+": "+warning)
+	}
+}
+
+// addExplain adds the query plan and the statistics of a workspace to the summary
+func (s *contentSearch) addExplain(explain types.SearchExplainWorkspace) {
+	s.emitMutex.Lock()
+	defer s.emitMutex.Unlock()
 
-		// Not included by include filter
-		if includeFilter != nil && !includeFilter.Match(fullPath, false) {
-			return false
+	s.summary.Explain.Workspaces = append(s.summary.Explain.Workspaces, explain)
+}
+
+// addCandidates adds the number of candidate documents of a workspace to the counts
+func (s *contentSearch) addCandidates(candidates int) {
+	s.emitMutex.Lock()
+	defer s.emitMutex.Unlock()
+
+	s.summary.Counts.Candidates += candidates
+}
+
+// searchWorkspace searches the content of a workspace and emits the matched files
+// The candidates are collected while holding the semaphore, then their files are matched by the jobs of the pool
+// of the search, it returns once all of them are matched.
+func (s *contentSearch) searchWorkspace(workspace *workspace.Workspace, semaphore chan struct{}, jobs chan<- func()) {
+	ctx, req, limit := s.ctx, s.req, s.limit
+	acceptHit, limitReached, emitResult := s.acceptHit, s.limitReached, s.emitResult
+
+	// All hits of a file are counted in the count modes
+	counting := s.summary.Counts != nil
+	if counting {
+		limit.MaxResultsPerFile = math.MaxInt
+	}
+
+	select {
+	case semaphore <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	collecting := true
+	defer func() {
+		if collecting {
+			<-semaphore
 		}
+	}()
 
-		return true
+	stats := &workspaceStats{}
+	phaseStart := time.Now()
+
+	// Check if the file should be included in the search
+	filter, err := newFileFilter(workspace, req.Filters)
+	if err != nil {
+		log.Println("Invalid search filters:", err)
+		return
 	}
+	wantFile := filter.wantFile
 
 	// Compile the query
-	engine := NewSimpleContentSearchEngine(workspace)
-	err := engine.Compile(req.Query, req.CaseSensitive)
+	engine := newSearchEngine(workspace, req)
+	err = engine.Compile(req.Query, req.CaseSensitive)
 	if err != nil {
 		log.Println("Failed to compile query:", err)
-		return []types.SearchContentResult{}, false
+		return
+	}
+	s.addExpansions(engine.Expansions())
+	s.addVariants(engine.TermVariants())
+	stats.compileTime = time.Since(phaseStart)
+
+	if req.Explain {
+		defer func() {
+			s.addExplain(stats.explain(engine, req.Multiline != nil))
+		}()
 	}
-
-	finalResults := []types.SearchContentResult{}
-	totalHits := 0
 
 	beforeAfter := req.BeforeAfter
-	if beforeAfter < 0 {
+	if beforeAfter < 0 || counting {
 		beforeAfter = 0
 	} else if beforeAfter > 5 {
 		beforeAfter = 5
 	}
 
-	// Match the content of the file line by line
-	var matchFileContent = func(doc *fulltext.Document) (types.SearchContentResult, error) {
+	// Unsaved buffers of the workspace are searched instead of their files on disk
+	wsOverlays := bufferOverlays.active(workspace)
+
+	// Match the content of the file line by line, returns the matched file and the number of its hits
+	// Hits are only counted in the count modes, the matched lines are not kept.
+	var matchFileContent = func(doc *fulltext.Document) (types.SearchContentResult, int, error) {
 		fullPath := filepath.Join(workspace.Path, doc.RelPath)
 		fileMatch := types.SearchContentResult{
-			File:  filepath.Clean(doc.RelPath),
-			Lines: []types.LineMatch{},
+			Workspace: workspace.Path,
+			File:      filepath.Clean(doc.RelPath),
+			Lines:     []types.LineMatch{},
 		}
 
 		// Read file and match line by line
-		file, err := os.Open(fullPath)
-		if err != nil {
-			log.Printf("Failed to open file:`%s`, error:%s", fullPath, err)
-			return fileMatch, err
+		var reader io.Reader
+		if o := wsOverlays[doc.ID]; o != nil {
+			reader = strings.NewReader(o.content)
+			fileMatch.Overlay = true
+		} else {
+			file, err := os.Open(fullPath)
+			if err != nil {
+				log.Printf("Failed to open file:`%s`, error:%s", fullPath, err)
+				return fileMatch, 0, err
+			}
+			defer file.Close()
+			reader = file
 		}
-		defer file.Close()
 
-		scanner := bufio.NewScanner(file)
+		scanner := bufio.NewScanner(reader)
 
 		lines := []string{}
 		lineNumber := 1
 		fileHits := 0
-		for scanner.Scan() {
+		done := false
+		for !done && scanner.Scan() {
+			if lineNumber%1024 == 0 && ctx.Err() != nil {
+				return fileMatch, 0, ctx.Err()
+			}
+
 			line := scanner.Text()
 			if beforeAfter > 0 {
 				lines = append(lines, line)
 			}
 			matches := engine.IsLineMatch(line)
-			if len(matches) > 0 {
-				for _, match := range matches {
+			for _, match := range matches {
+				// The rest of the file is cut off by the limit of the search
+				if !acceptHit() {
+					fileMatch.Truncate = true
+					done = true
+					break
+				}
+
+				if !counting {
 					fileMatch.Lines = append(fileMatch.Lines, types.LineMatch{
 						Line: types.SearchContentLine{
 							LineNumber: lineNumber,
@@ -158,15 +498,12 @@ func SearchContent(workspace *workspace.Workspace, req *types.SearchContentReque
 							Match:      match,
 						},
 					})
-
-					totalHits++
-					fileHits++
-					if fileHits >= limit.MaxResultsPerFile {
-						fileMatch.Truncate = true
-						break
-					}
 				}
-				if fileHits >= limit.MaxResultsPerFile || totalHits >= limit.MaxResults {
+
+				fileHits++
+				if fileHits >= limit.MaxResultsPerFile {
+					fileMatch.Truncate = true
+					done = true
 					break
 				}
 			}
@@ -175,77 +512,203 @@ func SearchContent(workspace *workspace.Workspace, req *types.SearchContentReque
 
 		// Populate before and after context lines
 		if beforeAfter > 0 {
-			for i := 0; i < len(fileMatch.Lines); i++ {
-				line := &fileMatch.Lines[i]
-				lineNum := line.Line.LineNumber
-
-				// Add before context lines
-				for j := lineNum - beforeAfter; j < lineNum; j++ {
-					if j > 0 && j <= len(lines) {
-						line.Before = append(line.Before, types.SearchContentLine{
-							LineNumber: j,
-							Content:    lines[j-1], // -1 because line numbers are 1-based, but array is 0-based
-						})
-					}
-				}
+			// Read the after context lines of the last match
+			for i := 0; i < beforeAfter && scanner.Scan(); i++ {
+				lines = append(lines, scanner.Text())
+			}
 
-				// Add after context lines
-				for j := lineNum + 1; j <= lineNum+beforeAfter; j++ {
-					if j <= len(lines) {
-						line.After = append(line.After, types.SearchContentLine{
-							LineNumber: j,
-							Content:    lines[j-1], // -1 because line numbers are 1-based, but array is 0-based
-						})
-					}
-				}
+			populateContextLines(fileMatch.Lines, lines, beforeAfter)
+		}
+
+		return fileMatch, fileHits, nil
+	}
+
+	// Match the whole content of the file at once, used by the multi-line mode and the window/file scopes
+	var matchFileContentWhole = func(doc *fulltext.Document,
+		match func(content string) ([]types.LineMatch, []string, bool)) (types.SearchContentResult, int, error) {
+		fullPath := filepath.Join(workspace.Path, doc.RelPath)
+		fileMatch := types.SearchContentResult{
+			Workspace: workspace.Path,
+			File:      filepath.Clean(doc.RelPath),
+			Lines:     []types.LineMatch{},
+		}
+
+		var content string
+		if o := wsOverlays[doc.ID]; o != nil {
+			content = o.content
+			fileMatch.Overlay = true
+		} else {
+			data, err := os.ReadFile(fullPath)
+			if err != nil {
+				log.Printf("Failed to read file:`%s`, error:%s", fullPath, err)
+				return fileMatch, 0, err
 			}
+			content = string(data)
+		}
+
+		if ctx.Err() != nil {
+			return fileMatch, 0, ctx.Err()
+		}
+
+		matches, lines, truncate := match(content)
+		fileMatch.Truncate = truncate
+		if counting {
+			return fileMatch, len(matches), nil
+		}
+		fileMatch.Lines = matches
+
+		if beforeAfter > 0 {
+			populateContextLines(fileMatch.Lines, lines, beforeAfter)
 		}
 
-		return fileMatch, nil
+		return fileMatch, len(matches), nil
 	}
 
 	// Collect the all related documents
+	phaseStart = time.Now()
 	results, err := engine.CollectDocuments()
+	s.addWarnings(workspace, engine.Warnings())
 	if err != nil {
-		return []types.SearchContentResult{}, false
+		log.Printf("Failed to collect documents of `%s` in workspace `%s`: %v", req.Query, workspace.Path, err)
+		return
 	}
 
-	for docid := range results.DocIds {
-		if isTimeout() {
-			break
+	// Overlays are not indexed, so their keywords are checked instead, the indexed content is replaced by them
+	for docid, o := range wsOverlays {
+		if engine.MatchKeywords(o.keywords) {
+			results.DocIds[docid] = struct{}{}
+		} else {
+			delete(results.DocIds, docid)
 		}
+	}
+	stats.candidates = len(results.DocIds)
+	stats.collectTime = time.Since(phaseStart)
 
-		doc, err := fulltext.GetDocument(workspace.ID, docid, false)
-		if err != nil || doc == nil {
-			continue
+	if counting {
+		s.addCandidates(len(results.DocIds))
+		if req.Mode == types.SearchModeEstimate {
+			return
+		}
+	}
+
+	// Candidates are matched by the pool once the workspace stops collecting
+	collecting = false
+	<-semaphore
+
+	phaseStart = time.Now()
+	defer func() {
+		stats.matchTime = time.Since(phaseStart)
+	}()
+
+	var matchDocument = func(docid string) {
+		if ctx.Err() != nil || limitReached() {
+			return
+		}
+
+		var doc *fulltext.Document
+		var err error
+		o := wsOverlays[docid]
+		if o != nil {
+			doc = o.document()
+		} else {
+			doc, err = fulltext.GetDocument(workspace.ID, docid, false)
+			if err != nil || doc == nil {
+				return
+			}
 		}
 
 		// Check if the file should be included in the search
 		if !wantFile(doc) {
-			continue
+			stats.filesSkipped.Add(1)
+			return
 		}
 
-		// File has been removed, skip it
-		removed, err := indexer.RefreshFileIfNeeded(workspace, doc)
-		if err != nil || removed {
-			continue
+		// File has been removed, skip it, overlays are not on disk so they are never refreshed
+		if o == nil {
+			removed, err := indexer.RefreshFileIfNeeded(workspace, doc)
+			if err != nil || removed {
+				stats.filesRemoved.Add(1)
+				return
+			}
 		}
+		stats.filesRead.Add(1)
 
-		fileMatch, err := matchFileContent(doc)
+		var fileMatch types.SearchContentResult
+		var hits int
+		if engine.IsScoped() {
+			fileMatch, hits, err = matchFileContentWhole(doc, func(content string) ([]types.LineMatch, []string, bool) {
+				return matchContentScoped(engine, content, limit.MaxResultsPerFile, acceptHit)
+			})
+		} else if req.Multiline != nil {
+			fileMatch, hits, err = matchFileContentWhole(doc, func(content string) ([]types.LineMatch, []string, bool) {
+				return matchContentMultiline(engine, content, req.Multiline.Window, limit.MaxResultsPerFile, acceptHit)
+			})
+		} else {
+			fileMatch, hits, err = matchFileContent(doc)
+		}
 		if err != nil {
-			continue
+			return
 		}
 
-		if len(fileMatch.Lines) > 0 {
-			finalResults = append(finalResults, fileMatch)
+		if hits > 0 {
+			stats.filesMatched.Add(1)
+			if fileMatch.Truncate {
+				stats.filesTruncated.Add(1)
+			}
+			emitResult(fileMatch, hits)
 		}
+	}
 
-		if totalHits >= limit.MaxResults {
+	pending := sync.WaitGroup{}
+	for docid := range results.DocIds {
+		if ctx.Err() != nil || limitReached() {
 			break
 		}
+
+		pending.Add(1)
+		select {
+		case jobs <- func() {
+			defer pending.Done()
+			matchDocument(docid)
+		}:
+		case <-ctx.Done():
+			pending.Done()
+		}
 	}
+	pending.Wait()
+}
 
-	return finalResults, totalHits >= limit.MaxResults
+// populateContextLines populates the before and after context lines of the matches
+// lines are all lines of the file that have been read, the after lines start after the last line of a match
+func populateContextLines(matches []types.LineMatch, lines []string, beforeAfter int) {
+	for i := 0; i < len(matches); i++ {
+		line := &matches[i]
+		lineNum := line.Line.LineNumber
+		endLineNum := lineNum
+		if line.Range != nil {
+			endLineNum = line.Range.EndLine
+		}
+
+		// Add before context lines
+		for j := lineNum - beforeAfter; j < lineNum; j++ {
+			if j > 0 && j <= len(lines) {
+				line.Before = append(line.Before, types.SearchContentLine{
+					LineNumber: j,
+					Content:    lines[j-1], // -1 because line numbers are 1-based, but array is 0-based
+				})
+			}
+		}
+
+		// Add after context lines
+		for j := endLineNum + 1; j <= endLineNum+beforeAfter; j++ {
+			if j <= len(lines) {
+				line.After = append(line.After, types.SearchContentLine{
+					LineNumber: j,
+					Content:    lines[j-1], // -1 because line numbers are 1-based, but array is 0-based
+				})
+			}
+		}
+	}
 }
 
 // fuzzyMatchWithScore checks if pattern matches text and returns a score (0-100)
@@ -355,41 +818,85 @@ func fuzzyMatchWithScore(pattern, text string) (bool, int) {
 	return true, score
 }
 
-func SearchFiles(workspace *workspace.Workspace, req *types.SearchFilesRequest) (types.SearchFilesResult, error) {
+// SearchFiles searches the files of the workspaces by fuzzy matching their paths
+// Workspaces are scanned concurrently, and the matches of all workspaces are ranked together.
+// The scan stops when ctx is done or conf.Server.Search.TimeoutMs is reached, the files matched so far are ranked
+// on timeout, while ctx's error is returned once it's cancelled.
+func SearchFiles(ctx context.Context, workspaces []*workspace.Workspace,
+	req *types.SearchFilesRequest) (types.SearchFilesResult, error) {
 	type MatchResult struct {
-		RelPath string
-		Score   int
+		Workspace *workspace.Workspace
+		RelPath   string
+		Score     int
 	}
 
-	startTime := time.Now()
-	var isTimeout = func() bool {
-		return time.Since(startTime) > 10*time.Second
-	}
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(conf.Get().Server.Search.TimeoutMs)*time.Millisecond)
+	defer cancel()
 
 	pattern := strings.ReplaceAll(req.Query, " ", "")
 	matches := []MatchResult{}
-	fulltext.ScanFiles(workspace.ID, func(_, relPath string) bool {
-		if isTimeout() {
-			return false
-		}
+	matchesMutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, workspace := range workspaces {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 
-		if !fuzzy.Match(pattern, relPath) {
-			return true
-		}
+			filter, err := newFileFilter(workspace, req.Filters)
+			if err != nil {
+				log.Println("Invalid search filters:", err)
+				return
+			}
+
+			workspaceMatches := []MatchResult{}
+			fulltext.ScanFiles(workspace.ID, func(docid, relPath string) bool {
+				if ctx.Err() != nil {
+					return false
+				}
+
+				if !fuzzy.Match(pattern, relPath) || !filter.wantPath(relPath) {
+					return true
+				}
+
+				if filter.hasMetadata() {
+					doc, err := fulltext.GetDocument(workspace.ID, docid, false)
+					if err != nil || doc == nil || !filter.wantFile(doc) {
+						return true
+					}
+				}
 
-		matched, score := fuzzyMatchWithScore(pattern, relPath)
-		if matched {
-			matches = append(matches, MatchResult{
-				RelPath: relPath,
-				Score:   score,
+				matched, score := fuzzyMatchWithScore(pattern, relPath)
+				if matched {
+					workspaceMatches = append(workspaceMatches, MatchResult{
+						Workspace: workspace,
+						RelPath:   relPath,
+						Score:     score,
+					})
+				}
+				return true
 			})
-		}
-		return true
-	})
+
+			matchesMutex.Lock()
+			matches = append(matches, workspaceMatches...)
+			matchesMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if err := parent.Err(); err != nil {
+		return types.SearchFilesResult{Query: req.Query}, err
+	}
+	if ctx.Err() != nil {
+		log.Printf("Search files `%s` in %d workspaces timed out", req.Query, len(workspaces))
+	}
 
 	// Sort matches by score (highest first)
 	sort.Slice(matches, func(i, j int) bool {
 		if matches[i].Score == matches[j].Score {
+			if len(matches[i].RelPath) == len(matches[j].RelPath) {
+				return matches[i].Workspace.Path < matches[j].Workspace.Path
+			}
 			return len(matches[i].RelPath) < len(matches[j].RelPath)
 		} else {
 			return matches[i].Score > matches[j].Score
@@ -397,20 +904,21 @@ func SearchFiles(workspace *workspace.Workspace, req *types.SearchFilesRequest)
 	})
 
 	result := types.SearchFilesResult{
-		Query: req.Query,
-		Files: []string{},
+		Query:   req.Query,
+		Files:   []string{},
+		Matches: []types.SearchFileMatch{},
 	}
 
-	removedFiles := []string{}
+	removedFiles := map[*workspace.Workspace][]string{}
 	// Filter and display only matches with score > 50
 	for _, match := range matches {
 		if match.Score <= 50 {
 			continue
 		}
-		stat, err := os.Stat(filepath.Join(workspace.Path, match.RelPath))
+		stat, err := os.Stat(filepath.Join(match.Workspace.Path, match.RelPath))
 		if os.IsNotExist(err) || stat.IsDir() {
 			log.Printf("Warning: file `%s` has been removed or is a directory", match.RelPath)
-			removedFiles = append(removedFiles, match.RelPath)
+			removedFiles[match.Workspace] = append(removedFiles[match.Workspace], match.RelPath)
 			continue
 		}
 		if err != nil {
@@ -418,6 +926,11 @@ func SearchFiles(workspace *workspace.Workspace, req *types.SearchFilesRequest)
 		}
 
 		result.Files = append(result.Files, match.RelPath)
+		result.Matches = append(result.Matches, types.SearchFileMatch{
+			Workspace: match.Workspace.Path,
+			File:      match.RelPath,
+			Score:     match.Score,
+		})
 		if len(result.Files) >= req.Limit {
 			break
 		}
@@ -425,9 +938,11 @@ func SearchFiles(workspace *workspace.Workspace, req *types.SearchFilesRequest)
 
 	if len(removedFiles) > 0 {
 		go func() {
-			for _, relPath := range removedFiles {
-				// Remove the file from the index
-				indexer.RemoveFile(workspace, relPath)
+			for workspace, relPaths := range removedFiles {
+				for _, relPath := range relPaths {
+					// Remove the file from the index
+					indexer.RemoveFile(workspace, relPath)
+				}
 			}
 		}() // Remove the files from the workspace
 	}
@@ -0,0 +1,234 @@
+package searcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// newIndexedWorkspaces creates a workspace of each map of files in a new storage, and indexes the files
+func newIndexedWorkspaces(t *testing.T, workspaceFiles ...map[string]string) []*workspace.Workspace {
+	tempDir := t.TempDir()
+	conf.Get().Global.DataPath = filepath.Join(tempDir, "data")
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := workspace.Init(); err != nil {
+		t.Fatalf("Workspace Init failed: %v", err)
+	}
+
+	workspaces := []*workspace.Workspace{}
+	for i, files := range workspaceFiles {
+		wsPath := filepath.Join(tempDir, fmt.Sprintf("ws%d", i))
+		if err := os.MkdirAll(wsPath, 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		ws, err := workspace.Create(wsPath)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		workspaces = append(workspaces, ws)
+
+		docs := []*fulltext.Document{}
+		for relPath, content := range files {
+			fullPath := filepath.Join(wsPath, relPath)
+			if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			stat, _ := os.Stat(fullPath)
+			docs = append(docs, &fulltext.Document{
+				ID:           indexer.GetDocumentId(fullPath),
+				RelPath:      relPath,
+				ModifiedTime: stat.ModTime().UnixNano(),
+				Words:        indexer.ParseKeywords(content),
+			})
+		}
+		if err := fulltext.SaveNewDocuments(ws.ID, docs); err != nil {
+			t.Fatalf("SaveNewDocuments failed: %v", err)
+		}
+	}
+
+	// The keywords are written once the storage is closed
+	fulltext.CloseAndWait()
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		for _, ws := range workspaces {
+			workspace.Delete(ws.ID)
+		}
+		fulltext.CloseAndWait()
+	})
+	return workspaces
+}
+
+// numberedFiles returns count files, each of them has lines lines of the content
+func numberedFiles(count int, lines int, content string) map[string]string {
+	files := map[string]string{}
+	for i := range count {
+		text := ""
+		for range lines {
+			text += content + "\n"
+		}
+		files[fmt.Sprintf("file%02d.go", i)] = text
+	}
+	return files
+}
+
+// collectResults runs the search without the cache, and returns the results ordered by file
+func collectResults(t *testing.T, ctx context.Context, workspaces []*workspace.Workspace,
+	req *types.SearchContentRequest) ([]types.SearchContentResult, *types.SearchContentSummary) {
+	results := []types.SearchContentResult{}
+	summary, _ := searchContent(ctx, workspaces, req, func(result types.SearchContentResult) bool {
+		results = append(results, result)
+		return true
+	})
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Workspace != results[j].Workspace {
+			return results[i].Workspace < results[j].Workspace
+		}
+		return results[i].File < results[j].File
+	})
+	return results, summary
+}
+
+func TestSearchContentWorkers(t *testing.T) {
+	saved := conf.Get().Server.Search.Workers
+	defer func() { conf.Get().Server.Search.Workers = saved }()
+
+	workspaces := newIndexedWorkspaces(t, numberedFiles(20, 3, "call handleRequest()"),
+		numberedFiles(5, 1, "handleRequest"))
+	req := &types.SearchContentRequest{Query: "handleRequest"}
+
+	// Every candidate is matched once whatever the number of workers
+	for _, workers := range []int{1, 3, 16} {
+		conf.Get().Server.Search.Workers = workers
+		results, summary := collectResults(t, context.Background(), workspaces, req)
+		if len(results) != 25 || summary.TotalFiles != 25 || summary.TotalHits != 65 || summary.Truncate {
+			t.Errorf("workers %d: got %d results, summary %+v, want 25 files and 65 hits", workers, len(results),
+				summary)
+		}
+		for i := 1; i < len(results); i++ {
+			if results[i].Workspace == results[i-1].Workspace && results[i].File == results[i-1].File {
+				t.Errorf("workers %d: file %s is emitted twice", workers, results[i].File)
+			}
+		}
+	}
+}
+
+func TestSearchContentLimit(t *testing.T) {
+	workspaces := newIndexedWorkspaces(t, numberedFiles(10, 4, "handleRequest"))
+
+	// Hits are counted against MaxResults across files, the file cut off by it is truncated
+	req := &types.SearchContentRequest{
+		Query: "handleRequest",
+		Limit: &types.SearchLimit{MaxResults: 10, MaxResultsPerFile: 100},
+	}
+	results, summary := collectResults(t, context.Background(), workspaces, req)
+	if summary.TotalHits != 10 || !summary.Truncate {
+		t.Errorf("got summary %+v, want 10 hits and truncated", summary)
+	}
+	hits, truncated := 0, 0
+	for _, result := range results {
+		hits += len(result.Lines)
+		if result.Truncate {
+			truncated++
+		} else if len(result.Lines) != 4 {
+			t.Errorf("file %s got %d lines, but it's not truncated", result.File, len(result.Lines))
+		}
+	}
+	if hits != 10 || truncated != 1 {
+		t.Errorf("got %d hits and %d truncated files, want 10 hits and 1 truncated file", hits, truncated)
+	}
+
+	// MaxResultsPerFile truncates each file, but not the search
+	req.Limit = &types.SearchLimit{MaxResults: 100, MaxResultsPerFile: 3}
+	results, summary = collectResults(t, context.Background(), workspaces, req)
+	if len(results) != 10 || summary.TotalHits != 30 || summary.Truncate {
+		t.Errorf("got %d results, summary %+v, want 10 files of 3 hits", len(results), summary)
+	}
+	for _, result := range results {
+		if len(result.Lines) != 3 || !result.Truncate {
+			t.Errorf("file %s got %d lines, truncate %t, want 3 lines and truncated", result.File,
+				len(result.Lines), result.Truncate)
+		}
+	}
+
+	// The count modes count all hits of all matchers
+	req.Mode = types.SearchModeCount
+	for _, multiline := range []*types.SearchMultiline{nil, {}} {
+		req.Multiline = multiline
+		_, summary = collectResults(t, context.Background(), workspaces, req)
+		if summary.Counts == nil || summary.Counts.TotalHits != 40 || summary.Counts.TotalFiles != 10 ||
+			summary.TotalHits != 40 || summary.Truncate {
+			t.Errorf("multiline %t: got counts %+v, summary %+v, want 40 hits in 10 files", multiline != nil,
+				summary.Counts, summary)
+		}
+	}
+}
+
+func TestSearchContentCancel(t *testing.T) {
+	workspaces := newIndexedWorkspaces(t, numberedFiles(10, 1, "handleRequest"))
+	req := &types.SearchContentRequest{Query: "handleRequest", Explain: true}
+
+	// The search stops once emit returns false
+	emitted := 0
+	summary, complete := searchContent(context.Background(), workspaces, req, func(types.SearchContentResult) bool {
+		emitted++
+		return false
+	})
+	if emitted != 1 || complete || summary.Explain.Truncation != types.TruncateByCancel {
+		t.Errorf("got %d results, complete %t, truncation %q, want the first result only", emitted, complete,
+			summary.Explain.Truncation)
+	}
+
+	// Nothing is emitted once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	emitted = 0
+	summary, complete = searchContent(ctx, workspaces, req, func(types.SearchContentResult) bool {
+		emitted++
+		return true
+	})
+	if emitted != 0 || complete || summary.Explain.Truncation != types.TruncateByCancel {
+		t.Errorf("got %d results, complete %t, truncation %q, want nothing", emitted, complete,
+			summary.Explain.Truncation)
+	}
+}
+
+func TestSearchFilesCancel(t *testing.T) {
+	saved := conf.Get().Server.Search.TimeoutMs
+	defer func() { conf.Get().Server.Search.TimeoutMs = saved }()
+
+	workspaces := newIndexedWorkspaces(t, numberedFiles(10, 1, "package main"), numberedFiles(5, 1, "package main"))
+	req := &types.SearchFilesRequest{Query: "file03", Limit: 10}
+
+	result, err := SearchFiles(context.Background(), workspaces, req)
+	if err != nil || len(result.Matches) != 2 || result.Files[0] != "file03.go" {
+		t.Errorf("got %+v, %v, want file03.go of both workspaces", result, err)
+	}
+
+	// A cancelled search returns the error of the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result, err := SearchFiles(ctx, workspaces, req); err == nil || len(result.Files) != 0 {
+		t.Errorf("got %+v, %v, want the error of the cancelled context", result, err)
+	}
+
+	// The scan stops once the timeout of the server is reached, the files matched so far are returned
+	conf.Get().Server.Search.TimeoutMs = 0
+	if result, err := SearchFiles(context.Background(), workspaces, req); err != nil || len(result.Files) != 0 {
+		t.Errorf("got %+v, %v, want no files once timed out", result, err)
+	}
+}
@@ -10,31 +10,107 @@ import (
 	"github.com/codetrek/haystack/conf"
 	"github.com/codetrek/haystack/server/core/fulltext"
 	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
 )
 
-var rePrefix = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_-]+`)
+var (
+	rePrefix    = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_-]+`)
+	reSuffix    = regexp.MustCompile(`[*?]([a-zA-Z0-9_-]{2,})$`)
+	reLiteral   = regexp.MustCompile(`^[a-zA-Z0-9_-]{2,}`)
+	reNear      = regexp.MustCompile(`^NEAR/(\d+)$`)
+	reDirective = regexp.MustCompile(`^@(line|file|window:(\d+))$`)
+	reWordEnd   = regexp.MustCompile(`[a-zA-Z0-9_*?]$`)
+)
 
 type SimpleContentSearchEngine struct {
 	Workspace *workspace.Workspace
 	OrClauses []*SimpleContentSearchEngineAndClause
+
+	// Scope is where all terms of an AND clause must co-occur, one of types.SearchScope*
+	// It's set by the request and could be overridden by `@line`, `@file` or `@window:N` in the query
+	Scope string
+	// Window is the number of lines of types.SearchScopeWindow
+	Window int
+
+	// Fuzzy makes all terms fuzzy, a single term could be made fuzzy by `~term` in the query
+	Fuzzy bool
+	// FuzzyDistance is the maximum edit distance of fuzzy terms, 0 means it depends on the length of the term
+	FuzzyDistance int
+	// Variants makes terms match their spellings in other identifier styles, e.g. `tab_group` and `TabGroup`
+	Variants bool
+	// MultilineWindow is the number of lines a match of MultilineRegex may span, 0 means the whole file
+	MultilineWindow int
+	// CaptureWildcards compiles the wildcards of terms as lazy groups, so the replacement of a replace request
+	// could refer to them, e.g. `${1}`. Searches keep the greedy wildcards, which highlight the whole keyword.
+	CaptureWildcards bool
+	// validating compiles fuzzy terms without expanding them to the indexed keywords, it's set by ValidateQuery
+	validating bool
+
+	// warnings are the terms skipped or the clauses failed by the planner, they are set by CollectDocuments
+	warnings []string
 }
 
 type SimpleContentSearchEngineAndClause struct {
-	Regex    *regexp.Regexp
-	AndTerms []*SimpleContentSearchEngineTerm
+	Regex *regexp.Regexp
+	// MultilineRegex is the same as Regex, but the gap between terms could span multiple lines
+	MultilineRegex *regexp.Regexp
+	AndTerms       []*SimpleContentSearchEngineTerm
+	// Near are the unordered proximity constraints between terms, e.g. `foo NEAR/3 bar`
+	Near []*SimpleContentSearchEngineNear
+
+	// candidates is the number of documents matching all terms, it's set by CollectDocuments
+	candidates int
+	// plan is the terms in the order they are intersected, it's set by CollectDocuments
+	plan []*SimpleContentSearchEngineTerm
+	// warnings are the terms skipped by the planner as they match too many keywords
+	warnings []string
 }
 
 type SimpleContentSearchEngineTerm struct {
 	Pattern string
 	Prefix  string
+	// Suffix is the keyword suffix of a term starting with wildcards, e.g. `handler` of `*Handler`,
+	// it's looked up in the reversed keyword index
+	Suffix string
+	// Infix is the first literal of a term starting and ending with wildcards, e.g. `handler` of `*Handler*`
+	Infix string
+	// Regex matches the term alone, it's used when terms are not matched in order in a line
+	Regex *regexp.Regexp
+	// Expansions are the indexed keywords a fuzzy term is expanded to, nil if the term is not fuzzy
+	// Terms starting with wildcards are expanded to the keywords with their suffix or infix by the planner
+	Expansions []string
+	// Variants are the spellings of the term in other identifier styles, nil if the term has no variants
+	Variants []string
+
+	// estimate is the number of documents of the keywords of the term, it's set by the planner
+	estimate int
+	// skipped is set if the term matches too many keywords, candidates are collected by the other terms
+	skipped bool
+	// candidates is the number of candidates left once the term is intersected, it's set by CollectDocuments
+	candidates int
+}
+
+// SimpleContentSearchEngineNear requires the hits of two terms to be at most Distance words apart, in any order
+type SimpleContentSearchEngineNear struct {
+	Left     int // index of the term in AndTerms
+	Right    int // index of the term in AndTerms
+	Distance int
 }
 
 func (q *SimpleContentSearchEngine) CollectDocuments() (*fulltext.SearchResult, error) {
 	rs := []*fulltext.SearchResult{}
+	var firstErr error
 	// Collect the documents for each or clause
+	q.warnings = nil
 	for _, orClause := range q.OrClauses {
 		r, err := orClause.CollectDocuments(q.Workspace.ID)
+		q.warnings = append(q.warnings, orClause.warnings...)
 		if err != nil {
+			// Other clauses are still searched, the clause is reported as a warning
+			q.warnings = append(q.warnings, err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
 			continue
 		}
 
@@ -42,7 +118,7 @@ func (q *SimpleContentSearchEngine) CollectDocuments() (*fulltext.SearchResult,
 	}
 
 	if len(rs) == 0 {
-		return &fulltext.SearchResult{}, nil
+		return &fulltext.SearchResult{DocIds: make(map[string]struct{})}, firstErr
 	}
 
 	// Merge the results, we use the first result as the base and merge all other results into it
@@ -60,44 +136,106 @@ func (q *SimpleContentSearchEngine) CollectDocuments() (*fulltext.SearchResult,
 	return result, nil
 }
 
+// CollectDocuments collects the documents containing all terms
+// Terms are intersected from the rarest to the most common one, only the documents of the rarest term are
+// collected, the documents of the other terms are streamed and only the ones already collected are kept
 func (q *SimpleContentSearchEngineAndClause) CollectDocuments(workspaceId string) (*fulltext.SearchResult, error) {
-	// Collect the documents for each term
-	rs := []*fulltext.SearchResult{}
-	for _, term := range q.AndTerms {
-		r := term.CollectDocuments(workspaceId)
-		rs = append(rs, &r)
+	plan, warnings, err := planTerms(workspaceId, q.AndTerms, conf.Get().Server.Search.MaxKeywordExpansions)
+	q.plan, q.warnings = plan, warnings
+	if err != nil {
+		return nil, err
 	}
 
-	if len(rs) == 0 {
+	if len(plan) == 0 {
 		return &fulltext.SearchResult{
 			DocIds: make(map[string]struct{}),
 		}, nil
 	}
 
-	// Merge the results, the documents should match all "AND" terms
-	// We use the first result as the base and remove documents that don't match the other results
-	result := rs[0]
-	for _, r := range rs[1:] {
-		for docid := range result.DocIds {
-			if _, ok := r.DocIds[docid]; !ok {
-				delete(result.DocIds, docid)
-			}
+	r := plan[0].CollectDocuments(workspaceId)
+	result := &r
+	plan[0].candidates = len(result.DocIds)
+
+	for _, term := range plan[1:] {
+		if len(result.DocIds) > 0 {
+			result.DocIds = term.intersect(workspaceId, result.DocIds)
 		}
+		term.candidates = len(result.DocIds)
 	}
 
 	if len(q.AndTerms) > 1 {
 		log.Printf("Merged Documents: =>`%s` found %d documents", q.String(), len(result.DocIds))
 	}
 
+	q.candidates = len(result.DocIds)
+
 	return result, nil
 }
 
 func (q *SimpleContentSearchEngineTerm) CollectDocuments(workspaceId string) fulltext.SearchResult {
-	r := fulltext.Search(workspaceId, q.Prefix, -1)
+	if q.Expansions != nil {
+		// A fuzzy or wildcard term matches documents containing any of the exact keywords it's expanded to
+		r := fulltext.SearchResult{DocIds: make(map[string]struct{})}
+		for _, keyword := range q.Expansions {
+			for docid := range fulltext.Search(workspaceId, keyword+"|", -1).DocIds {
+				r.DocIds[docid] = struct{}{}
+			}
+		}
+		log.Printf("CollectDocuments: |--`%s` expanded to %v found %d documents", q.String(), q.Expansions, len(r.DocIds))
+		return r
+	}
+
+	r := fulltext.SearchResult{DocIds: make(map[string]struct{})}
+	for _, prefix := range q.prefixes() {
+		for docid := range fulltext.Search(workspaceId, prefix, -1).DocIds {
+			r.DocIds[docid] = struct{}{}
+		}
+	}
 	log.Printf("CollectDocuments: |--`%s` found %d documents", q.String(), len(r.DocIds))
 	return r
 }
 
+// prefixes returns the keyword prefixes of the term looked up in the index, one for each indexed spelling of
+// the variants of the term, as keywords are indexed in lower case
+func (q *SimpleContentSearchEngineTerm) prefixes() []string {
+	if q.Variants == nil {
+		return []string{q.Prefix}
+	}
+
+	prefixes := []string{}
+	known := map[string]struct{}{}
+	for _, variant := range q.Variants {
+		prefix := strings.ToLower(variant)
+		if _, ok := known[prefix]; !ok {
+			known[prefix] = struct{}{}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// ScanDocuments scans the documents containing the term, a document may be passed more than once
+func (q *SimpleContentSearchEngineTerm) ScanDocuments(workspaceId string, callback func(docid string) bool) {
+	queries := q.prefixes()
+	if q.Expansions != nil {
+		queries = []string{}
+		for _, keyword := range q.Expansions {
+			queries = append(queries, keyword+"|")
+		}
+	}
+
+	for _, query := range queries {
+		stopped := false
+		fulltext.ScanDocIds(workspaceId, query, func(docid string) bool {
+			stopped = !callback(docid)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
 func NewSimpleContentSearchEngine(workspace *workspace.Workspace) *SimpleContentSearchEngine {
 	return &SimpleContentSearchEngine{
 		Workspace: workspace,
@@ -132,6 +270,36 @@ func (q *SimpleContentSearchEngineAndClause) IsLineMatch(line string) [][]int {
 	return results
 }
 
+// IsTextMatch matches a text which may contain multiple lines, it returns the byte ranges of the matches
+// Terms of a match may be separated by line breaks, but a single term never spans lines
+func (q *SimpleContentSearchEngine) IsTextMatch(text string) [][]int {
+	for _, orClause := range q.OrClauses {
+		matches := orClause.IsTextMatch(text)
+		if len(matches) > 0 {
+			return matches
+		}
+	}
+
+	return [][]int{}
+}
+
+func (q *SimpleContentSearchEngineAndClause) IsTextMatch(text string) [][]int {
+	if len(q.AndTerms) == 0 || q.MultilineRegex == nil {
+		return [][]int{}
+	}
+	results := [][]int{}
+
+	matches := q.MultilineRegex.FindAllStringSubmatchIndex(text, -1)
+	for _, match := range matches {
+		if len(match) == 0 {
+			continue
+		}
+		results = append(results, match[4:6])
+	}
+
+	return results
+}
+
 func (q *SimpleContentSearchEngine) Compile(query string, caseSensitive bool) error {
 	query = strings.TrimSpace(query)
 	if query == "" {
@@ -141,6 +309,39 @@ func (q *SimpleContentSearchEngine) Compile(query string, caseSensitive bool) er
 	maxWildcardLength := strconv.Itoa(conf.Get().Server.Search.MaxWildcardLength)
 	maxKeywordDistance := strconv.Itoa(conf.Get().Server.Search.MaxKeywordDistance)
 
+	casePattern := ""
+	if !caseSensitive {
+		casePattern = "(?i)"
+	}
+
+	// Scope directives apply to the whole query
+	tokens := []string{}
+	for _, token := range strings.Split(query, " ") {
+		directive := reDirective.FindStringSubmatch(token)
+		if directive == nil {
+			tokens = append(tokens, token)
+			continue
+		}
+
+		if directive[2] != "" {
+			q.Scope = types.SearchScopeWindow
+			q.Window, _ = strconv.Atoi(directive[2])
+		} else {
+			q.Scope = directive[1]
+		}
+	}
+	query = strings.Join(tokens, " ")
+
+	switch q.Scope {
+	case "", types.SearchScopeLine, types.SearchScopeFile:
+	case types.SearchScopeWindow:
+		if q.Window <= 0 {
+			return errors.New("window scope requires a positive number of lines")
+		}
+	default:
+		return errors.New("unknown search scope: " + q.Scope)
+	}
+
 	orClauses := []*SimpleContentSearchEngineAndClause{}
 	for _, orClause := range strings.Split(query, "|") {
 		orClause = strings.TrimSpace(orClause)
@@ -150,48 +351,158 @@ func (q *SimpleContentSearchEngine) Compile(query string, caseSensitive bool) er
 
 		andPatterns := []*SimpleContentSearchEngineTerm{}
 		regPatterns := []string{}
+		nears := []*SimpleContentSearchEngineNear{}
+		pendingNear := -1
 		for _, andPattern := range strings.Split(orClause, " ") {
 			andPattern = strings.TrimSpace(andPattern)
 			if andPattern == "" || andPattern == "AND" {
 				continue
 			}
 
-			prefixes := rePrefix.FindAllString(andPattern, 1)
-			if len(prefixes) > 0 {
-				regPattern := andPattern
+			if near := reNear.FindStringSubmatch(andPattern); near != nil {
+				if len(andPatterns) == 0 || pendingNear >= 0 {
+					return errors.New(andPattern + " requires a term on both sides")
+				}
+				pendingNear, _ = strconv.Atoi(near[1])
+				continue
+			}
+
+			fuzzyTerm := q.Fuzzy
+			if strings.HasPrefix(andPattern, "~") {
+				andPattern = andPattern[1:]
+				fuzzyTerm = true
+			}
+
+			// Wildcard terms are never fuzzy
+			if strings.ContainsAny(andPattern, "*?") {
+				fuzzyTerm = false
+			}
+
+			prefix, suffix, infix := "", "", ""
+			if prefixes := rePrefix.FindAllString(andPattern, 1); len(prefixes) > 0 {
+				prefix = strings.ToLower(prefixes[0])
+			} else {
+				suffix, infix = wildcardLiterals(andPattern)
+			}
+
+			if prefix != "" || suffix != "" || infix != "" {
+				var expansions, variants []string
+				// Leading wildcards are compiled separately, they only match the characters of a keyword
+				leading := len(andPattern) - len(strings.TrimLeft(andPattern, "*?"))
+				regPattern := andPattern[leading:]
+				if fuzzyTerm {
+					expansions = q.expandFuzzy(strings.ToLower(andPattern))
+				}
 				regPattern = strings.ReplaceAll(regPattern, ".", "\\.")
-				regPattern = strings.ReplaceAll(regPattern, "*", ".{0,"+maxWildcardLength+"}")
-				regPattern = strings.ReplaceAll(regPattern, "?", ".?")
+				if q.CaptureWildcards {
+					// Wildcards are lazy and captured, so a replaced match never spans multiple occurrences
+					// of the term, and wildcards could be referred by the replacement
+					regPattern = strings.ReplaceAll(regPattern, "?", "(.?)")
+					regPattern = strings.ReplaceAll(regPattern, "*", "(.{0,"+maxWildcardLength+"}?)")
+				} else {
+					regPattern = strings.ReplaceAll(regPattern, "*", ".{0,"+maxWildcardLength+"}")
+					regPattern = strings.ReplaceAll(regPattern, "?", ".?")
+				}
 				regPattern = strings.ReplaceAll(regPattern, "[", "\\[")
 				regPattern = strings.ReplaceAll(regPattern, "]", "\\]")
 				regPattern = strings.ReplaceAll(regPattern, "^", "\\^")
 				regPattern = strings.ReplaceAll(regPattern, "$", "\\$")
 				regPattern = strings.ReplaceAll(regPattern, ":", "\\:")
+				if leading > 0 {
+					wildcards := ""
+					for _, c := range andPattern[:leading] {
+						wildcard := "[a-zA-Z0-9_-]?"
+						if c == '*' {
+							wildcard = "[a-zA-Z0-9_-]{0," + maxWildcardLength + "}"
+						}
+						if q.CaptureWildcards {
+							wildcard = "(" + wildcard + "?)"
+						}
+						wildcards += wildcard
+					}
+					regPattern = wildcards + regPattern
+
+					// The suffix ends a keyword, as it's looked up in the reversed keyword index
+					if suffix != "" {
+						regPattern += "\\b"
+					}
+				}
+				if expansions != nil {
+					// Keywords are indexed in lower case, so the expansions are matched case-insensitively as whole words
+					quoted := []string{}
+					for _, keyword := range expansions {
+						quoted = append(quoted, regexp.QuoteMeta(keyword))
+					}
+					regPattern = "(?i:" + strings.Join(quoted, "|") + ")\\b"
+				} else if q.Variants && leading == 0 && !strings.ContainsAny(andPattern, "*?") {
+					// Each variant is matched as it's spelled, so it's highlighted in any identifier style
+					variants = identifierVariants(andPattern)
+					if variants != nil {
+						quoted := []string{}
+						for _, variant := range variants {
+							quoted = append(quoted, regexp.QuoteMeta(variant))
+						}
+						regPattern = "(?:" + strings.Join(quoted, "|") + ")"
+					}
+				}
 				regPatterns = append(regPatterns, regPattern)
 
+				// A replaced term ends a word, so the identifiers starting with it are not rewritten,
+				// the boundary is out of the group of the term as it's not substituted
+				wordEnd := ""
+				if q.CaptureWildcards && reWordEnd.MatchString(andPattern) {
+					wordEnd = "\\b"
+				}
+				termReg, err := regexp.Compile(casePattern + "(^|[^a-zA-Z0-9])(" + regPattern + ")" + wordEnd)
+				if err != nil {
+					return err
+				}
+
+				if pendingNear >= 0 {
+					nears = append(nears, &SimpleContentSearchEngineNear{
+						Left:     len(andPatterns) - 1,
+						Right:    len(andPatterns),
+						Distance: pendingNear,
+					})
+					pendingNear = -1
+				}
+
 				andPatterns = append(andPatterns, &SimpleContentSearchEngineTerm{
-					Pattern: andPattern,
-					Prefix:  strings.ToLower(prefixes[0]),
+					Pattern:    andPattern,
+					Prefix:     prefix,
+					Suffix:     suffix,
+					Infix:      infix,
+					Regex:      termReg,
+					Expansions: expansions,
+					Variants:   variants,
 				})
 			}
 		}
 
+		if pendingNear >= 0 {
+			return errors.New("NEAR/" + strconv.Itoa(pendingNear) + " requires a term on both sides")
+		}
+
 		if len(andPatterns) == 0 {
 			continue
 		}
 
-		casePattern := ""
-		if !caseSensitive {
-			casePattern = "(?i)"
-		}
 		reg, err := regexp.Compile(casePattern + "(^|[^a-zA-Z0-9])(" + strings.Join(regPatterns, ".{0,"+maxKeywordDistance+"}[^a-zA-Z0-9]") + ")")
 		if err != nil {
 			return err
 		}
 
+		// The gap between terms may span the lines of the window, while `.` in the terms never matches a line break
+		multilineReg, err := regexp.Compile(casePattern + "(^|[^a-zA-Z0-9])(" + strings.Join(regPatterns, q.multilineGap()+"[^a-zA-Z0-9]") + ")")
+		if err != nil {
+			return err
+		}
+
 		orClauses = append(orClauses, &SimpleContentSearchEngineAndClause{
-			Regex:    reg,
-			AndTerms: andPatterns,
+			Regex:          reg,
+			MultilineRegex: multilineReg,
+			AndTerms:       andPatterns,
+			Near:           nears,
 		})
 	}
 
@@ -203,6 +514,96 @@ func (q *SimpleContentSearchEngine) Compile(query string, caseSensitive bool) er
 	return nil
 }
 
+// maxMultilineGapLines is the maximum number of line breaks a bounded gap is compiled with, the regexp package
+// limits the repetition count to 1000, the lines of larger windows are checked by the matcher
+const maxMultilineGapLines = 1000
+
+// multilineGap returns the pattern of the gap between the terms of MultilineRegex
+// The gap is lazy, so a match ends at the nearest occurrence of the next term.
+func (q *SimpleContentSearchEngine) multilineGap() string {
+	if q.MultilineWindow <= 0 || q.MultilineWindow-1 > maxMultilineGapLines {
+		return `[\s\S]*?`
+	}
+	return `[^\n]*?(?:\n[^\n]*?){0,` + strconv.Itoa(q.MultilineWindow-1) + `}`
+}
+
+// wildcardLiterals returns the literals a term starting with wildcards is looked up by
+// suffix is set if the term ends with a literal following a wildcard, e.g. `handler` of `*Handler`,
+// otherwise infix is the literal following the leading wildcards, e.g. `handler` of `*Handler*`
+// Both are empty if the term doesn't start with wildcards, or the literal is shorter than 2 characters
+func wildcardLiterals(pattern string) (string, string) {
+	rest := strings.TrimLeft(pattern, "*?")
+	if len(rest) == len(pattern) {
+		return "", ""
+	}
+
+	if suffix := reSuffix.FindStringSubmatch(pattern); suffix != nil {
+		return strings.ToLower(suffix[1]), ""
+	}
+
+	return "", strings.ToLower(reLiteral.FindString(rest))
+}
+
+// Warnings returns the terms skipped and the clauses failed by the planner in the last CollectDocuments
+func (q *SimpleContentSearchEngine) Warnings() []string {
+	return q.warnings
+}
+
+// expandFuzzy expands a fuzzy term to the indexed keywords of the workspace
+// The term itself is used if nothing is found, so the term still matches nothing rather than everything
+func (q *SimpleContentSearchEngine) expandFuzzy(term string) []string {
+	if q.validating {
+		return []string{term}
+	}
+
+	workspaceId := ""
+	if q.Workspace != nil {
+		workspaceId = q.Workspace.ID
+	}
+
+	expansions := expandFuzzyTerm(workspaceId, term, fuzzyDistance(term, q.FuzzyDistance))
+	if len(expansions) == 0 {
+		return []string{term}
+	}
+	return expansions
+}
+
+// Expansions returns the keywords each fuzzy term is expanded to, nil if there is no fuzzy term
+func (q *SimpleContentSearchEngine) Expansions() map[string][]string {
+	var result map[string][]string
+	for _, orClause := range q.OrClauses {
+		for _, term := range orClause.AndTerms {
+			if term.Expansions == nil {
+				continue
+			}
+			if result == nil {
+				result = map[string][]string{}
+			}
+			result[term.Pattern] = term.Expansions
+		}
+	}
+
+	return result
+}
+
+// TermVariants returns the spellings each term is matched in, nil if no term has variants
+func (q *SimpleContentSearchEngine) TermVariants() map[string][]string {
+	var result map[string][]string
+	for _, orClause := range q.OrClauses {
+		for _, term := range orClause.AndTerms {
+			if term.Variants == nil {
+				continue
+			}
+			if result == nil {
+				result = map[string][]string{}
+			}
+			result[term.Pattern] = term.Variants
+		}
+	}
+
+	return result
+}
+
 func (q *SimpleContentSearchEngine) String() string {
 	orClauses := []string{}
 	for _, orClause := range q.OrClauses {
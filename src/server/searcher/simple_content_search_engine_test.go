@@ -1,6 +1,7 @@
 package searcher
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -168,3 +169,29 @@ func TestParseQuerySimple(t *testing.T) {
 		})
 	}
 }
+
+func TestWildcardHighlight(t *testing.T) {
+	line := "func initConfig() { initAll() }"
+
+	// Searches highlight the whole keyword of a wildcard term
+	engine := &SimpleContentSearchEngine{}
+	if err := engine.Compile("init*", false); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	matches := engine.IsLineMatch(line)
+	if len(matches) == 0 || !strings.HasPrefix(line[matches[0][0]:matches[0][1]], "initConfig") {
+		t.Errorf("IsLineMatch() got %v, want the match to cover `initConfig`", matches)
+	}
+	if got := engine.OrClauses[0].AndTerms[0].Regex.NumSubexp(); got != 2 {
+		t.Errorf("search regex got %d groups, want the wildcards not to be captured", got)
+	}
+
+	// Replaces capture the wildcards lazily, so a match never spans the next occurrence of the term
+	engine = &SimpleContentSearchEngine{CaptureWildcards: true}
+	if err := engine.Compile("init*", false); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if got := engine.OrClauses[0].AndTerms[0].Regex.NumSubexp(); got != 3 {
+		t.Errorf("replace regex got %d groups, want the wildcard to be captured", got)
+	}
+}
@@ -0,0 +1,83 @@
+package searcher
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+const (
+	// DefaultSuggestLimit is the number of suggestions returned if the request doesn't set a limit
+	DefaultSuggestLimit = 20
+	// MaxSuggestLimit is the maximum number of suggestions returned
+	MaxSuggestLimit = 200
+	// MaxSuggestKeywords is the maximum number of keywords of a workspace scanned for suggestions
+	// Keywords are scanned in order, so a short prefix is only ranked among its first keywords.
+	MaxSuggestKeywords = 10000
+)
+
+// SuggestKeywords returns the indexed keywords of the workspaces starting with the prefix
+// ranked by the number of documents containing them, then by keyword
+// At most MaxSuggestKeywords keywords of each workspace are ranked, Truncate is set if there are more.
+func SuggestKeywords(workspaces []*workspace.Workspace, req *types.SearchSuggestRequest) types.SearchSuggestResult {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultSuggestLimit
+	}
+	limit = min(limit, MaxSuggestLimit)
+
+	// Keywords are indexed in lower case
+	prefix := strings.ToLower(strings.TrimSpace(req.Prefix))
+
+	// A keyword may be stored in multiple rows, and in multiple workspaces
+	docCounts := map[string]int{}
+	truncate := false
+	for _, ws := range workspaces {
+		count, last := 0, ""
+		fulltext.ScanKeywords(ws.ID, prefix, func(keyword string, doccount int) bool {
+			if keyword != last {
+				if count == MaxSuggestKeywords {
+					truncate = true
+					return false
+				}
+				last = keyword
+				count++
+			}
+			docCounts[keyword] += doccount
+			return true
+		})
+	}
+
+	return types.SearchSuggestResult{
+		Prefix:      req.Prefix,
+		Suggestions: rankSuggestions(docCounts, limit),
+		Truncate:    truncate,
+	}
+}
+
+// rankSuggestions returns at most limit keywords, ranked by document count, then by keyword
+func rankSuggestions(docCounts map[string]int, limit int) []types.SearchSuggestion {
+	suggestions := make([]types.SearchSuggestion, 0, len(docCounts))
+	for keyword, doccount := range docCounts {
+		suggestions = append(suggestions, types.SearchSuggestion{
+			Keyword:   keyword,
+			Documents: doccount,
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Documents != suggestions[j].Documents {
+			return suggestions[i].Documents > suggestions[j].Documents
+		}
+		return suggestions[i].Keyword < suggestions[j].Keyword
+	})
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions
+}
@@ -0,0 +1,69 @@
+package searcher
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestRankSuggestions(t *testing.T) {
+	docCounts := map[string]int{
+		"getconfig":       12,
+		"getconfigpath":   3,
+		"getconfigloader": 3,
+		"getconn":         40,
+	}
+
+	want := []types.SearchSuggestion{
+		{Keyword: "getconn", Documents: 40},
+		{Keyword: "getconfig", Documents: 12},
+		{Keyword: "getconfigloader", Documents: 3},
+	}
+	if got := rankSuggestions(docCounts, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("rankSuggestions() got %v, want %v", got, want)
+	}
+
+	if got := rankSuggestions(map[string]int{}, 3); len(got) != 0 {
+		t.Errorf("rankSuggestions() got %v, want empty", got)
+	}
+}
+
+func TestSuggestKeywords(t *testing.T) {
+	many := []string{}
+	for i := range MaxSuggestKeywords + 1 {
+		many = append(many, fmt.Sprintf("word%05d", i))
+	}
+	workspaces := newIndexedWorkspaces(t,
+		map[string]string{"a.go": "getConfig getConn", "b.go": "getConn getter"},
+		map[string]string{"c.go": "getConfig", "d.go": "getConfig other"},
+		map[string]string{"e.go": strings.Join(many, " ")},
+	)
+
+	// Document counts are summed over the workspaces, the prefix is case-insensitive
+	result := SuggestKeywords(workspaces[:2], &types.SearchSuggestRequest{Prefix: "GetCon", Limit: 5})
+	want := []types.SearchSuggestion{
+		{Keyword: "getconfig", Documents: 3},
+		{Keyword: "getconn", Documents: 2},
+	}
+	if !reflect.DeepEqual(result.Suggestions, want) || result.Truncate {
+		t.Errorf("SuggestKeywords() got %+v, want %v", result, want)
+	}
+
+	result = SuggestKeywords(workspaces[:2], &types.SearchSuggestRequest{Prefix: "get", Limit: 1})
+	if len(result.Suggestions) != 1 || result.Suggestions[0].Keyword != "getconfig" {
+		t.Errorf("SuggestKeywords() got %+v, want getconfig only", result.Suggestions)
+	}
+
+	// The scan stops at MaxSuggestKeywords keywords of a workspace
+	result = SuggestKeywords(workspaces[2:], &types.SearchSuggestRequest{Prefix: "word", Limit: MaxSuggestLimit})
+	if !result.Truncate || len(result.Suggestions) != MaxSuggestLimit {
+		t.Errorf("SuggestKeywords() got %d suggestions, truncate %t, want %d and truncated",
+			len(result.Suggestions), result.Truncate, MaxSuggestLimit)
+	}
+	if result = SuggestKeywords(workspaces[2:], &types.SearchSuggestRequest{Prefix: "word0"}); result.Truncate {
+		t.Error("SuggestKeywords() expected a longer prefix not to be truncated")
+	}
+}
@@ -0,0 +1,74 @@
+package searcher
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// reIdentifier matches a term that could be spelled in other identifier styles
+var reIdentifier = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// splitIdentifier splits an identifier into lower case words
+// Words are separated by `_`, `-` and case changes, e.g. `tab_group`, `tabGroup` and `HTTPServer`
+func splitIdentifier(identifier string) []string {
+	words := []string{}
+	for _, part := range strings.FieldsFunc(identifier, func(r rune) bool { return r == '_' || r == '-' }) {
+		runes := []rune(part)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			prev, cur := runes[i-1], runes[i]
+			// `tabGroup` and `tab2Group` break before `G`, `HTTPServer` breaks before `S`
+			lowerToUpper := (unicode.IsLower(prev) || unicode.IsDigit(prev)) && unicode.IsUpper(cur)
+			acronymEnd := unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if lowerToUpper || acronymEnd {
+				words = append(words, strings.ToLower(string(runes[start:i])))
+				start = i
+			}
+		}
+		words = append(words, strings.ToLower(string(runes[start:])))
+	}
+
+	return words
+}
+
+// identifierVariants returns the spellings of an identifier in the snake, camel, Pascal, kebab and
+// screaming snake case, the identifier itself comes first. It returns nil if the identifier is a single word.
+func identifierVariants(identifier string) []string {
+	if !reIdentifier.MatchString(identifier) {
+		return nil
+	}
+
+	words := splitIdentifier(identifier)
+	if len(words) < 2 {
+		return nil
+	}
+
+	var title = func(word string) string {
+		return strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	pascal := ""
+	for _, word := range words {
+		pascal += title(word)
+	}
+	camel := words[0] + pascal[len(words[0]):]
+
+	variants := []string{}
+	known := map[string]struct{}{}
+	for _, variant := range []string{
+		identifier,
+		strings.Join(words, "_"),
+		camel,
+		pascal,
+		strings.Join(words, "-"),
+		strings.ToUpper(strings.Join(words, "_")),
+	} {
+		if _, ok := known[variant]; !ok {
+			known[variant] = struct{}{}
+			variants = append(variants, variant)
+		}
+	}
+
+	return variants
+}
@@ -0,0 +1,84 @@
+package searcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := []struct {
+		identifier string
+		want       []string
+	}{
+		{"tab_group", []string{"tab", "group"}},
+		{"tabGroup", []string{"tab", "group"}},
+		{"TabGroup", []string{"tab", "group"}},
+		{"tab-group", []string{"tab", "group"}},
+		{"TAB_GROUP", []string{"tab", "group"}},
+		{"HTTPServer", []string{"http", "server"}},
+		{"getHTTPResponse2", []string{"get", "http", "response2"}},
+		{"tab2Group", []string{"tab2", "group"}},
+		{"__init__", []string{"init"}},
+		{"mutex", []string{"mutex"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitIdentifier(tt.identifier); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitIdentifier(%q) got %v, want %v", tt.identifier, got, tt.want)
+		}
+	}
+}
+
+func TestIdentifierVariants(t *testing.T) {
+	want := []string{"tabGroup", "tab_group", "TabGroup", "tab-group", "TAB_GROUP"}
+	if got := identifierVariants("tabGroup"); !reflect.DeepEqual(got, want) {
+		t.Errorf("identifierVariants() got %v, want %v", got, want)
+	}
+
+	want = []string{"HTTPServer", "http_server", "httpServer", "HttpServer", "http-server", "HTTP_SERVER"}
+	if got := identifierVariants("HTTPServer"); !reflect.DeepEqual(got, want) {
+		t.Errorf("identifierVariants() got %v, want %v", got, want)
+	}
+
+	for _, identifier := range []string{"mutex", "tab.group", "tab*group"} {
+		if got := identifierVariants(identifier); got != nil {
+			t.Errorf("identifierVariants(%q) got %v, want nil", identifier, got)
+		}
+	}
+}
+
+func TestCompileVariants(t *testing.T) {
+	engine := &SimpleContentSearchEngine{Variants: true}
+	if err := engine.Compile("tab_group close", true); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	term := engine.OrClauses[0].AndTerms[0]
+	if got := term.prefixes(); !reflect.DeepEqual(got, []string{"tab_group", "tabgroup", "tab-group"}) {
+		t.Errorf("prefixes() got %v", got)
+	}
+
+	want := map[string][]string{"tab_group": {"tab_group", "tabGroup", "TabGroup", "tab-group", "TAB_GROUP"}}
+	if got := engine.TermVariants(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TermVariants() got %v, want %v", got, want)
+	}
+
+	// Single words have no variants
+	if got := engine.OrClauses[0].AndTerms[1].prefixes(); !reflect.DeepEqual(got, []string{"close"}) {
+		t.Errorf("prefixes() got %v", got)
+	}
+
+	for line, want := range map[string][][]int{
+		"tab_group.close()":         {{0, 15}},
+		"this.tabGroup.close()":     {{5, 19}},
+		"TabGroup::close()":         {{0, 15}},
+		".tab-group { close: 0 }":   {{1, 18}},
+		"kTabGroup.close()":         {},
+		"tabgroup.close()":          {},
+		"TAB_GROUP_CLOSE = close()": {{0, 23}},
+	} {
+		if got := engine.IsLineMatch(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("IsLineMatch(%q) got %v, want %v", line, got, want)
+		}
+	}
+}
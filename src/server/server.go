@@ -12,6 +12,7 @@ import (
 	"github.com/codetrek/haystack/server/indexer"
 	"github.com/codetrek/haystack/server/searcher"
 	"github.com/codetrek/haystack/server/server"
+	"github.com/codetrek/haystack/shared/auth"
 	"github.com/codetrek/haystack/shared/running"
 )
 
@@ -45,12 +46,23 @@ func Run() {
 
 	indexer.Run(wg)
 	searcher.Run(wg)
+	watchConfig(wg)
 
 	if conf.Get().ForTest.Path != "" {
 		indexer.SyncIfNeeded(conf.Get().ForTest.Path)
 	}
 
-	server.StartServer(wg, fmt.Sprintf("127.0.0.1:%d", conf.Get().Global.Port))
+	addr, socketFile := "", ""
+	if !conf.Get().Global.DisableTCP {
+		addr = fmt.Sprintf("127.0.0.1:%d", conf.Get().Global.Port)
+	}
+	if conf.Get().Global.UnixSocket {
+		socketFile = running.SocketFile()
+	}
+	if err := auth.EnsureDefaultToken(); err != nil {
+		log.Fatalf("Failed to generate the API token: %v", err)
+	}
+	server.StartServer(wg, addr, socketFile)
 
 	wg.Wait()
 	fulltext.CloseAndWait()
@@ -0,0 +1,349 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/auth"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+const (
+	apiV2Prefix     = "/api/v2/"
+	requestIDHeader = "X-Request-Id"
+
+	// minRequestBytes is the body limit of the requests, it's raised to fit an overlay of the max file size
+	minRequestBytes = 1024 * 1024
+)
+
+// errorStatuses are the HTTP statuses of the error codes
+var errorStatuses = map[string]int{
+	types.ErrorCodeInvalidRequest:    http.StatusBadRequest,
+	types.ErrorCodeInvalidPath:       http.StatusBadRequest,
+	types.ErrorCodeUnauthorized:      http.StatusUnauthorized,
+	types.ErrorCodeForbidden:         http.StatusForbidden,
+	types.ErrorCodeNotFound:          http.StatusNotFound,
+	types.ErrorCodeWorkspaceNotFound: http.StatusNotFound,
+	types.ErrorCodeMethodNotAllowed:  http.StatusMethodNotAllowed,
+	types.ErrorCodeWorkspaceExists:   http.StatusConflict,
+	types.ErrorCodeRequestTooLarge:   http.StatusRequestEntityTooLarge,
+	types.ErrorCodeInvalidConfig:     http.StatusUnprocessableEntity,
+	types.ErrorCodeInternal:          http.StatusInternalServerError,
+}
+
+type requestIDContextKey struct{}
+
+// apiError is an error responded by /api/v2 with its code
+type apiError struct {
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func newAPIError(code string, format string, args ...any) *apiError {
+	return &apiError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// apiErrorOf converts err to an API error, the errors which are not known are of the fallback code
+func apiErrorOf(err error, fallback string) *apiError {
+	var apiErr *apiError
+	var pathErr *workspace.PathError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &pathErr):
+		return &apiError{code: types.ErrorCodeInvalidPath, message: err.Error()}
+	case errors.As(err, &maxBytesErr):
+		return newAPIError(types.ErrorCodeRequestTooLarge, "request body exceeds %d bytes", maxBytesErr.Limit)
+	case errors.Is(err, workspace.ErrNotFound):
+		return &apiError{code: types.ErrorCodeWorkspaceNotFound, message: err.Error()}
+	case errors.Is(err, workspace.ErrExists):
+		return &apiError{code: types.ErrorCodeWorkspaceExists, message: err.Error()}
+	case errors.Is(err, conf.ErrInvalidConfig):
+		return &apiError{code: types.ErrorCodeInvalidConfig, message: err.Error()}
+	default:
+		return &apiError{code: fallback, message: err.Error()}
+	}
+}
+
+// apiRoute is an endpoint of /api/v2, the routes are also described by the OpenAPI document
+// The handler returns the data of the response or an error, request is nil if the endpoint has no body, and
+// stream is set for the endpoints writing their responses themselves.
+type apiRoute struct {
+	method   string
+	path     string
+	summary  string
+	scope    auth.Scope
+	status   int
+	request  reflect.Type
+	response reflect.Type
+	stream   bool
+	handler  func(w http.ResponseWriter, r *http.Request) (any, error)
+}
+
+// newRoute creates a route without a request body, response is a value of the type of the data
+func newRoute(method, path, summary string, scope auth.Scope, status int, response any,
+	handler func(r *http.Request) (any, error)) *apiRoute {
+	return &apiRoute{
+		method:   method,
+		path:     path,
+		summary:  summary,
+		scope:    scope,
+		status:   status,
+		response: reflect.TypeOf(response),
+		handler: func(w http.ResponseWriter, r *http.Request) (any, error) {
+			return handler(r)
+		},
+	}
+}
+
+// newBodyRoute creates a route whose request body is decoded as T
+func newBodyRoute[T any](method, path, summary string, scope auth.Scope, status int, response any,
+	handler func(r *http.Request, request *T) (any, error)) *apiRoute {
+	return &apiRoute{
+		method:   method,
+		path:     path,
+		summary:  summary,
+		scope:    scope,
+		status:   status,
+		request:  reflect.TypeFor[T](),
+		response: reflect.TypeOf(response),
+		handler: func(w http.ResponseWriter, r *http.Request) (any, error) {
+			var request T
+			if err := decodeRequest(r, &request); err != nil {
+				return nil, err
+			}
+			return handler(r, &request)
+		},
+	}
+}
+
+// newStreamRoute creates a route whose handler writes the response once the request is decoded and validated
+// response is a value of the type of the records of the stream.
+func newStreamRoute[T any](method, path, summary string, scope auth.Scope, response any,
+	handler func(w http.ResponseWriter, r *http.Request, request *T) error) *apiRoute {
+	return &apiRoute{
+		method:   method,
+		path:     path,
+		summary:  summary,
+		scope:    scope,
+		status:   http.StatusOK,
+		request:  reflect.TypeFor[T](),
+		response: reflect.TypeOf(response),
+		stream:   true,
+		handler: func(w http.ResponseWriter, r *http.Request) (any, error) {
+			var request T
+			if err := decodeRequest(r, &request); err != nil {
+				return nil, err
+			}
+			return nil, handler(w, r, &request)
+		},
+	}
+}
+
+// decodeRequest decodes the JSON body of the request
+func decodeRequest(r *http.Request, request any) error {
+	err := json.NewDecoder(r.Body).Decode(request)
+	if errors.Is(err, io.EOF) {
+		return newAPIError(types.ErrorCodeInvalidRequest, "request body is required")
+	} else if err != nil {
+		if apiErr := apiErrorOf(err, types.ErrorCodeInvalidRequest); apiErr.code != types.ErrorCodeInvalidRequest {
+			return apiErr
+		}
+		return newAPIError(types.ErrorCodeInvalidRequest, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+// apiRouter routes the requests of /api/v2 by their paths and methods
+type apiRouter struct {
+	routes []*apiRoute
+	paths  map[string]map[string]*apiRoute
+}
+
+func newAPIRouter(routes []*apiRoute) *apiRouter {
+	router := &apiRouter{
+		routes: routes,
+		paths:  map[string]map[string]*apiRoute{},
+	}
+	for _, route := range routes {
+		if router.paths[route.path] == nil {
+			router.paths[route.path] = map[string]*apiRoute{}
+		}
+		router.paths[route.path][route.method] = route
+	}
+	return router
+}
+
+// find returns the routes of the path by their methods
+func (a *apiRouter) find(path string) map[string]*apiRoute {
+	return a.paths[path]
+}
+
+func (a *apiRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	methods := a.find(r.URL.Path)
+	if methods == nil {
+		writeAPIError(w, r, newAPIError(types.ErrorCodeNotFound, "%s is not found", r.URL.Path))
+		return
+	}
+
+	route := methods[r.Method]
+	if route == nil {
+		allowed := make([]string, 0, len(methods))
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeAPIError(w, r, newAPIError(types.ErrorCodeMethodNotAllowed, "method %s is not allowed, use %s",
+			r.Method, strings.Join(allowed, ", ")))
+		return
+	}
+
+	data, err := route.handler(w, r)
+	if err != nil {
+		writeAPIError(w, r, apiErrorOf(err, types.ErrorCodeInternal))
+		return
+	}
+	if route.stream {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(route.status)
+	if err := json.NewEncoder(w).Encode(types.APIResponse{Data: data}); err != nil {
+		log.Printf("Failed to write response of %s: %v", r.URL.Path, err)
+	}
+}
+
+// writeAPIError writes the error with the HTTP status of its code
+func writeAPIError(w http.ResponseWriter, r *http.Request, err *apiError) {
+	status, ok := errorStatuses[err.code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(types.APIErrorResponse{
+		Error: types.APIError{
+			Code:      err.code,
+			Message:   err.message,
+			RequestID: requestID(w, r),
+		},
+	})
+}
+
+// requestID returns the ID of the request, one is generated and set to the response if it has no ID yet
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDContextKey{}).(string); ok {
+		return id
+	}
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		return id
+	}
+
+	id := newRequestID()
+	w.Header().Set(requestIDHeader, id)
+	return id
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	data := make([]byte, 8)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+// validRequestID returns true if the ID of a client could be used, so it's safe to be logged
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder records the status of the response for the access log and the panic recovery
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// apiMiddleware assigns the request ID, limits the request body, recovers from panics and logs the requests
+func apiMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id))
+
+		limit := max(int64(minRequestBytes), conf.Get().Server.MaxFileSize+64*1024)
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("Recovered from panic of %s %s, request %s: %v\n%s", r.Method, r.URL.Path, id, err,
+					debug.Stack())
+				// The error could only be written if the response is not started
+				if recorder.status == 0 {
+					writeAPIError(recorder, r, newAPIError(types.ErrorCodeInternal, "internal server error"))
+				}
+			}
+			log.Printf("API %s %s: %d, took %s, request %s", r.Method, r.URL.Path, recorder.status,
+				time.Since(start), id)
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
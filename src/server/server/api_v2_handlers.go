@@ -0,0 +1,370 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/server/searcher"
+	"github.com/codetrek/haystack/shared/auth"
+	"github.com/codetrek/haystack/shared/running"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// apiV2 is the router of /api/v2, it's created when the server starts
+var apiV2 *apiRouter
+
+// apiV2Routes returns the endpoints of /api/v2, the endpoints of the public scope "" need no token
+func apiV2Routes() []*apiRoute {
+	get, post := http.MethodGet, http.MethodPost
+	search, admin := auth.ScopeSearch, auth.ScopeAdmin
+	ok, created, accepted := http.StatusOK, http.StatusCreated, http.StatusAccepted
+
+	return []*apiRoute{
+		newRoute(get, "/api/v2/openapi.json", "Get the OpenAPI document of /api/v2", "", ok,
+			map[string]any{}, v2OpenAPI),
+
+		newRoute(get, "/api/v2/server/status", "Get the status of the server", search, ok,
+			types.ServerStatus{}, v2ServerStatus),
+		newRoute(post, "/api/v2/server/restart", "Restart the server", admin, accepted,
+			types.APIMessage{}, v2RestartServer),
+		newRoute(post, "/api/v2/server/stop", "Stop the server", admin, accepted,
+			types.APIMessage{}, v2StopServer),
+		newRoute(post, "/api/v2/server/reload", "Reload the configuration file, an invalid one isn't applied",
+			admin, ok, types.ConfigReloadResult{}, v2ReloadConfig),
+
+		newRoute(get, "/api/v2/workspace/list", "List the workspaces", search, ok,
+			types.Workspaces{}, v2ListWorkspaces),
+		newBodyRoute(post, "/api/v2/workspace/get", "Get a workspace with its indexing status", search, ok,
+			types.Workspace{}, v2GetWorkspace),
+		newBodyRoute(post, "/api/v2/workspace/create", "Create a workspace and index it", admin, created,
+			types.Workspace{}, v2CreateWorkspace),
+		newBodyRoute(post, "/api/v2/workspace/update", "Update the filters of a workspace", admin, ok,
+			types.Workspace{}, v2UpdateWorkspace),
+		newBodyRoute(post, "/api/v2/workspace/delete", "Delete a workspace and its index", admin, ok,
+			types.Workspace{}, v2DeleteWorkspace),
+		newBodyRoute(post, "/api/v2/workspace/sync", "Re-index the changed files of a workspace", admin, accepted,
+			types.APIMessage{}, v2SyncWorkspace),
+		newRoute(post, "/api/v2/workspace/sync-all", "Re-index the changed files of all workspaces", admin, accepted,
+			types.APIMessage{}, v2SyncAllWorkspaces),
+
+		newBodyRoute(post, "/api/v2/document/update", "Re-index a file of a workspace", admin, accepted,
+			types.APIMessage{}, v2UpdateDocument),
+		newBodyRoute(post, "/api/v2/document/delete", "Remove a file from the index of a workspace", admin, ok,
+			types.APIMessage{}, v2DeleteDocument),
+		newBodyRoute(post, "/api/v2/document/overlay/set", "Search an unsaved editor buffer instead of its file",
+			admin, ok, types.OverlayResult{}, v2SetOverlay),
+		newBodyRoute(post, "/api/v2/document/overlay/clear", "Remove the overlays of files", admin, ok,
+			types.OverlayResult{}, v2ClearOverlays),
+		newBodyRoute(post, "/api/v2/document/overlay/list", "List the overlays of a workspace", search, ok,
+			types.OverlayResult{}, v2ListOverlays),
+
+		newBodyRoute(post, "/api/v2/search/content", "Search the content of files", search, ok,
+			types.SearchContentResults{}, v2SearchContent),
+		newStreamRoute(post, "/api/v2/search/content/stream", "Search the content of files, streaming the "+
+			"results in the order their files are matched as NDJSON, or SSE events if `text/event-stream` "+
+			"is accepted", search,
+			types.SearchContentStreamRecord{}, v2SearchContentStream),
+		newBodyRoute(post, "/api/v2/search/files", "Search the files by their paths", search, ok,
+			types.SearchFilesResult{}, v2SearchFiles),
+		newBodyRoute(post, "/api/v2/search/suggest", "Suggest the indexed keywords starting with a prefix", search, ok,
+			types.SearchSuggestResult{}, v2SearchSuggest),
+
+		newBodyRoute(post, "/api/v2/replace/preview", "Preview the replacement of the matches of a search", search, ok,
+			types.ReplacePreviewResult{}, v2PreviewReplace),
+		newBodyRoute(post, "/api/v2/replace/apply", "Rewrite the files of a replacement preview", admin, ok,
+			types.ReplaceApplyResult{}, v2ApplyReplace),
+	}
+}
+
+// workspaceInfo returns the information of the workspace responded by the API
+func workspaceInfo(ws *workspace.Workspace) types.Workspace {
+	return types.Workspace{
+		ID:               ws.ID,
+		Path:             ws.Path,
+		TotalFiles:       ws.GetTotalFiles(),
+		UseGlobalFilters: ws.UseGlobalFilters,
+		Filters:          ws.Filters,
+		CreatedAt:        ws.CreatedAt,
+		LastAccessed:     ws.LastAccessed,
+		LastFullSync:     ws.LastFullSync,
+		Indexing:         ws.GetIndexingStatus() != nil,
+	}
+}
+
+// getWorkspace returns the workspace of the absolute path of a request
+func getWorkspace(path string) (*workspace.Workspace, error) {
+	if path == "" {
+		return nil, newAPIError(types.ErrorCodeInvalidRequest, "workspace is required")
+	}
+	if !filepath.IsAbs(path) {
+		return nil, newAPIError(types.ErrorCodeInvalidRequest, "workspace must be an absolute path")
+	}
+	return workspace.GetByPath(path)
+}
+
+func v2OpenAPI(r *http.Request) (any, error) {
+	return openAPIDocument(apiV2.routes), nil
+}
+
+func v2ServerStatus(r *http.Request) (any, error) {
+	cacheStats := searcher.CacheStats()
+	return types.ServerStatus{
+		ShuttingDown: running.IsShuttingDown(),
+		Restarting:   running.IsRestart(),
+		PID:          os.Getpid(),
+		Version:      running.Version(),
+		DataPath:     conf.Get().Global.DataPath,
+		SearchCache:  &cacheStats,
+	}, nil
+}
+
+// The server waits for the response to be written before it's stopped
+func v2RestartServer(r *http.Request) (any, error) {
+	log.Println("Server restart requested")
+	running.Restart()
+	return types.APIMessage{Message: "restarting"}, nil
+}
+
+func v2StopServer(r *http.Request) (any, error) {
+	log.Println("Server stop requested")
+	running.Shutdown()
+	return types.APIMessage{Message: "stopping"}, nil
+}
+
+func v2ReloadConfig(r *http.Request) (any, error) {
+	return ReloadConfig("API")
+}
+
+func v2ListWorkspaces(r *http.Request) (any, error) {
+	return types.Workspaces{Workspaces: workspace.GetAll()}, nil
+}
+
+func v2GetWorkspace(r *http.Request, request *types.GetWorkspaceRequest) (any, error) {
+	ws, err := getWorkspace(request.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	return workspaceInfo(ws), nil
+}
+
+func v2CreateWorkspace(r *http.Request, request *types.CreateWorkspaceRequest) (any, error) {
+	if _, err := getWorkspace(request.Workspace); err == nil {
+		return nil, workspace.ErrExists
+	} else if !errors.Is(err, workspace.ErrNotFound) {
+		return nil, err
+	}
+
+	ws, err := indexer.CreateWorkspace(request.Workspace, request.UseGlobalFilters, request.Filters)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+
+	log.Printf("Created workspace `%s`", ws.Path)
+	return workspaceInfo(ws), nil
+}
+
+func v2UpdateWorkspace(r *http.Request, request *types.UpdateWorkspaceRequest) (any, error) {
+	ws, err := getWorkspace(request.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.UseGlobalFilters = request.UseGlobalFilters
+	ws.Filters = request.Filters
+	if err := ws.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save workspace: %v", err)
+	}
+
+	log.Printf("Updated workspace `%s`", ws.Path)
+	return workspaceInfo(ws), nil
+}
+
+func v2DeleteWorkspace(r *http.Request, request *types.DeleteWorkspaceRequest) (any, error) {
+	ws, err := getWorkspace(request.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	info := workspaceInfo(ws)
+	if err := workspace.Delete(ws.ID); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Deleted workspace `%s`", ws.Path)
+	info.Indexing = false
+	return info, nil
+}
+
+func v2SyncWorkspace(r *http.Request, request *types.SyncWorkspaceRequest) (any, error) {
+	ws, err := getWorkspace(request.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := indexer.Sync(ws); err != nil {
+		return nil, fmt.Errorf("failed to sync workspace: %v", err)
+	}
+	return types.APIMessage{Message: "sync in progress"}, nil
+}
+
+func v2SyncAllWorkspaces(r *http.Request) (any, error) {
+	for _, workspacePath := range workspace.GetAllPaths() {
+		if ws, err := workspace.GetByPath(workspacePath); err == nil {
+			indexer.Sync(ws)
+		}
+	}
+	return types.APIMessage{Message: "sync all in progress"}, nil
+}
+
+func v2UpdateDocument(r *http.Request, request *types.DocumentUpdateRequest) (any, error) {
+	ws, err := getWorkspace(request.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	relPath, err := ws.ResolveFilePath(request.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := indexer.AddOrSyncFile(ws, relPath); err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+	return types.APIMessage{Message: "update in progress"}, nil
+}
+
+func v2DeleteDocument(r *http.Request, request *types.DocumentDeleteRequest) (any, error) {
+	ws, err := getWorkspace(request.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	relPath, err := ws.ResolveFilePath(request.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := indexer.RemoveFile(ws, relPath); err != nil {
+		return nil, err
+	}
+	return types.APIMessage{Message: "deleted"}, nil
+}
+
+// overlayResult runs an overlay operation on the workspace and returns the active overlays of it
+func overlayResult(workspacePath string,
+	operation func(ws *workspace.Workspace) ([]types.Overlay, error)) (any, error) {
+	ws, err := getWorkspace(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+
+	overlays, err := operation(ws)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+	return types.OverlayResult{Workspace: ws.Path, Overlays: overlays}, nil
+}
+
+func v2SetOverlay(r *http.Request, request *types.OverlaySetRequest) (any, error) {
+	return overlayResult(request.Workspace, func(ws *workspace.Workspace) ([]types.Overlay, error) {
+		return searcher.SetOverlay(ws, request)
+	})
+}
+
+func v2ClearOverlays(r *http.Request, request *types.OverlayClearRequest) (any, error) {
+	return overlayResult(request.Workspace, func(ws *workspace.Workspace) ([]types.Overlay, error) {
+		return searcher.ClearOverlays(ws, request.Paths)
+	})
+}
+
+func v2ListOverlays(r *http.Request, request *types.OverlayListRequest) (any, error) {
+	return overlayResult(request.Workspace, func(ws *workspace.Workspace) ([]types.Overlay, error) {
+		return searcher.ListOverlays(ws), nil
+	})
+}
+
+func v2SearchContent(r *http.Request, request *types.SearchContentRequest) (any, error) {
+	workspaces, err := validateSearchContentRequest(request)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+	return searcher.SearchContent(r.Context(), workspaces, request), nil
+}
+
+// Invalid requests are responded as errors before the stream is started
+func v2SearchContentStream(w http.ResponseWriter, r *http.Request, request *types.SearchContentRequest) error {
+	workspaces, err := validateSearchContentRequest(request)
+	if err != nil {
+		return apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+
+	streamSearchContent(w, r, request, workspaces, nil)
+	return nil
+}
+
+func v2SearchFiles(r *http.Request, request *types.SearchFilesRequest) (any, error) {
+	workspaces, err := resolveWorkspaces(request.Workspace, request.Workspaces)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+	if request.Query == "" {
+		return nil, newAPIError(types.ErrorCodeInvalidRequest, "query is required")
+	}
+	if err := searcher.ValidateFilters(workspaces, request.Filters); err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+
+	result, err := searcher.SearchFiles(r.Context(), workspaces, request)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+	return result, nil
+}
+
+func v2SearchSuggest(r *http.Request, request *types.SearchSuggestRequest) (any, error) {
+	workspaces, err := resolveWorkspaces(request.Workspace, request.Workspaces)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+	if strings.TrimSpace(request.Prefix) == "" {
+		return nil, newAPIError(types.ErrorCodeInvalidRequest, "prefix is required")
+	}
+	return searcher.SuggestKeywords(workspaces, request), nil
+}
+
+func v2PreviewReplace(r *http.Request, request *types.ReplaceRequest) (any, error) {
+	workspaces, err := validateSearchContentRequest(&request.SearchContentRequest)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+
+	result, err := searcher.PreviewReplace(r.Context(), workspaces, request)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+	return result, nil
+}
+
+func v2ApplyReplace(r *http.Request, request *types.ReplaceApplyRequest) (any, error) {
+	workspaces, err := validateSearchContentRequest(&request.SearchContentRequest)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+
+	result, err := searcher.ApplyReplace(workspaces, request)
+	if err != nil {
+		return nil, apiErrorOf(err, types.ErrorCodeInvalidRequest)
+	}
+
+	log.Printf("Replaced %d matches in %d files, %d conflicts", result.TotalReplacements, len(result.Files),
+		len(result.Conflicts))
+	return result, nil
+}
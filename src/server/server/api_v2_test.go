@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/auth"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+func TestAPIV2(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "haystack-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	conf.Get().Global.DataPath = filepath.Join(tempDir, "data")
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer fulltext.CloseAndWait()
+	if err := workspace.Init(); err != nil {
+		t.Fatalf("Workspace Init failed: %v", err)
+	}
+
+	wsPath := filepath.Join(tempDir, "ws")
+	if err := os.MkdirAll(wsPath, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	ws, err := workspace.Create(wsPath)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer workspace.Delete(ws.ID)
+
+	routes := apiV2Routes()
+	routes = append(routes, newRoute(http.MethodGet, "/api/v2/panic", "Panic", auth.ScopeSearch, http.StatusOK,
+		types.APIMessage{}, func(r *http.Request) (any, error) {
+			panic("test panic")
+		}))
+	apiV2 = newAPIRouter(routes)
+	defer func() { apiV2 = nil }()
+	handler := apiMiddleware(apiV2)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"list workspaces", http.MethodGet, "/api/v2/workspace/list", "", http.StatusOK, ""},
+		{"unknown path", http.MethodGet, "/api/v2/nothing", "", http.StatusNotFound, types.ErrorCodeNotFound},
+		{"wrong method", http.MethodGet, "/api/v2/workspace/get", "", http.StatusMethodNotAllowed,
+			types.ErrorCodeMethodNotAllowed},
+		{"no body", http.MethodPost, "/api/v2/workspace/get", "", http.StatusBadRequest,
+			types.ErrorCodeInvalidRequest},
+		{"bad body", http.MethodPost, "/api/v2/workspace/get", "{", http.StatusBadRequest,
+			types.ErrorCodeInvalidRequest},
+		{"get workspace", http.MethodPost, "/api/v2/workspace/get", jsonOf(t, types.GetWorkspaceRequest{
+			Workspace: wsPath}), http.StatusOK, ""},
+		{"missing workspace", http.MethodPost, "/api/v2/workspace/get", jsonOf(t, types.GetWorkspaceRequest{
+			Workspace: filepath.Join(tempDir, "missing")}), http.StatusNotFound, types.ErrorCodeWorkspaceNotFound},
+		{"existing workspace", http.MethodPost, "/api/v2/workspace/create", jsonOf(t, types.CreateWorkspaceRequest{
+			Workspace: wsPath}), http.StatusConflict, types.ErrorCodeWorkspaceExists},
+		{"escaping path", http.MethodPost, "/api/v2/document/overlay/set", jsonOf(t, types.OverlaySetRequest{
+			Workspace: wsPath, Path: "../secret.go", Content: "x"}), http.StatusBadRequest,
+			types.ErrorCodeInvalidPath},
+		{"no query", http.MethodPost, "/api/v2/search/content", jsonOf(t, types.SearchContentRequest{
+			Workspace: wsPath}), http.StatusBadRequest, types.ErrorCodeInvalidRequest},
+		{"invalid stream", http.MethodPost, "/api/v2/search/content/stream", jsonOf(t, searchRequest(wsPath,
+			"../x")), http.StatusBadRequest, types.ErrorCodeInvalidPath},
+		{"too large", http.MethodPost, "/api/v2/search/content", `{"query":"` +
+			strings.Repeat("a", int(conf.Get().Server.MaxFileSize)+minRequestBytes) + `"}`,
+			http.StatusRequestEntityTooLarge, types.ErrorCodeRequestTooLarge},
+		{"panic", http.MethodGet, "/api/v2/panic", "", http.StatusInternalServerError, types.ErrorCodeInternal},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d, body %s", tt.name, recorder.Code, tt.status, recorder.Body)
+			continue
+		}
+		id := recorder.Header().Get(requestIDHeader)
+		if id == "" {
+			t.Errorf("%s: no request ID", tt.name)
+		}
+		if tt.code == "" {
+			continue
+		}
+
+		var response types.APIErrorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Errorf("%s: invalid error response %s", tt.name, recorder.Body)
+			continue
+		}
+		if response.Error.Code != tt.code || response.Error.RequestID != id {
+			t.Errorf("%s: error = %+v, want code %s and request ID %s", tt.name, response.Error, tt.code, id)
+		}
+	}
+
+	// The Allow header lists the methods of the path, and the ID of the client is kept
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/api/v2/search/content", nil)
+	request.Header.Set(requestIDHeader, "client-id.1")
+	handler.ServeHTTP(recorder, request)
+	if allow := recorder.Header().Get("Allow"); allow != http.MethodPost {
+		t.Errorf("Allow = %q, want %q", allow, http.MethodPost)
+	}
+	if id := recorder.Header().Get(requestIDHeader); id != "client-id.1" {
+		t.Errorf("request ID = %q, want the ID of the client", id)
+	}
+
+	// Every route is described by the OpenAPI document
+	document := openAPIDocument(apiV2.routes)
+	paths := document["paths"].(map[string]any)
+	for _, route := range apiV2.routes {
+		operations, _ := paths[route.path].(map[string]any)
+		if operations[strings.ToLower(route.method)] == nil {
+			t.Errorf("OpenAPI document has no operation %s %s", route.method, route.path)
+		}
+	}
+	if _, err := json.Marshal(document); err != nil {
+		t.Errorf("Marshal OpenAPI document failed: %v", err)
+	}
+}
+
+func TestAPIErrorOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{workspace.ErrNotFound, types.ErrorCodeWorkspaceNotFound},
+		{workspace.ErrExists, types.ErrorCodeWorkspaceExists},
+		{&workspace.PathError{Path: "..", Err: workspace.ErrPathTraversal}, types.ErrorCodeInvalidPath},
+		{&http.MaxBytesError{Limit: 1}, types.ErrorCodeRequestTooLarge},
+		{newAPIError(types.ErrorCodeForbidden, "forbidden"), types.ErrorCodeForbidden},
+		{errors.New("other"), types.ErrorCodeInternal},
+	}
+
+	for _, tt := range tests {
+		if code := apiErrorOf(tt.err, types.ErrorCodeInternal).code; code != tt.code {
+			t.Errorf("apiErrorOf(%v) = %s, want %s", tt.err, code, tt.code)
+		}
+	}
+}
+
+func jsonOf(t *testing.T, value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/codetrek/haystack/shared/auth"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+type tokenContextKey struct{}
+
+// searchScopePaths are the APIs the tokens of the search scope could call, the others require the admin scope
+// A path ending with "/" matches all the paths under it.
+var searchScopePaths = []string{
+	"/api/v1/server/status",
+	"/api/v1/workspace/list",
+	"/api/v1/workspace/get",
+	"/api/v1/document/overlay/list",
+	"/api/v1/search/",
+	"/api/v1/replace/preview",
+	"/api/v1/mcp/message",
+	"/mcp/",
+}
+
+// publicPaths are served without a token
+var publicPaths = map[string]bool{
+	"/health": true,
+}
+
+// requiredScope returns the scope required to call the path with the method, "" if no token is required
+// The routes of /api/v2 declare their scopes, the unknown ones require a token to get their errors.
+func requiredScope(method, path string) auth.Scope {
+	if publicPaths[path] {
+		return ""
+	}
+	if strings.HasPrefix(path, apiV2Prefix) {
+		if route := apiV2.find(path)[method]; route != nil {
+			return route.scope
+		}
+		return auth.ScopeSearch
+	}
+
+	for _, prefix := range searchScopePaths {
+		if path == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix)) {
+			return auth.ScopeSearch
+		}
+	}
+	return auth.ScopeAdmin
+}
+
+// requireToken rejects the requests without a bearer token allowed to call the path
+// The token is added to the context of the request, so the MCP tools could check its scope.
+func requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The CORS preflight requests of browsers never carry the token
+		preflight := r.Method == http.MethodOptions && r.URL.Path == "/mcp/stream"
+		scope := requiredScope(r.Method, r.URL.Path)
+		if scope == "" || preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The errors of /api/v2 are JSON objects like its other errors
+		v2 := strings.HasPrefix(r.URL.Path, apiV2Prefix)
+		value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		token := auth.Authenticate(strings.TrimSpace(value))
+		if !ok || token == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="haystack"`)
+			if v2 {
+				writeAPIError(w, r, newAPIError(types.ErrorCodeUnauthorized, "a valid bearer token is required"))
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !token.Scope.Allows(scope) {
+			message := fmt.Sprintf("token %s of scope %s can't call %s", token.Name, token.Scope, r.URL.Path)
+			if v2 {
+				writeAPIError(w, r, newAPIError(types.ErrorCodeForbidden, "%s", message))
+				return
+			}
+			http.Error(w, "Forbidden, "+message, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token)))
+	})
+}
+
+// checkToolScope returns an error if the token of the MCP request isn't allowed to call the tool
+// Every transport is served behind requireToken, the stdio one forwards its calls with the default token,
+// so a call without a token is denied rather than trusted.
+func checkToolScope(ctx context.Context, tool ToolName, required auth.Scope) error {
+	token, ok := ctx.Value(tokenContextKey{}).(*auth.Token)
+	if !ok || token == nil {
+		return fmt.Errorf("a token is required to call %s", tool)
+	}
+	if token.Scope.Allows(required) {
+		return nil
+	}
+	return fmt.Errorf("token %s of scope %s can't call %s", token.Name, token.Scope, tool)
+}
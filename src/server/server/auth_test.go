@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codetrek/haystack/shared/auth"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestRequiredScope(t *testing.T) {
+	apiV2 = newAPIRouter(apiV2Routes())
+	defer func() { apiV2 = nil }()
+
+	get, post := http.MethodGet, http.MethodPost
+	search, admin := auth.ScopeSearch, auth.ScopeAdmin
+	tests := []struct {
+		method string
+		path   string
+		want   auth.Scope
+	}{
+		{get, "/health", ""},
+		{post, "/api/v1/server/restart", admin},
+		{post, "/api/v1/server/stop", admin},
+		{get, "/api/v1/server/status", search},
+		{post, "/api/v1/server/reload", admin},
+		{post, "/api/v1/document/update", admin},
+		{post, "/api/v1/document/delete", admin},
+		{post, "/api/v1/document/overlay/set", admin},
+		{post, "/api/v1/document/overlay/clear", admin},
+		{get, "/api/v1/document/overlay/list", search},
+		{post, "/api/v1/workspace/create", admin},
+		{post, "/api/v1/workspace/delete", admin},
+		{get, "/api/v1/workspace/list", search},
+		{get, "/api/v1/workspace/get", search},
+		{post, "/api/v1/workspace/sync-all", admin},
+		{post, "/api/v1/workspace/sync", admin},
+		{post, "/api/v1/workspace/update", admin},
+		{post, "/api/v1/search/content", search},
+		{post, "/api/v1/search/content/stream", search},
+		{post, "/api/v1/search/files", search},
+		{post, "/api/v1/search/suggest", search},
+		{post, "/api/v1/replace/preview", search},
+		{post, "/api/v1/replace/apply", admin},
+		{post, "/api/v1/mcp/message", search},
+		{get, "/mcp/sse", search},
+		{post, "/mcp/message", search},
+		{post, "/mcp/stream", search},
+		{get, "/api/v1/unknown", admin},
+		// The routes of /api/v2 declare their scopes, the unknown ones only require a token
+		{get, "/api/v2/openapi.json", ""},
+		{get, "/api/v2/server/status", search},
+		{post, "/api/v2/server/stop", admin},
+		{post, "/api/v2/workspace/sync-all", admin},
+		{get, "/api/v2/unknown", search},
+		{post, "/api/v2/server/status", search},
+	}
+
+	for _, tt := range tests {
+		if got := requiredScope(tt.method, tt.path); got != tt.want {
+			t.Errorf("requiredScope(%s, %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// newTestTokens creates the default admin token and a token of the search scope, they are removed on cleanup
+// The token file is only registered once, so it's shared by the tests of the process.
+func newTestTokens(t *testing.T) (string, string) {
+	auth.RegisterTokenFile(filepath.Join(os.TempDir(), fmt.Sprintf("haystack-test-%d", os.Getpid()), "tokens.json"))
+	t.Cleanup(func() { os.RemoveAll(filepath.Dir(auth.TokenFile())) })
+	if err := auth.EnsureDefaultToken(); err != nil {
+		t.Fatalf("EnsureDefaultToken() error = %v", err)
+	}
+
+	searchToken, err := auth.Add("reader", auth.ScopeSearch)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	return auth.DefaultToken(), searchToken.Token
+}
+
+func TestRequireToken(t *testing.T) {
+	adminToken, searchToken := newTestTokens(t)
+	apiV2 = newAPIRouter(apiV2Routes())
+	defer func() { apiV2 = nil }()
+
+	// The next handler responds the name of the token in the context
+	handler := requireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := r.Context().Value(tokenContextKey{}).(*auth.Token)
+		if token != nil {
+			w.Write([]byte(token.Name))
+		}
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+		body   string
+	}{
+		{"public", http.MethodGet, "/health", "", http.StatusOK, ""},
+		{"missing token", http.MethodPost, "/api/v1/search/content", "", http.StatusUnauthorized, "Unauthorized"},
+		{"invalid token", http.MethodPost, "/api/v1/search/content", "invalid", http.StatusUnauthorized, ""},
+		{"v2 missing token", http.MethodGet, "/api/v2/server/status", "", http.StatusUnauthorized, `"unauthorized"`},
+		{"v2 unknown path", http.MethodGet, "/api/v2/unknown", "", http.StatusUnauthorized, `"unauthorized"`},
+		{"v2 unknown path with token", http.MethodGet, "/api/v2/unknown", searchToken, http.StatusOK, "reader"},
+		{"stream preflight", http.MethodOptions, "/mcp/stream", "", http.StatusOK, ""},
+		{"other preflight", http.MethodOptions, "/api/v1/search/content", "", http.StatusUnauthorized, ""},
+		{"mcp stream", http.MethodPost, "/mcp/stream", "", http.StatusUnauthorized, ""},
+		{"mcp sse", http.MethodGet, "/mcp/sse", searchToken, http.StatusOK, "reader"},
+		{"search", http.MethodPost, "/api/v1/search/content", searchToken, http.StatusOK, "reader"},
+		{"search preview", http.MethodPost, "/api/v1/replace/preview", searchToken, http.StatusOK, "reader"},
+		{"search apply", http.MethodPost, "/api/v1/replace/apply", searchToken, http.StatusForbidden, "Forbidden"},
+		{"search create", http.MethodPost, "/api/v1/workspace/create", searchToken, http.StatusForbidden, "Forbidden"},
+		{"v2 search stop", http.MethodPost, "/api/v2/server/stop", searchToken, http.StatusForbidden, `"forbidden"`},
+		{"admin apply", http.MethodPost, "/api/v1/replace/apply", adminToken, http.StatusOK, auth.DefaultTokenName},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != tt.status || !strings.Contains(recorder.Body.String(), tt.body) {
+			t.Errorf("%s: got status %d and body %q, want %d and %q", tt.name, recorder.Code, recorder.Body,
+				tt.status, tt.body)
+		}
+	}
+}
+
+func TestCheckToolScope(t *testing.T) {
+	adminToken, searchToken := newTestTokens(t)
+	withToken := func(value string) context.Context {
+		return context.WithValue(context.Background(), tokenContextKey{}, auth.Authenticate(value))
+	}
+
+	// Calls without a token are denied, every transport calls the tools with one
+	if err := checkToolScope(context.Background(), HaystackReplace, auth.ScopeSearch); err == nil {
+		t.Errorf("checkToolScope() without a token expected an error")
+	}
+	if err := checkToolScope(withToken(searchToken), HaystackReplace, auth.ScopeAdmin); err == nil {
+		t.Errorf("checkToolScope() of a search token expected an error of the admin scope")
+	}
+	if err := checkToolScope(withToken(searchToken), HaystackReplace, auth.ScopeSearch); err != nil {
+		t.Errorf("checkToolScope() of a search token error = %v", err)
+	}
+	if err := checkToolScope(withToken(adminToken), HaystackReplace, auth.ScopeAdmin); err != nil {
+		t.Errorf("checkToolScope() of the admin token error = %v", err)
+	}
+
+	// The tools check the scope before their arguments
+	for name, call := range map[string]func(ctx context.Context) error{
+		"replace": func(ctx context.Context) error {
+			_, err := replaceToolHandler(ctx, toolRequest(map[string]any{"workspace": "ws", "query": "a",
+				"replacement": "b", "dry_run": false}))
+			return err
+		},
+		"workspace create": func(ctx context.Context) error {
+			_, err := workspacesToolHandler(ctx, toolRequest(map[string]any{"action": "create", "workspace": "ws"}))
+			return err
+		},
+	} {
+		for _, ctx := range []context.Context{context.Background(), withToken(searchToken)} {
+			if err := call(ctx); err == nil || !strings.Contains(err.Error(), "can't call") &&
+				!strings.Contains(err.Error(), "token is required") {
+				t.Errorf("%s got error %v, want the error of the scope", name, err)
+			}
+		}
+	}
+}
+
+// toolRequest returns a request of a tool call with the arguments
+func toolRequest(arguments map[string]any) mcp.CallToolRequest {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = arguments
+	return request
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/codetrek/haystack/server/core/workspace"
 	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/server/searcher"
 	"github.com/codetrek/haystack/shared/types"
 )
 
@@ -27,7 +28,16 @@ func handleUpdateDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = indexer.AddOrSyncFile(workspace, request.Path)
+	relPath, err := workspace.ResolveFilePath(request.Path)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.CommonResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err = indexer.AddOrSyncFile(workspace, relPath)
 	if err != nil {
 		log.Printf("Failed to update `%s` in workspace `%s`: %v", request.Path, workspace.Path, err)
 
@@ -62,7 +72,16 @@ func handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	indexer.RemoveFile(workspace, request.Path)
+	relPath, err := workspace.ResolveFilePath(request.Path)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.CommonResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	indexer.RemoveFile(workspace, relPath)
 	log.Printf("Deleted `%s` in workspace `%s`", request.Path, workspace.Path)
 
 	json.NewEncoder(w).Encode(types.CommonResponse{
@@ -70,3 +89,81 @@ func handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
 		Message: "Ok",
 	})
 }
+
+// handleSetOverlay handles the overlay set endpoint
+// It registers the content of an unsaved editor buffer, which is searched instead of the file on disk
+func handleSetOverlay(w http.ResponseWriter, r *http.Request) {
+	var request types.OverlaySetRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	handleOverlayRequest(w, request.Workspace, func(ws *workspace.Workspace) ([]types.Overlay, error) {
+		return searcher.SetOverlay(ws, &request)
+	})
+}
+
+// handleClearOverlay handles the overlay clear endpoint
+// It removes the overlays of the paths, all overlays of the workspace if no path is given
+func handleClearOverlay(w http.ResponseWriter, r *http.Request) {
+	var request types.OverlayClearRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	handleOverlayRequest(w, request.Workspace, func(ws *workspace.Workspace) ([]types.Overlay, error) {
+		return searcher.ClearOverlays(ws, request.Paths)
+	})
+}
+
+// handleListOverlay handles the overlay list endpoint
+func handleListOverlay(w http.ResponseWriter, r *http.Request) {
+	var request types.OverlayListRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	handleOverlayRequest(w, request.Workspace, func(ws *workspace.Workspace) ([]types.Overlay, error) {
+		return searcher.ListOverlays(ws), nil
+	})
+}
+
+// handleOverlayRequest runs an overlay operation on the workspace and responds the active overlays of it
+func handleOverlayRequest(w http.ResponseWriter, workspacePath string,
+	operation func(ws *workspace.Workspace) ([]types.Overlay, error)) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	ws, err := workspace.GetByPath(workspacePath)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.OverlayResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	overlays, err := operation(ws)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.OverlayResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(types.OverlayResponse{
+		Code:    0,
+		Message: "Ok",
+		Data: &types.OverlayResult{
+			Workspace: ws.Path,
+			Overlays:  overlays,
+		},
+	})
+}
@@ -2,19 +2,22 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
 	"github.com/codetrek/haystack/server/core/workspace"
 	"github.com/codetrek/haystack/server/searcher"
+	"github.com/codetrek/haystack/shared/auth"
 	"github.com/codetrek/haystack/shared/running"
 	"github.com/codetrek/haystack/shared/types"
-	"github.com/codetrek/haystack/utils"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -23,29 +26,64 @@ import (
 type ToolName string
 
 const (
-	HaystackSearch ToolName = "HaystackSearch"
-	HaystackFiles  ToolName = "HaystackFiles"
+	HaystackSearch  ToolName = "HaystackSearch"
+	HaystackFiles   ToolName = "HaystackFiles"
+	HaystackReplace ToolName = "HaystackReplace"
+	HaystackSuggest ToolName = "HaystackSuggest"
+
+	HaystackReadFile   ToolName = "HaystackReadFile"
+	HaystackListDir    ToolName = "HaystackListDir"
+	HaystackWorkspaces ToolName = "HaystackWorkspaces"
 )
 
-// mcpInit initializes and sets up the Model Context Protocol (MCP) server
-func mcpInit() {
-	// Create a new MCP server instance
+// The formats of the results of the search tools
+const (
+	MCPFormatText = "text"
+	MCPFormatJSON = "json"
+)
+
+// newMCPServer creates an MCP server with all tools registered, options are appended to the default ones
+func newMCPServer(opts ...server.ServerOption) *server.MCPServer {
 	mcpServer := server.NewMCPServer(
 		"Haystack",
 		running.Version(),
-		server.WithResourceCapabilities(true, true),
-		server.WithPromptCapabilities(true),
-		server.WithLogging(),
+		append([]server.ServerOption{
+			server.WithResourceCapabilities(true, true),
+			server.WithPromptCapabilities(true),
+			server.WithLogging(),
+		}, opts...)...,
 	)
 
-	// Register MCP tools (framework only, implementations will be added later)
 	registerMCPTools(mcpServer)
+	registerMCPResources(mcpServer)
+	registerMCPPrompts(mcpServer)
+	return mcpServer
+}
+
+// mcpInit initializes and sets up the Model Context Protocol (MCP) server
+func mcpInit() {
+	hooks := &server.Hooks{}
+	hooks.AddOnRegisterSession(removeSSESubscriber)
+	mcpServer := newMCPServer(server.WithHooks(hooks))
+	fulltext.OnDocumentsChanged(resourceSubscriptions.onDocumentsChanged)
+
+	// Tool calls of the stdio transport are forwarded to the daemon
+	http.HandleFunc("/api/v1/mcp/message", func(w http.ResponseWriter, r *http.Request) {
+		handleMCPMessage(mcpServer, w, r)
+	})
+
+	// The Streamable HTTP transport shares the tools with the SSE one
+	streamable := newStreamableHTTPServer(mcpServer)
+	go streamable.runExpiry(mcpSessionExpiryInterval, nil)
+	http.Handle("/mcp/stream", streamable)
 
-	sse := server.NewSSEServer(mcpServer,
-		server.WithBaseURL(fmt.Sprintf("http://localhost:%d", conf.Get().Global.Port)),
-		server.WithBasePath("/mcp"))
+	sse := newSSEServer(mcpServer)
 
 	http.HandleFunc("/mcp/", func(w http.ResponseWriter, r *http.Request) {
+		if !checkMCPOrigin(w, r) {
+			return
+		}
+
 		if strings.HasPrefix(r.URL.Path, "/mcp/sse") {
 			w.Header().Set("Content-Type", "text/event-stream")
 			w.Header().Set("Cache-Control", "no-cache")
@@ -81,10 +119,24 @@ func mcpInit() {
 			}()
 		}
 
+		if serveSSEResourceMessage(sse, mcpServer, w, r) {
+			return
+		}
+
 		sse.ServeHTTP(w, r)
 		log.Printf("MCP request: %s %s", r.Method, r.URL.Path)
 	})
-	log.Println("MCP server initialized at /mcp endpoint")
+	log.Println("MCP server initialized at /mcp/sse and /mcp/stream endpoints")
+}
+
+// newSSEServer creates the server of the SSE transport, the message endpoint it sends to clients is the URL on the
+// port, or only the path if TCP is disabled, so clients connected by the socket resolve it against the SSE URL
+func newSSEServer(mcpServer *server.MCPServer) *server.SSEServer {
+	opts := []server.SSEOption{server.WithBasePath("/mcp")}
+	if !conf.Get().Global.DisableTCP {
+		opts = append(opts, server.WithBaseURL(fmt.Sprintf("http://localhost:%d", conf.Get().Global.Port)))
+	}
+	return server.NewSSEServer(mcpServer, opts...)
 }
 
 // registerMCPTools registers all the MCP tools with the server
@@ -98,14 +150,22 @@ func registerMCPTools(mcpServer *server.MCPServer) {
 		mcp.WithString("query",
 			mcp.Description("The search query. Supports the following syntax features:\n"+
 				"- Basic terms: single words like 'function'\n"+
-				"- Prefix matching: 'func*' matches 'function', 'functional', etc. (wildcard only at end of term)\n"+
+				"- Prefix matching: 'func*' matches 'function', 'functional', etc.\n"+
+				"- Suffix and infix matching: '*Handler' matches identifiers ending with 'Handler', "+
+				"'*Handler*' matches identifiers containing it\n"+
 				"- Logical operators: 'AND' (or space) for conjunction, '|' for OR operator\n"+
-				"- Examples: 'error AND handle', 'create | update', 'init*'"),
+				"- Scope: by default AND terms must appear in order in one line, '@file' matches files containing all "+
+				"terms anywhere, '@window:N' matches all terms within N lines\n"+
+				"- Proximity: 'lock NEAR/3 unlock' matches both terms in any order with at most 3 words in between\n"+
+				"- Fuzzy terms: '~recieve' also matches indexed identifiers within a small edit distance, e.g. 'receive'\n"+
+				"- Examples: 'error AND handle', 'create | update', 'init*', '@file Mutex Unlock'"),
 			mcp.Required(),
 		),
 		mcp.WithString("workspace",
 			mcp.Description("The workspace to search in, normally it's the absolute path to the project directory, "+
-				"e.g. /home/user/projects/project1. Please always passing current workspace path."),
+				"e.g. /home/user/projects/project1. Please always passing current workspace path. "+
+				"Multiple workspaces could be searched at once by a comma separated list of paths, "+
+				"a glob like /home/user/projects/*, or 'all'."),
 			mcp.Required(),
 		),
 		mcp.WithString("path",
@@ -116,6 +176,17 @@ func registerMCPTools(mcpServer *server.MCPServer) {
 			"or *.cc files in all directory.")),
 		mcp.WithString("exclude", mcp.Description("Exclude files from the search. The exclude filter supports glob "+
 			"patterns, separated by comma, e.g. 'test/**/*.go' to exclude all Go test files.")),
+		mcp.WithBoolean("fuzzy", mcp.Description("Make all terms fuzzy to tolerate typos, the indexed identifiers "+
+			"each term is expanded to are listed in the result.")),
+		mcp.WithBoolean("variants", mcp.Description("Match each term in all identifier styles, e.g. 'tab_group' also "+
+			"matches 'tabGroup', 'TabGroup' and 'tab-group', the spellings are listed in the result.")),
+		mcp.WithString("mode", mcp.Description("Set to 'count' to only return the number of hits and files, "+
+			"or 'facets' to also break them down by top-level directory, extension and language, "+
+			"e.g. to assess the impact of a change. Counts are not limited by the limit.")),
+		mcp.WithString("format", mcp.Description("The format of the result, 'text' (default) is a compact listing "+
+			"of the matched lines as grep prints them, 'json' is a JSON object for programs, each file has its "+
+			"workspace, path, truncation and lines with line numbers, matched columns as [start, end) byte offsets "+
+			"and the lines before and after.")),
 		mcp.WithNumber("limit",
 			mcp.Description("Maximum number of results to return. The search will stop once this limit is reached, "+
 				"which can improve performance for large codebases.\n"+
@@ -133,7 +204,9 @@ func registerMCPTools(mcpServer *server.MCPServer) {
 		),
 		mcp.WithString("workspace",
 			mcp.Description("The workspace to search in, normally it's the absolute path to the project directory, "+
-				"e.g. /home/user/projects/project1. Please always passing current workspace path."),
+				"e.g. /home/user/projects/project1. Please always passing current workspace path. "+
+				"Multiple workspaces could be searched at once by a comma separated list of paths, "+
+				"a glob like /home/user/projects/*, or 'all'."),
 			mcp.Required(),
 		),
 		mcp.WithNumber("limit",
@@ -141,6 +214,56 @@ func registerMCPTools(mcpServer *server.MCPServer) {
 				fmt.Sprintf("Currently, the default limit is %d.\n", config.Client.DefaultLimit.MaxFilesResults))),
 	), searchFilesToolHandler)
 
+	mcpServer.AddTool(mcp.NewTool(string(HaystackReplace),
+		mcp.WithDescription("Replace a term everywhere in current project, e.g. to rename an identifier. "+
+			"By default only the unified diffs are returned, set dry_run to false to rewrite the files."),
+		mcp.WithString("query",
+			mcp.Description("The term to replace, it's matched as in HaystackSearch but it must be a single term, "+
+				"e.g. 'oldName' or 'get*Config'"),
+			mcp.Required(),
+		),
+		mcp.WithString("replacement",
+			mcp.Description("The text to replace each match with, '$0' is the matched term and '${1}', '${2}'... "+
+				"are the texts matched by the wildcards of the term, e.g. 'load${1}Config'"),
+			mcp.Required(),
+		),
+		mcp.WithString("workspace",
+			mcp.Description("The workspace to replace in, normally it's the absolute path to the project directory, "+
+				"e.g. /home/user/projects/project1. Please always passing current workspace path."),
+			mcp.Required(),
+		),
+		mcp.WithString("path",
+			mcp.Description("The path to replace in, related to workspace, e.g. src/core"),
+		),
+		mcp.WithString("filter", mcp.Description("Only replace in files matching the glob patterns, "+
+			"separated by comma(','), e.g. 'src/**/*.go,*.cc'")),
+		mcp.WithString("exclude", mcp.Description("Exclude files matching the glob patterns, "+
+			"separated by comma, e.g. 'test/**/*.go'")),
+		mcp.WithBoolean("ignore_case", mcp.Description("Match the term case-insensitively, "+
+			"by default it's matched case-sensitively as renames should be")),
+		mcp.WithBoolean("dry_run", mcp.Description("Only return the diffs without changing files, default is true")),
+	), replaceToolHandler)
+
+	mcpServer.AddTool(mcp.NewTool(string(HaystackSuggest),
+		mcp.WithDescription("List the identifiers indexed in current project starting with a prefix, "+
+			"ranked by the number of files containing them. Use it to find the real spelling of an identifier "+
+			"before searching, identifiers are listed in lower case."),
+		mcp.WithString("prefix",
+			mcp.Description("The prefix of the identifiers, case-insensitive, e.g. 'getconf'"),
+			mcp.Required(),
+		),
+		mcp.WithString("workspace",
+			mcp.Description("The workspace to suggest from, normally it's the absolute path to the project directory, "+
+				"e.g. /home/user/projects/project1. Please always passing current workspace path."),
+			mcp.Required(),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of identifiers to return, default is %d, maximum is %d.",
+				searcher.DefaultSuggestLimit, searcher.MaxSuggestLimit))),
+	), suggestToolHandler)
+
+	registerMCPBrowseTools(mcpServer)
+
 	log.Println("MCP tools registered")
 }
 
@@ -155,27 +278,19 @@ func handleSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallTo
 	path, _ := arguments["path"].(string)
 	filter, _ := arguments["filter"].(string)
 	exclude, _ := arguments["exclude"].(string)
+	fuzzy, _ := arguments["fuzzy"].(bool)
+	variants, _ := arguments["variants"].(bool)
+	mode, _ := arguments["mode"].(string)
+	format, _ := arguments["format"].(string)
 	if !ok1 || !ok2 {
 		return nil, fmt.Errorf("invalid arguments")
 	}
 
-	workspacePath = utils.NormalizePath(workspacePath)
-	if !filepath.IsAbs(workspacePath) {
-		return nil, fmt.Errorf("workspace is not absolute")
-	}
-
-	workspace, err := workspace.GetByPath(workspacePath)
+	workspaces, err := getMCPWorkspaces(workspacePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workspace: %v", err)
 	}
 
-	if path != "" {
-		path = utils.NormalizePath(path)
-		if filepath.IsAbs(path) {
-			return nil, fmt.Errorf("path could not be absolute")
-		}
-	}
-
 	req := types.SearchContentRequest{
 		Query:     query,
 		Workspace: workspacePath,
@@ -189,14 +304,60 @@ func handleSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallTo
 			Exclude: exclude,
 		},
 		BeforeAfter: 1,
+		Variants:    variants,
+	}
+	if fuzzy {
+		req.Fuzzy = &types.SearchFuzzy{}
+	}
+	if err := searcher.ValidateFilters(workspaces, req.Filters); err != nil {
+		return nil, err
+	}
+	if err := searcher.ValidateMode(mode); err != nil {
+		return nil, err
+	}
+	req.Mode = mode
+	if format != "" && format != MCPFormatText && format != MCPFormatJSON {
+		return nil, fmt.Errorf("invalid format `%s`, it must be %s or %s", format, MCPFormatText, MCPFormatJSON)
 	}
 
-	results, truncate := searcher.SearchContent(workspace, &req)
-	resultCount := 0
-	for _, result := range results {
-		resultCount += len(result.Lines)
+	searchResults := searcher.SearchContent(ctx, workspaces, &req)
+	result := &types.SearchContentToolResult{
+		TotalFiles: len(searchResults.Results),
+		Truncate:   searchResults.Truncate,
+		Expansions: searchResults.Expansions,
+		Variants:   searchResults.Variants,
+		Warnings:   searchResults.Warnings,
+		Counts:     searchResults.Counts,
+		Results:    searchResults.Results,
+	}
+	for _, fileResult := range searchResults.Results {
+		result.TotalHits += len(fileResult.Lines)
+	}
+	if counts := searchResults.Counts; counts != nil {
+		result.TotalHits, result.TotalFiles = counts.TotalHits, counts.TotalFiles
+	}
+	if result.Results == nil {
+		result.Results = []types.SearchContentResult{}
 	}
 
+	text := ""
+	if format == MCPFormatJSON {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	} else {
+		text = formatSearchText(result, len(workspaces) > 1)
+	}
+
+	return &mcp.CallToolResult{Content: []mcp.Content{mcp.NewTextContent(text)}}, nil
+}
+
+// formatSearchText renders the result of a content search as compact text
+// Lines are printed as grep does, the lines of matches are "N: content", context lines are "N- content"
+// and "--" separates the matches which are not adjacent.
+func formatSearchText(result *types.SearchContentToolResult, multiWorkspaces bool) string {
 	var toTruncated = func(truncated bool) string {
 		if truncated {
 			return " (truncated)"
@@ -204,38 +365,115 @@ func handleSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallTo
 		return ""
 	}
 
-	var printLine = func(tr *mcp.CallToolResult, line string) {
-		tr.Content = append(tr.Content, mcp.TextContent{
-			Type: "text",
-			Text: line,
-		})
+	text := &strings.Builder{}
+	fmt.Fprintf(text, "Found %d results in %d files%s\n", result.TotalHits, result.TotalFiles, toTruncated(result.Truncate))
+	for _, term := range sortedTerms(result.Expansions) {
+		fmt.Fprintf(text, "Fuzzy term `%s` expanded to: %s\n", term, strings.Join(result.Expansions[term], ", "))
+	}
+	for _, term := range sortedTerms(result.Variants) {
+		fmt.Fprintf(text, "Term `%s` matched as: %s\n", term, strings.Join(result.Variants[term], ", "))
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(text, "Warning: %s\n", warning)
 	}
 
-	tr := &mcp.CallToolResult{}
-	printLine(tr, fmt.Sprintf("Found %d results in %d files%s", resultCount, len(results), toTruncated(truncate)))
+	if counts := result.Counts; counts != nil {
+		printFacets(text, "Directory", counts.Directories)
+		printFacets(text, "Extension", counts.Extensions)
+		printFacets(text, "Language", counts.Languages)
+		return text.String()
+	}
 
-	if len(results) == 0 {
-		printLine(tr, "No results found.")
-		return tr, nil
+	if len(result.Results) == 0 {
+		text.WriteString("No results found.\n")
+		return text.String()
 	}
 
-	for _, result := range results {
-		printLine(tr, "")
-		printLine(tr, strings.Repeat("=", 20))
-		printLine(tr, fmt.Sprintf("File: %s, %d result%s", result.File, len(result.Lines), toTruncated(result.Truncate)))
-		for _, line := range result.Lines {
-			printLine(tr, strings.Repeat("-", 20))
+	for _, fileResult := range result.Results {
+		file := fileResult.File
+		if multiWorkspaces {
+			file = filepath.Join(fileResult.Workspace, fileResult.File)
+		}
+		if fileResult.Overlay {
+			file += " (unsaved)"
+		}
+		fmt.Fprintf(text, "\nFile: %s, %d results%s\n", file, len(fileResult.Lines), toTruncated(fileResult.Truncate))
+
+		// A line in the context of an adjacent match is still printed as a match
+		matched := map[int]bool{}
+		for _, line := range fileResult.Lines {
+			matched[line.Line.LineNumber] = true
+			for _, span := range line.Span {
+				matched[span.LineNumber] = true
+			}
+		}
+
+		// The line printed last, so the context shared by adjacent matches is printed once
+		lastLine := 0
+		for _, line := range fileResult.Lines {
+			first := line.Line.LineNumber
+			if len(line.Before) > 0 {
+				first = line.Before[0].LineNumber
+			}
+			if lastLine > 0 && first > lastLine+1 {
+				text.WriteString("--\n")
+			}
+
+			var printLine = func(content types.SearchContentLine, separator string) {
+				if matched[content.LineNumber] {
+					separator = ":"
+				}
+				if content.LineNumber > lastLine {
+					fmt.Fprintf(text, "%d%s", content.LineNumber, separator)
+					if content.Content != "" {
+						fmt.Fprintf(text, " %s", content.Content)
+					}
+					text.WriteString("\n")
+					lastLine = content.LineNumber
+				}
+			}
 			for _, before := range line.Before {
-				printLine(tr, fmt.Sprintf("Line %d: %s", before.LineNumber, before.Content))
+				printLine(before, "-")
+			}
+			printLine(line.Line, ":")
+			for _, span := range line.Span {
+				printLine(span, ":")
 			}
-			printLine(tr, fmt.Sprintf("Line %d: %s", line.Line.LineNumber, line.Line.Content))
 			for _, after := range line.After {
-				printLine(tr, fmt.Sprintf("Line %d: %s", after.LineNumber, after.Content))
+				printLine(after, "-")
 			}
 		}
 	}
 
-	return tr, nil
+	return text.String()
+}
+
+// sortedTerms returns the terms of the expansions or variants in order, so the text is stable
+func sortedTerms(terms map[string][]string) []string {
+	keys := make([]string, 0, len(terms))
+	for term := range terms {
+		keys = append(keys, term)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printFacets prints the facets of a search in the facets mode, ordered by the number of hits
+func printFacets(text *strings.Builder, name string, facets map[string]types.SearchFacet) {
+	keys := make([]string, 0, len(facets))
+	for key := range facets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if facets[keys[i]].Hits != facets[keys[j]].Hits {
+			return facets[keys[i]].Hits > facets[keys[j]].Hits
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		fmt.Fprintf(text, "%s %s: %d results in %d files\n", name, key, facets[key].Hits, facets[key].Files)
+	}
 }
 
 func searchFilesToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -247,12 +485,7 @@ func searchFilesToolHandler(ctx context.Context, request mcp.CallToolRequest) (*
 		return nil, fmt.Errorf("invalid arguments")
 	}
 
-	workspacePath = utils.NormalizePath(workspacePath)
-	if !filepath.IsAbs(workspacePath) {
-		return nil, fmt.Errorf("workspace is not absolute")
-	}
-
-	workspace, err := workspace.GetByPath(workspacePath)
+	workspaces, err := getMCPWorkspaces(workspacePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workspace: %v", err)
 	}
@@ -272,7 +505,7 @@ func searchFilesToolHandler(ctx context.Context, request mcp.CallToolRequest) (*
 		Limit:     limit,
 	}
 
-	result, err := searcher.SearchFiles(workspace, &req)
+	result, err := searcher.SearchFiles(ctx, workspaces, &req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search files: %v", err)
 	}
@@ -291,7 +524,11 @@ func searchFilesToolHandler(ctx context.Context, request mcp.CallToolRequest) (*
 		return tr, nil
 	}
 
-	for _, file := range result.Files {
+	for _, match := range result.Matches {
+		file := match.File
+		if len(workspaces) > 1 {
+			file = filepath.Join(match.Workspace, match.File)
+		}
 		tr.Content = append(tr.Content, mcp.TextContent{
 			Type: "text",
 			Text: file,
@@ -299,3 +536,145 @@ func searchFilesToolHandler(ctx context.Context, request mcp.CallToolRequest) (*
 	}
 	return tr, nil
 }
+
+// replaceToolHandler previews the replacement of a term, and rewrites the files unless it's a dry run
+func replaceToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	arguments := request.Params.Arguments
+	query, ok1 := arguments["query"].(string)
+	replacement, ok2 := arguments["replacement"].(string)
+	workspacePath, ok3 := arguments["workspace"].(string)
+	path, _ := arguments["path"].(string)
+	filter, _ := arguments["filter"].(string)
+	exclude, _ := arguments["exclude"].(string)
+	ignoreCase, _ := arguments["ignore_case"].(bool)
+	dryRun, ok := arguments["dry_run"].(bool)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+	if !ok {
+		dryRun = true
+	}
+	if !dryRun {
+		if err := checkToolScope(ctx, HaystackReplace, auth.ScopeAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	workspaces, err := getMCPWorkspaces(workspacePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %v", err)
+	}
+
+	req := types.ReplaceRequest{
+		SearchContentRequest: types.SearchContentRequest{
+			Query:     query,
+			Workspace: workspacePath,
+			Limit: &types.SearchLimit{
+				MaxResults:        conf.Get().Server.Search.Limit.MaxResults,
+				MaxResultsPerFile: conf.Get().Server.Search.Limit.MaxResultsPerFile,
+			},
+			Filters: &types.SearchFilters{
+				Path:    path,
+				Include: filter,
+				Exclude: exclude,
+			},
+		},
+		Replacement: replacement,
+		IgnoreCase:  ignoreCase,
+	}
+	if err := searcher.ValidateFilters(workspaces, req.Filters); err != nil {
+		return nil, err
+	}
+
+	preview, err := searcher.PreviewReplace(ctx, workspaces, &req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview the replacement: %v", err)
+	}
+
+	var printLine = func(tr *mcp.CallToolResult, line string) {
+		tr.Content = append(tr.Content, mcp.TextContent{
+			Type: "text",
+			Text: line,
+		})
+	}
+
+	tr := &mcp.CallToolResult{}
+	printLine(tr, fmt.Sprintf("Found %d replacements in %d files", preview.TotalReplacements, len(preview.Files)))
+	if preview.Truncate {
+		printLine(tr, "The search was truncated, not all matches are replaced. Try narrowing the path or filter.")
+	}
+	for _, file := range preview.Files {
+		printLine(tr, file.Diff)
+	}
+
+	if dryRun || len(preview.Files) == 0 {
+		return tr, nil
+	}
+
+	result, err := searcher.ApplyReplace(workspaces, &types.ReplaceApplyRequest{
+		ReplaceRequest: req,
+		Files:          preview.Files,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace: %v", err)
+	}
+
+	printLine(tr, fmt.Sprintf("Replaced %d matches in %d files", result.TotalReplacements, len(result.Files)))
+	for _, conflict := range result.Conflicts {
+		printLine(tr, fmt.Sprintf("Skipped %s: %s", conflict.File, conflict.Error))
+	}
+	return tr, nil
+}
+
+// suggestToolHandler lists the indexed keywords starting with a prefix
+func suggestToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	arguments := request.Params.Arguments
+	prefix, ok1 := arguments["prefix"].(string)
+	workspacePath, ok2 := arguments["workspace"].(string)
+	limit, _ := arguments["limit"].(float64)
+	if !ok1 || !ok2 || strings.TrimSpace(prefix) == "" {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+
+	workspaces, err := getMCPWorkspaces(workspacePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %v", err)
+	}
+
+	result := searcher.SuggestKeywords(workspaces, &types.SearchSuggestRequest{
+		Prefix: prefix,
+		Limit:  int(limit),
+	})
+
+	tr := &mcp.CallToolResult{}
+	tr.Content = append(tr.Content, mcp.TextContent{
+		Type: "text",
+		Text: fmt.Sprintf("Found %d identifiers.", len(result.Suggestions)),
+	})
+	if result.Truncate {
+		tr.Content = append(tr.Content, mcp.TextContent{
+			Type: "text",
+			Text: "Too many identifiers start with the prefix, only the first ones are ranked, use a longer prefix.",
+		})
+	}
+	for _, suggestion := range result.Suggestions {
+		tr.Content = append(tr.Content, mcp.TextContent{
+			Type: "text",
+			Text: fmt.Sprintf("%s (%d files)", suggestion.Keyword, suggestion.Documents),
+		})
+	}
+	return tr, nil
+}
+
+// getMCPWorkspaces returns the workspaces of the workspace argument of MCP tools
+// It's a workspace path, or a comma separated list of workspace paths, globs of paths or "all"
+func getMCPWorkspaces(value string) ([]*workspace.Workspace, error) {
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return workspace.Match(patterns)
+}
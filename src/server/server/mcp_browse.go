@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/server/searcher"
+	"github.com/codetrek/haystack/shared/auth"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// registerMCPBrowseTools registers the tools reading the files and managing the workspaces
+func registerMCPBrowseTools(mcpServer *server.MCPServer) {
+	mcpServer.AddTool(mcp.NewTool(string(HaystackReadFile),
+		mcp.WithDescription("Read a range of lines of a file in current project, e.g. the code around a search "+
+			"result. Only the files indexed in the workspace could be read, unsaved editor buffers are read instead "+
+			"of their files."),
+		mcp.WithString("workspace",
+			mcp.Description("The workspace of the file, normally it's the absolute path to the project directory, "+
+				"e.g. /home/user/projects/project1. Please always passing current workspace path."),
+			mcp.Required(),
+		),
+		mcp.WithString("path",
+			mcp.Description("The path of the file, related to workspace, e.g. src/core/main.go"),
+			mcp.Required(),
+		),
+		mcp.WithNumber("start_line", mcp.Description("The first line to read, starting from 1, default is 1")),
+		mcp.WithNumber("end_line", mcp.Description(fmt.Sprintf("The last line to read, inclusive, default is %d "+
+			"lines from start_line, at most %d lines are read at once",
+			searcher.DefaultReadFileLines, searcher.MaxReadFileLines))),
+	), readFileToolHandler)
+
+	mcpServer.AddTool(mcp.NewTool(string(HaystackListDir),
+		mcp.WithDescription("List the indexed files and directories of a directory in current project, "+
+			"with the number of indexed files in each directory."),
+		mcp.WithString("workspace",
+			mcp.Description("The workspace of the directory, normally it's the absolute path to the project "+
+				"directory, e.g. /home/user/projects/project1. Please always passing current workspace path."),
+			mcp.Required(),
+		),
+		mcp.WithString("path",
+			mcp.Description("The path of the directory, related to workspace, e.g. src/core, "+
+				"default is the root of the workspace"),
+		),
+	), listDirToolHandler)
+
+	mcpServer.AddTool(mcp.NewTool(string(HaystackWorkspaces),
+		mcp.WithDescription("Manage the indexed workspaces: list them, get the indexing status of one, "+
+			"create one to index a new project, or sync one to re-index its changed files."),
+		mcp.WithString("action",
+			mcp.Description("One of 'list', 'status', 'create' and 'sync', default is 'list'"),
+		),
+		mcp.WithString("workspace",
+			mcp.Description("The absolute path of the workspace, required by 'status', 'create' and 'sync'"),
+		),
+	), workspacesToolHandler)
+}
+
+// getMCPWorkspace returns the single workspace of the workspace argument of MCP tools
+func getMCPWorkspace(arguments map[string]interface{}) (*workspace.Workspace, error) {
+	workspacePath, ok := arguments["workspace"].(string)
+	if !ok || strings.TrimSpace(workspacePath) == "" {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+
+	ws, err := workspace.GetByPath(strings.TrimSpace(workspacePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %v", err)
+	}
+	return ws, nil
+}
+
+// readFileToolHandler reads a range of lines of a file
+func readFileToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	arguments := request.Params.Arguments
+	path, ok := arguments["path"].(string)
+	startLine, _ := arguments["start_line"].(float64)
+	endLine, _ := arguments["end_line"].(float64)
+	if !ok || strings.TrimSpace(path) == "" {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+
+	ws, err := getMCPWorkspace(arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := searcher.ReadFile(ws, path, int(startLine), int(endLine))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	header := fmt.Sprintf("File: %s, lines %d-%d of %d", result.File, result.StartLine, result.EndLine, result.TotalLines)
+	if len(result.Lines) == 0 {
+		header = fmt.Sprintf("File: %s, no lines from %d of %d", result.File, result.StartLine, result.TotalLines)
+	}
+	if result.Overlay {
+		header += " (unsaved)"
+	}
+	if result.Truncate {
+		header += fmt.Sprintf(", truncated, continue from line %d", result.EndLine+1)
+	}
+
+	// Lines are numbered as the search results, so they could be referred to
+	content := &strings.Builder{}
+	for i, line := range result.Lines {
+		fmt.Fprintf(content, "%d: %s\n", result.StartLine+i, line)
+	}
+
+	tr := &mcp.CallToolResult{}
+	printText(tr, header)
+	if content.Len() > 0 {
+		printText(tr, content.String())
+	}
+	return tr, nil
+}
+
+// listDirToolHandler lists the indexed children of a directory
+func listDirToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	arguments := request.Params.Arguments
+	path, _ := arguments["path"].(string)
+
+	ws, err := getMCPWorkspace(arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := searcher.ListDir(ws, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory: %v", err)
+	}
+
+	dir := result.Path
+	if dir == "" {
+		dir = "."
+	}
+
+	tr := &mcp.CallToolResult{}
+	header := fmt.Sprintf("Directory: %s, %d entries, %d indexed files", dir, len(result.Entries), result.TotalFiles)
+	if result.Truncate {
+		header += " (truncated)"
+	}
+	printText(tr, header)
+	for _, entry := range result.Entries {
+		if entry.Dir {
+			printText(tr, fmt.Sprintf("%s/ (%d files)", entry.Name, entry.Files))
+		} else {
+			printText(tr, entry.Name)
+		}
+	}
+	return tr, nil
+}
+
+// workspacesToolHandler lists, creates and syncs the workspaces, or gets the status of one
+func workspacesToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	arguments := request.Params.Arguments
+	action, _ := arguments["action"].(string)
+	workspacePath, _ := arguments["workspace"].(string)
+	workspacePath = strings.TrimSpace(workspacePath)
+
+	// Only listing and reading the status are allowed to the tokens of the search scope
+	if action == "create" || action == "sync" {
+		if err := checkToolScope(ctx, HaystackWorkspaces, auth.ScopeAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	tr := &mcp.CallToolResult{}
+	switch action {
+	case "", "list":
+		workspaces := workspace.GetAll()
+		printText(tr, fmt.Sprintf("Found %d workspaces.", len(workspaces)))
+		for _, ws := range workspaces {
+			status := ""
+			if ws.Indexing {
+				status = ", indexing"
+			}
+			printText(tr, fmt.Sprintf("%s (%d files%s)", ws.Path, ws.TotalFiles, status))
+		}
+
+	case "status":
+		ws, err := getMCPWorkspace(arguments)
+		if err != nil {
+			return nil, err
+		}
+		printWorkspaceStatus(tr, ws)
+
+	case "create":
+		if !filepath.IsAbs(workspacePath) {
+			return nil, fmt.Errorf("workspace must be an absolute path")
+		}
+		if ws, _ := workspace.GetByPath(workspacePath); ws != nil {
+			printText(tr, "Workspace already exists.")
+			printWorkspaceStatus(tr, ws)
+			return tr, nil
+		}
+
+		ws, err := indexer.CreateWorkspace(workspacePath, true, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create workspace: %v", err)
+		}
+		printText(tr, fmt.Sprintf("Created workspace %s, it's being indexed.", ws.Path))
+
+	case "sync":
+		ws, err := getMCPWorkspace(arguments)
+		if err != nil {
+			return nil, err
+		}
+		if err := indexer.Sync(ws); err != nil {
+			return nil, fmt.Errorf("failed to sync workspace: %v", err)
+		}
+		printText(tr, fmt.Sprintf("Syncing workspace %s, changed files are re-indexed in the background.", ws.Path))
+
+	default:
+		return nil, fmt.Errorf("unknown action: %s", action)
+	}
+
+	return tr, nil
+}
+
+// printWorkspaceStatus prints the indexing status of the workspace
+func printWorkspaceStatus(tr *mcp.CallToolResult, ws *workspace.Workspace) {
+	printText(tr, fmt.Sprintf("Workspace: %s", ws.Path))
+	printText(tr, fmt.Sprintf("Files: %d", ws.GetTotalFiles()))
+	if indexing := ws.GetIndexingStatus(); indexing != nil {
+		printText(tr, fmt.Sprintf("Indexing: %d of %d files", indexing.IndexedFiles, indexing.TotalFiles))
+	}
+	if ws.LastFullSync.IsZero() {
+		printText(tr, "Last full sync: never")
+	} else {
+		printText(tr, fmt.Sprintf("Last full sync: %s", ws.LastFullSync.Format("2006-01-02 15:04:05")))
+	}
+}
+
+// printText appends a text content to the result of a tool call
+func printText(tr *mcp.CallToolResult, text string) {
+	tr.Content = append(tr.Content, mcp.TextContent{
+		Type: "text",
+		Text: text,
+	})
+}
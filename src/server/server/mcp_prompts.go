@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// definitionKeywords are the keywords introducing a definition in common languages
+var definitionKeywords = []string{
+	"func", "function", "def", "fn", "class", "struct", "interface", "type", "enum", "trait", "const", "var", "let",
+}
+
+// registerMCPPrompts registers the prompts built on the search tools
+func registerMCPPrompts(mcpServer *server.MCPServer) {
+	symbol := mcp.WithArgument("symbol",
+		mcp.ArgumentDescription("The identifier to look for, e.g. newRequestHandler"),
+		mcp.RequiredArgument(),
+	)
+	workspaceArgument := mcp.WithArgument("workspace",
+		mcp.ArgumentDescription("The absolute path of the project directory, e.g. /home/user/projects/project1"),
+		mcp.RequiredArgument(),
+	)
+
+	mcpServer.AddPrompt(mcp.NewPrompt("find_definition",
+		mcp.WithPromptDescription("Find where an identifier is defined in the project"),
+		symbol, workspaceArgument,
+	), findDefinitionPromptHandler)
+
+	mcpServer.AddPrompt(mcp.NewPrompt("find_usages",
+		mcp.WithPromptDescription("Find all the places an identifier is used in the project"),
+		symbol, workspaceArgument,
+	), findUsagesPromptHandler)
+
+	mcpServer.AddPrompt(mcp.NewPrompt("rename_symbol",
+		mcp.WithPromptDescription("Preview renaming an identifier everywhere in the project"),
+		symbol, workspaceArgument,
+		mcp.WithArgument("new_name",
+			mcp.ArgumentDescription("The new name of the identifier"),
+			mcp.RequiredArgument(),
+		),
+	), renameSymbolPromptHandler)
+}
+
+// promptArguments returns the required arguments of a prompt
+func promptArguments(request mcp.GetPromptRequest, names ...string) ([]string, error) {
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.TrimSpace(request.Params.Arguments[name])
+		if value == "" {
+			return nil, fmt.Errorf("argument `%s` is required", name)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// newPromptResult returns the result of a prompt with a single user message
+func newPromptResult(description string, text string) *mcp.GetPromptResult {
+	return mcp.NewGetPromptResult(description, []mcp.PromptMessage{
+		mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text)),
+	})
+}
+
+func findDefinitionPromptHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	args, err := promptArguments(request, "symbol", "workspace")
+	if err != nil {
+		return nil, err
+	}
+	symbol, workspacePath := args[0], args[1]
+
+	queries := make([]string, 0, len(definitionKeywords))
+	for _, keyword := range definitionKeywords {
+		queries = append(queries, keyword+" "+symbol)
+	}
+
+	return newPromptResult(fmt.Sprintf("Find the definition of %s", symbol), fmt.Sprintf(
+		"Find where `%s` is defined in the workspace %s.\n\n"+
+			"1. Call the %s tool with workspace `%s` and query `%s`, it matches the lines declaring the "+
+			"identifier in common languages.\n"+
+			"2. If nothing is found, the identifier may be spelled differently, call %s with prefix `%s` to list the "+
+			"indexed spellings, or search again with `variants` set to true.\n"+
+			"3. If it's still not found, it may be a field, a method or an assignment, search for `%s` alone and look "+
+			"for the line assigning or declaring it.\n"+
+			"4. Read the code around the definition with the %s tool, and answer with the file, the line and the "+
+			"signature of the definition.",
+		symbol, workspacePath,
+		HaystackSearch, workspacePath, strings.Join(queries, " | "),
+		HaystackSuggest, strings.ToLower(symbol),
+		symbol,
+		HaystackReadFile)), nil
+}
+
+func findUsagesPromptHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	args, err := promptArguments(request, "symbol", "workspace")
+	if err != nil {
+		return nil, err
+	}
+	symbol, workspacePath := args[0], args[1]
+
+	return newPromptResult(fmt.Sprintf("Find the usages of %s", symbol), fmt.Sprintf(
+		"Find all the places `%s` is used in the workspace %s.\n\n"+
+			"1. Call the %s tool with workspace `%s`, query `%s` and mode `facets` to see how many usages there are "+
+			"and in which directories.\n"+
+			"2. Call %s with the same query and format `json` to get the lines, raise the limit if the result is "+
+			"truncated, or narrow it by path and filter.\n"+
+			"3. Leave out the definition itself and the matches in comments or strings which are not the identifier.\n"+
+			"4. Answer with the usages grouped by file, with their line numbers and how the identifier is used.",
+		symbol, workspacePath,
+		HaystackSearch, workspacePath, symbol,
+		HaystackSearch)), nil
+}
+
+func renameSymbolPromptHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	args, err := promptArguments(request, "symbol", "workspace", "new_name")
+	if err != nil {
+		return nil, err
+	}
+	symbol, workspacePath, newName := args[0], args[1], args[2]
+
+	return newPromptResult(fmt.Sprintf("Rename %s to %s", symbol, newName), fmt.Sprintf(
+		"Rename `%s` to `%s` in the workspace %s.\n\n"+
+			"1. Call the %s tool with workspace `%s` and query `%s` to check that `%s` is not used already.\n"+
+			"2. Call the %s tool with workspace `%s`, query `%s` and replacement `%s`, "+
+			"leaving dry_run unset to preview the diffs.\n"+
+			"3. Review the diffs, the matches in comments, strings or of other identifiers with the same name may "+
+			"need to be kept, narrow the replacement by path, filter or exclude.\n"+
+			"4. Show the diffs and ask for confirmation before calling %s again with dry_run set to false.",
+		symbol, newName, workspacePath,
+		HaystackSearch, workspacePath, newName, newName,
+		HaystackReplace, workspacePath, symbol, newName,
+		HaystackReplace)), nil
+}
@@ -0,0 +1,460 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/searcher"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// fileResourceTemplate is the URI of an indexed file, the workspace path is a single escaped segment
+	fileResourceTemplate = "haystack://{workspace}/{+path}"
+	fileResourceScheme   = "haystack://"
+
+	mcpResourcesPageSize = 200
+
+	maxMCPSubscribers            = 256
+	maxMCPSubscriptionsPerClient = 1024
+	// mcpListChangedDelay coalesces the list changes of a burst of writes, e.g. indexing a workspace
+	mcpListChangedDelay = time.Second
+
+	mcpMethodResourcesSubscribe   = "resources/subscribe"
+	mcpMethodResourcesUnsubscribe = "resources/unsubscribe"
+	mcpNotificationResourceUpdate = "notifications/resources/updated"
+	mcpNotificationResourcesList  = "notifications/resources/list_changed"
+)
+
+// dispatchedMCPMethods are the methods handled by dispatchMCPMessage rather than the MCP server
+var dispatchedMCPMethods = map[string]bool{
+	string(mcp.MethodResourcesList): true,
+	mcpMethodResourcesSubscribe:     true,
+	mcpMethodResourcesUnsubscribe:   true,
+}
+
+// registerMCPResources registers the resource template of the indexed files
+// The resources are listed and subscribed by dispatchMCPMessage, the SDK only serves static resources.
+func registerMCPResources(mcpServer *server.MCPServer) {
+	mcpServer.AddResourceTemplate(mcp.NewResourceTemplate(fileResourceTemplate, "Indexed file",
+		mcp.WithTemplateDescription("The content of a file indexed in a workspace, the workspace is its absolute "+
+			"path escaped as a single segment, e.g. haystack://%2Fhome%2Fuser%2Fproject1/src/main.go"),
+		mcp.WithTemplateMIMEType("text/plain"),
+	), readResourceHandler)
+}
+
+// escapeURIComponent escapes all the characters of s except the unreserved ones, and the slashes if keepSlash
+func escapeURIComponent(s string, keepSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		if b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' ||
+			b == '-' || b == '.' || b == '_' || b == '~' || keepSlash && b == '/' {
+			sb.WriteByte(b)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+// fileResourceURI returns the URI of a file of the workspace
+func fileResourceURI(workspacePath, relPath string) string {
+	return fileResourceScheme + escapeURIComponent(workspacePath, false) + "/" +
+		escapeURIComponent(filepath.ToSlash(relPath), true)
+}
+
+// parseFileResourceURI returns the workspace path and the relative path of a file URI, the path is empty
+// for the URI of a workspace
+func parseFileResourceURI(uri string) (string, string, error) {
+	rest, ok := strings.CutPrefix(uri, fileResourceScheme)
+	if !ok {
+		return "", "", fmt.Errorf("invalid resource URI `%s`", uri)
+	}
+
+	escapedWorkspace, escapedPath, _ := strings.Cut(rest, "/")
+	workspacePath, err := url.PathUnescape(escapedWorkspace)
+	if err != nil || workspacePath == "" {
+		return "", "", fmt.Errorf("invalid workspace of resource URI `%s`", uri)
+	}
+	relPath, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid path of resource URI `%s`", uri)
+	}
+
+	return workspacePath, filepath.FromSlash(relPath), nil
+}
+
+// readResourceHandler reads an indexed file of the resource template
+func readResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	workspacePath, relPath, err := parseFileResourceURI(request.Params.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := workspace.GetByPath(workspacePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %v", err)
+	}
+
+	content, _, err := searcher.ReadFileContent(ws, relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: "text/plain",
+		Text:     content,
+	}}, nil
+}
+
+// listResources lists a page of the indexed files of all workspaces, ordered by the workspace path and the document
+// id, the cursor is the workspace path and the document id of the last file of the previous page
+func listResources(cursor mcp.Cursor) (*mcp.ListResourcesResult, error) {
+	afterWorkspace, afterDocid := "", ""
+	if cursor != "" {
+		data, err := base64.StdEncoding.DecodeString(string(cursor))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		afterWorkspace, afterDocid, _ = strings.Cut(string(data), "\x00")
+	}
+
+	workspaces := workspace.GetAll()
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].Path < workspaces[j].Path
+	})
+
+	result := &mcp.ListResourcesResult{Resources: []mcp.Resource{}}
+	for _, info := range workspaces {
+		if info.Path < afterWorkspace {
+			continue
+		}
+
+		ws, err := workspace.GetByPath(info.Path)
+		if err != nil {
+			continue
+		}
+
+		var lastDocid string
+		err = searcher.ScanIndexedFiles(ws, func(docid, relPath string) bool {
+			if ws.Path == afterWorkspace && docid <= afterDocid {
+				return true
+			}
+			if len(result.Resources) == mcpResourcesPageSize {
+				result.NextCursor = mcp.Cursor(base64.StdEncoding.EncodeToString([]byte(ws.Path + "\x00" + lastDocid)))
+				return false
+			}
+
+			result.Resources = append(result.Resources, mcp.NewResource(fileResourceURI(ws.Path, relPath),
+				filepath.ToSlash(relPath),
+				mcp.WithResourceDescription(fmt.Sprintf("%s in workspace %s", filepath.ToSlash(relPath), ws.Path)),
+				mcp.WithMIMEType("text/plain")))
+			lastDocid = docid
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if result.NextCursor != "" {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// mcpNotifier sends the notifications of resources to a client of a session
+type mcpNotifier struct {
+	sessionID string
+	send      func(notification mcp.JSONRPCNotification) error
+}
+
+// sessionNotifier returns the notifier sending the notifications to the notification channel of the session
+// Notifications are dropped rather than blocking the writes of the index if the channel is full.
+func sessionNotifier(session server.ClientSession) *mcpNotifier {
+	return &mcpNotifier{
+		sessionID: session.SessionID(),
+		send: func(notification mcp.JSONRPCNotification) error {
+			select {
+			case session.NotificationChannel() <- notification:
+				return nil
+			default:
+				return errors.New("notification channel is full")
+			}
+		},
+	}
+}
+
+// mcpSubscriber is a client listing or subscribing the resources
+// A subscription of a directory URI, which ends with a slash, matches all the files in the directory
+type mcpSubscriber struct {
+	notifier           *mcpNotifier
+	uris               map[string]struct{}
+	listChangedPending bool
+}
+
+// mcpSubscriptions is the clients notified of the changes of the resources
+type mcpSubscriptions struct {
+	mutex       sync.Mutex
+	subscribers map[string]*mcpSubscriber
+}
+
+var resourceSubscriptions = &mcpSubscriptions{subscribers: map[string]*mcpSubscriber{}}
+
+// subscriber returns the subscriber of the notifier, it's created if there are less than maxMCPSubscribers
+func (s *mcpSubscriptions) subscriber(notifier *mcpNotifier) *mcpSubscriber {
+	sub := s.subscribers[notifier.sessionID]
+	if sub == nil && len(s.subscribers) < maxMCPSubscribers {
+		sub = &mcpSubscriber{notifier: notifier, uris: map[string]struct{}{}}
+		s.subscribers[notifier.sessionID] = sub
+	}
+	return sub
+}
+
+// watch makes the client notified of the changes of the list of resources
+func (s *mcpSubscriptions) watch(notifier *mcpNotifier) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.subscriber(notifier)
+}
+
+func (s *mcpSubscriptions) subscribe(notifier *mcpNotifier, uri string) error {
+	if _, _, err := parseFileResourceURI(uri); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sub := s.subscriber(notifier)
+	if sub == nil {
+		return fmt.Errorf("too many subscribers")
+	}
+	if len(sub.uris) >= maxMCPSubscriptionsPerClient {
+		return fmt.Errorf("too many subscriptions, at most %d are allowed", maxMCPSubscriptionsPerClient)
+	}
+
+	sub.uris[uri] = struct{}{}
+	return nil
+}
+
+func (s *mcpSubscriptions) unsubscribe(sessionID string, uri string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sub := s.subscribers[sessionID]; sub != nil {
+		delete(sub.uris, uri)
+	}
+}
+
+// remove removes the subscriber of a closed session
+func (s *mcpSubscriptions) remove(sessionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.subscribers, sessionID)
+}
+
+// send sends a notification to the subscriber, the subscriber is removed if it's not delivered, e.g. its session
+// has been closed. It should be called with the mutex locked.
+func (s *mcpSubscriptions) send(sub *mcpSubscriber, method string, params map[string]any) {
+	notification := mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: method,
+			Params: mcp.NotificationParams{AdditionalFields: params},
+		},
+	}
+
+	if err := sub.notifier.send(notification); err != nil {
+		log.Printf("Failed to notify MCP session %s, its subscriptions are dropped: %v", sub.notifier.sessionID, err)
+		delete(s.subscribers, sub.notifier.sessionID)
+	}
+}
+
+// onDocumentsChanged is the listener of the changed documents of the index, it's called on the write queue of the
+// index, so the subscribers are notified in the background
+func (s *mcpSubscriptions) onDocumentsChanged(change *fulltext.DocumentsChange) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.subscribers) > 0 {
+		go s.documentsChanged(change)
+	}
+}
+
+// documentsChanged notifies the subscribers of the changed files
+func (s *mcpSubscriptions) documentsChanged(change *fulltext.DocumentsChange) {
+	ws, err := workspace.Get(change.WorkspaceID)
+	if err != nil || ws == nil {
+		return
+	}
+
+	uris := make([]string, 0, len(change.RelPaths))
+	for _, relPath := range change.RelPaths {
+		uris = append(uris, fileResourceURI(ws.Path, relPath))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, sub := range s.subscribers {
+		for _, uri := range uris {
+			if sub.subscribed(uri) {
+				s.send(sub, mcpNotificationResourceUpdate, map[string]any{"uri": uri})
+			}
+		}
+
+		if change.ListChanged && !sub.listChangedPending {
+			sub.listChangedPending = true
+			time.AfterFunc(mcpListChangedDelay, func() {
+				s.mutex.Lock()
+				defer s.mutex.Unlock()
+
+				sub.listChangedPending = false
+				if s.subscribers[sub.notifier.sessionID] == sub {
+					s.send(sub, mcpNotificationResourcesList, nil)
+				}
+			})
+		}
+	}
+}
+
+// subscribed returns whether the file URI is subscribed, either itself or by a directory containing it
+func (sub *mcpSubscriber) subscribed(uri string) bool {
+	if _, ok := sub.uris[uri]; ok {
+		return true
+	}
+	for subscribed := range sub.uris {
+		if strings.HasSuffix(subscribed, "/") && strings.HasPrefix(uri, subscribed) {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatchMCPMessage handles an MCP JSON-RPC message, the resource requests the SDK could not serve are handled here
+// and the others by the MCP server. Subscriptions are only accepted if notifier is set, i.e. the transport has a
+// session which notifications could be sent to.
+func dispatchMCPMessage(ctx context.Context, mcpServer *server.MCPServer, message json.RawMessage,
+	notifier *mcpNotifier) mcp.JSONRPCMessage {
+	var request struct {
+		ID     mcp.RequestId `json:"id"`
+		Method string        `json:"method"`
+		Params struct {
+			Cursor mcp.Cursor `json:"cursor"`
+			URI    string     `json:"uri"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(message, &request); err != nil || request.ID == nil {
+		return mcpServer.HandleMessage(ctx, message)
+	}
+
+	switch request.Method {
+	case string(mcp.MethodResourcesList):
+		result, err := listResources(request.Params.Cursor)
+		if err != nil {
+			return mcp.NewJSONRPCError(request.ID, mcp.INVALID_PARAMS, err.Error(), nil)
+		}
+		if notifier != nil {
+			resourceSubscriptions.watch(notifier)
+		}
+		return mcp.JSONRPCResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: request.ID, Result: result}
+
+	case mcpMethodResourcesSubscribe, mcpMethodResourcesUnsubscribe:
+		if notifier == nil {
+			return mcp.NewJSONRPCError(request.ID, mcp.METHOD_NOT_FOUND,
+				"subscriptions are not supported by this transport", nil)
+		}
+		if request.Method == mcpMethodResourcesUnsubscribe {
+			resourceSubscriptions.unsubscribe(notifier.sessionID, request.Params.URI)
+		} else if err := resourceSubscriptions.subscribe(notifier, request.Params.URI); err != nil {
+			return mcp.NewJSONRPCError(request.ID, mcp.INVALID_PARAMS, err.Error(), nil)
+		}
+		return mcp.JSONRPCResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: request.ID, Result: mcp.EmptyResult{}}
+	}
+
+	return mcpServer.HandleMessage(ctx, message)
+}
+
+// sseSubscriberID returns the id of the subscriber of an SSE session, it's distinct from the streamable sessions
+func sseSubscriberID(sessionID string) string {
+	return "sse-" + sessionID
+}
+
+// removeSSESubscriber is the hook of the registered sessions, it removes the subscriber of an SSE session once its
+// stream is closed, i.e. the context of the session is done, as the SDK doesn't report closed sessions.
+// Streamable sessions are never done by the context, their subscribers are removed once they are closed.
+func removeSSESubscriber(ctx context.Context, session server.ClientSession) {
+	if _, ok := session.(*streamableSession); ok {
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		resourceSubscriptions.remove(sseSubscriberID(session.SessionID()))
+	}()
+}
+
+// serveSSEResourceMessage handles the messages of the SSE transport which are dispatched rather than handled by the
+// MCP server, the response is sent by the SSE stream of the session as the SDK does. It returns false to leave the
+// other messages to the SSE server.
+func serveSSEResourceMessage(sse *server.SSEServer, mcpServer *server.MCPServer,
+	w http.ResponseWriter, r *http.Request) bool {
+	sessionID := r.URL.Query().Get("sessionId")
+	if r.Method != http.MethodPost || r.URL.Path != sse.CompleteMessagePath() || sessionID == "" {
+		return false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var base streamableMessage
+	if err := json.Unmarshal(body, &base); err != nil || !dispatchedMCPMethods[base.Method] {
+		return false
+	}
+
+	notifier := &mcpNotifier{
+		sessionID: sseSubscriberID(sessionID),
+		send: func(notification mcp.JSONRPCNotification) error {
+			return sse.SendEventToSession(sessionID, notification)
+		},
+	}
+	response := dispatchMCPMessage(r.Context(), mcpServer, body, notifier)
+	if err := sse.SendEventToSession(sessionID, response); err != nil {
+		resourceSubscriptions.remove(notifier.sessionID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write MCP response: %v", err)
+	}
+	return true
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codetrek/haystack/server/core/fulltext"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestParseFileResourceURI(t *testing.T) {
+	tests := []struct {
+		uri       string
+		workspace string
+		path      string
+		wantErr   bool
+	}{
+		{"haystack://%2Fhome%2Fuser%2Fproject/src/main.go", "/home/user/project", "src/main.go", false},
+		{"haystack://%2Fhome%2Fuser%2Fproject/src/", "/home/user/project", "src/", false},
+		{"haystack://%2Fhome%2Fuser%2Fproject", "/home/user/project", "", false},
+		{"haystack://%2Ftmp/my%20file%25.go", "/tmp", "my file%.go", false},
+		{"file:///home/user/project/main.go", "", "", true},
+		{"haystack:///main.go", "", "", true},
+		{"haystack://%zz/main.go", "", "", true},
+		{"haystack://%2Ftmp/%zz.go", "", "", true},
+	}
+
+	for _, tt := range tests {
+		workspacePath, relPath, err := parseFileResourceURI(tt.uri)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFileResourceURI(%q) error = %v, wantErr %t", tt.uri, err, tt.wantErr)
+			continue
+		}
+		if workspacePath != tt.workspace || relPath != filepath.FromSlash(tt.path) {
+			t.Errorf("parseFileResourceURI(%q) = %q, %q, want %q, %q", tt.uri, workspacePath, relPath, tt.workspace,
+				tt.path)
+		}
+	}
+}
+
+func TestFileResourceURIRoundTrip(t *testing.T) {
+	for _, file := range []struct{ workspace, path string }{
+		{"/home/user/project", "src/main.go"},
+		{"/home/user/my project", "docs/read me.md"},
+		{"/tmp/100%", "a%2Fb/c?d#e.go"},
+		{"/srv/代码", "模块/文件.go"},
+		{"C:\\Users\\dev", "src/+plus&amp.go"},
+	} {
+		uri := fileResourceURI(file.workspace, filepath.FromSlash(file.path))
+		workspacePath, relPath, err := parseFileResourceURI(uri)
+		if err != nil || workspacePath != file.workspace || relPath != filepath.FromSlash(file.path) {
+			t.Errorf("URI %q is parsed to %q, %q, %v, want %q, %q", uri, workspacePath, relPath, err, file.workspace,
+				file.path)
+		}
+	}
+
+	// Slashes are only kept in the path
+	if got := escapeURIComponent("/a b/c~d", false); got != "%2Fa%20b%2Fc~d" {
+		t.Errorf("escapeURIComponent() = %q", got)
+	}
+	if got := escapeURIComponent("/a b/c~d", true); got != "/a%20b/c~d" {
+		t.Errorf("escapeURIComponent() keeping slashes = %q", got)
+	}
+}
+
+func TestListResources(t *testing.T) {
+	files := map[string]string{}
+	for i := range mcpResourcesPageSize + 50 {
+		files[fmt.Sprintf("file%03d.go", i)] = "package main\n"
+	}
+	ws := newIndexedWorkspace(t, files)
+
+	// Pages are listed until there is no next cursor, each file is listed once
+	listed := map[string]bool{}
+	cursor := mcp.Cursor("")
+	for pages := 1; ; pages++ {
+		result, err := listResources(cursor)
+		if err != nil {
+			t.Fatalf("listResources(%q) error = %v", cursor, err)
+		}
+		if result.NextCursor != "" && len(result.Resources) != mcpResourcesPageSize {
+			t.Errorf("page %d got %d resources, want a full page", pages, len(result.Resources))
+		}
+		for _, resource := range result.Resources {
+			if listed[resource.URI] {
+				t.Errorf("resource %s is listed twice", resource.URI)
+			}
+			listed[resource.URI] = true
+		}
+
+		if cursor = result.NextCursor; cursor == "" {
+			if pages != 2 {
+				t.Errorf("got %d pages, want 2", pages)
+			}
+			break
+		}
+	}
+	if len(listed) != len(files) || !listed[fileResourceURI(ws.Path, "file042.go")] {
+		t.Errorf("got %d resources, want %d", len(listed), len(files))
+	}
+
+	if _, err := listResources("not base64!"); err == nil {
+		t.Errorf("listResources() expected an error of the invalid cursor")
+	}
+}
+
+// notifications records the notifications sent to a session
+type notifications struct {
+	mutex   sync.Mutex
+	methods []string
+	uris    []string
+}
+
+func (n *notifications) notifier(sessionID string) *mcpNotifier {
+	return &mcpNotifier{sessionID: sessionID, send: func(notification mcp.JSONRPCNotification) error {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		uri, _ := notification.Params.AdditionalFields["uri"].(string)
+		n.methods = append(n.methods, notification.Method)
+		n.uris = append(n.uris, uri)
+		return nil
+	}}
+}
+
+func TestResourceSubscriptions(t *testing.T) {
+	ws := newIndexedWorkspace(t, map[string]string{"src/a.go": "package src\n"})
+	mcpServer := newMCPServer()
+	received := &notifications{}
+	notifier := received.notifier("test-session")
+	t.Cleanup(func() { resourceSubscriptions.remove(notifier.sessionID) })
+
+	dispatch := func(method string, uri string, notifier *mcpNotifier) mcp.JSONRPCMessage {
+		message, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method,
+			"params": map[string]any{"uri": uri}})
+		return dispatchMCPMessage(context.Background(), mcpServer, message, notifier)
+	}
+
+	fileURI := fileResourceURI(ws.Path, filepath.Join("src", "a.go"))
+	dirURI := fileResourceURI(ws.Path, "src") + "/"
+	for _, uri := range []string{fileURI, dirURI} {
+		if response, ok := dispatch(mcpMethodResourcesSubscribe, uri, notifier).(mcp.JSONRPCResponse); !ok {
+			t.Fatalf("subscribe %s got %+v", uri, response)
+		}
+	}
+
+	// Transports without sessions can't subscribe, invalid URIs are rejected
+	if response, ok := dispatch(mcpMethodResourcesSubscribe, fileURI, nil).(mcp.JSONRPCError); !ok ||
+		response.Error.Code != mcp.METHOD_NOT_FOUND {
+		t.Errorf("subscribe without a session got %+v", response)
+	}
+	if response, ok := dispatch(mcpMethodResourcesSubscribe, "file:///a.go", notifier).(mcp.JSONRPCError); !ok ||
+		response.Error.Code != mcp.INVALID_PARAMS {
+		t.Errorf("subscribe of an invalid URI got %+v", response)
+	}
+
+	// The file is notified by its subscription and the one of its directory
+	change := &fulltext.DocumentsChange{WorkspaceID: ws.ID, RelPaths: []string{filepath.Join("src", "a.go"), "b.go"}}
+	resourceSubscriptions.documentsChanged(change)
+	if len(received.uris) != 1 || received.uris[0] != fileURI || received.methods[0] != mcpNotificationResourceUpdate {
+		t.Errorf("got notifications %v of %v, want the update of %s", received.methods, received.uris, fileURI)
+	}
+
+	// Unsubscribing the file keeps the directory subscribed
+	dispatch(mcpMethodResourcesUnsubscribe, fileURI, notifier)
+	received.uris = nil
+	resourceSubscriptions.documentsChanged(change)
+	if len(received.uris) != 1 || received.uris[0] != fileURI {
+		t.Errorf("got notifications of %v, want %s by the directory", received.uris, fileURI)
+	}
+
+	dispatch(mcpMethodResourcesUnsubscribe, dirURI, notifier)
+	received.uris = nil
+	resourceSubscriptions.documentsChanged(change)
+	if len(received.uris) != 0 {
+		t.Errorf("got notifications of %v once unsubscribed", received.uris)
+	}
+}
+
+// sseTestSession is a session of the SSE transport
+type sseTestSession struct {
+	id string
+}
+
+func (s *sseTestSession) SessionID() string                                   { return s.id }
+func (s *sseTestSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return nil }
+func (s *sseTestSession) Initialize()                                         {}
+func (s *sseTestSession) Initialized() bool                                   { return true }
+
+func TestRemoveSSESubscriber(t *testing.T) {
+	session := &sseTestSession{id: "closed-sse"}
+	resourceSubscriptions.watch(&mcpNotifier{sessionID: sseSubscriberID(session.id)})
+	t.Cleanup(func() { resourceSubscriptions.remove(sseSubscriberID(session.id)) })
+
+	// The watcher of the resources/list of an SSE session is removed once its stream is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	removeSSESubscriber(ctx, session)
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resourceSubscriptions.mutex.Lock()
+		_, ok := resourceSubscriptions.subscribers[sseSubscriberID(session.id)]
+		resourceSubscriptions.mutex.Unlock()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the subscriber of the closed SSE session is not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MCPForwarder sends a JSON-RPC message to the MCP server of the daemon and returns its response
+type MCPForwarder func(ctx context.Context, message []byte) ([]byte, error)
+
+// ServeMCPStdio serves the MCP tools over stdin and stdout until stdin is closed
+// The tools are registered as the daemon does, but the index is owned by the daemon, so their calls are
+// forwarded to it, the other requests, e.g. initialize and tools/list, are answered locally. The resources are
+// listed and read by the daemon too, but they could not be subscribed since the daemon could not notify stdio.
+func ServeMCPStdio(forward MCPForwarder) error {
+	mcpServer := newMCPServer(
+		server.WithResourceCapabilities(false, false),
+		server.WithToolHandlerMiddleware(func(server.ToolHandlerFunc) server.ToolHandlerFunc {
+			return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return forwardToolCall(ctx, forward, request)
+			}
+		}))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	stdout := &lockedWriter{w: os.Stdout}
+	stdio := server.NewStdioServer(mcpServer)
+	stdio.SetErrorLogger(log.New(os.Stderr, "", log.LstdFlags))
+	return stdio.Listen(ctx, forwardResourceMessages(ctx, forward, os.Stdin, stdout), stdout)
+}
+
+// lockedWriter serializes the writes of the responses of the stdio server and the forwarded messages
+type lockedWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.w.Write(p)
+}
+
+// forwardResourceMessages forwards the resource requests read from stdin to the daemon and writes their responses
+// to stdout, the returned reader reads the other messages for the stdio server
+func forwardResourceMessages(ctx context.Context, forward MCPForwarder, stdin io.Reader, stdout io.Writer) io.Reader {
+	reader, writer := io.Pipe()
+	forwarded := map[string]bool{
+		string(mcp.MethodResourcesList): true,
+		string(mcp.MethodResourcesRead): true,
+	}
+
+	go func() {
+		lines := bufio.NewReader(stdin)
+		for {
+			line, err := lines.ReadBytes('\n')
+			if len(line) > 0 {
+				var base streamableMessage
+				if json.Unmarshal(line, &base) == nil && forwarded[base.Method] {
+					go forwardResourceMessage(ctx, forward, line, base.ID, stdout)
+				} else if _, err := writer.Write(line); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return reader
+}
+
+// forwardResourceMessage forwards a resource request to the daemon and writes its response
+func forwardResourceMessage(ctx context.Context, forward MCPForwarder, message []byte, id json.RawMessage,
+	stdout io.Writer) {
+	response, err := forward(ctx, bytes.TrimSpace(message))
+	if err != nil {
+		response, _ = json.Marshal(mcp.NewJSONRPCError(id, mcp.INTERNAL_ERROR, err.Error(), nil))
+	}
+
+	if _, err := fmt.Fprintf(stdout, "%s\n", bytes.TrimSpace(response)); err != nil {
+		log.Printf("Failed to write MCP response: %v", err)
+	}
+}
+
+// forwardToolCall calls the tool of the request by the MCP server of the daemon
+func forwardToolCall(ctx context.Context, forward MCPForwarder, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	message, err := json.Marshal(map[string]any{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"id":      1,
+		"method":  mcp.MethodToolsCall,
+		"params":  request.Params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := forward(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Result *json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, errors.New(response.Error.Message)
+	}
+	if response.Result == nil {
+		return nil, errors.New("empty response of the tool call")
+	}
+
+	return parseCallToolResult(*response.Result)
+}
+
+// parseCallToolResult parses the result of a tool call
+// Tools print empty lines as empty text contents, which are rejected by mcp.ParseContent
+func parseCallToolResult(data []byte) (*mcp.CallToolResult, error) {
+	var raw struct {
+		Content []map[string]any `json:"content"`
+		IsError bool             `json:"isError"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	result := &mcp.CallToolResult{IsError: raw.IsError}
+	for _, content := range raw.Content {
+		if mcp.ExtractString(content, "type") == "text" {
+			result.Content = append(result.Content, mcp.NewTextContent(mcp.ExtractString(content, "text")))
+			continue
+		}
+
+		parsed, err := mcp.ParseContent(content)
+		if err != nil {
+			return nil, err
+		}
+		result.Content = append(result.Content, parsed)
+	}
+
+	return result, nil
+}
+
+// handleMCPMessage handles a single MCP JSON-RPC message without a session and responds its result
+// It's how the stdio transport calls the tools of the daemon, notifications are accepted without a response
+func handleMCPMessage(mcpServer *server.MCPServer, w http.ResponseWriter, r *http.Request) {
+	if !checkMCPOrigin(w, r) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	message, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := dispatchMCPMessage(r.Context(), mcpServer, message, nil)
+	if response == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write MCP response: %v", err)
+	}
+}
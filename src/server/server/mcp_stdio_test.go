@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeForwarder records the forwarded messages and responds them by respond
+type fakeForwarder struct {
+	mutex    sync.Mutex
+	messages []map[string]any
+	respond  func(message map[string]any) ([]byte, error)
+}
+
+func (f *fakeForwarder) forward(ctx context.Context, message []byte) ([]byte, error) {
+	var decoded map[string]any
+	if err := json.Unmarshal(message, &decoded); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	f.messages = append(f.messages, decoded)
+	f.mutex.Unlock()
+	return f.respond(decoded)
+}
+
+func TestForwardResourceMessages(t *testing.T) {
+	forwarder := &fakeForwarder{respond: func(message map[string]any) ([]byte, error) {
+		if message["id"] == float64(4) {
+			return nil, errors.New("daemon is not running")
+		}
+		return json.Marshal(map[string]any{"jsonrpc": "2.0", "id": message["id"], "result": map[string]any{}})
+	}}
+
+	stdin := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"resources/read","params":{"uri":"file:///a.go"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"resources/read","params":{"uri":"file:///b.go"}}`,
+		`not json`,
+	}, "\n") + "\n"
+	var output bytes.Buffer
+	stdout := &lockedWriter{w: &output}
+
+	// The other messages are read by the stdio server, the resource requests are answered by the daemon
+	local, err := io.ReadAll(forwardResourceMessages(context.Background(), forwarder.forward,
+		strings.NewReader(stdin), stdout))
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	want := `{"jsonrpc":"2.0","id":2,"method":"tools/list"}` + "\nnot json\n"
+	if string(local) != want {
+		t.Errorf("local messages got %q, want %q", local, want)
+	}
+
+	var lines []string
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stdout.mutex.Lock()
+		lines = strings.Split(strings.TrimSpace(output.String()), "\n")
+		stdout.mutex.Unlock()
+		if len(lines) == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got responses %q, want 3", lines)
+	}
+
+	responses := map[float64]map[string]any{}
+	for _, line := range lines {
+		var response map[string]any
+		if err := json.Unmarshal([]byte(line), &response); err != nil {
+			t.Fatalf("Invalid response %q: %v", line, err)
+		}
+		responses[response["id"].(float64)] = response
+	}
+	if responses[1]["result"] == nil || responses[3]["result"] == nil {
+		t.Errorf("got responses %v, want the results of 1 and 3", responses)
+	}
+
+	// A failed forward is responded as an internal error of the request
+	rpcError, _ := responses[4]["error"].(map[string]any)
+	if rpcError["code"] != float64(mcp.INTERNAL_ERROR) || rpcError["message"] != "daemon is not running" {
+		t.Errorf("got response %v, want an internal error", responses[4])
+	}
+}
+
+func TestForwardToolCall(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "search_content"
+	request.Params.Arguments = map[string]any{"query": "foo"}
+
+	tests := []struct {
+		name    string
+		respond func(message map[string]any) ([]byte, error)
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "result",
+			respond: func(map[string]any) ([]byte, error) {
+				return []byte(`{"jsonrpc":"2.0","id":1,"result":{"content":[` +
+					`{"type":"text","text":"Found 1 file."},{"type":"text","text":""}]}}`), nil
+			},
+			want: []string{"Found 1 file.", ""},
+		},
+		{
+			name: "error of the tool",
+			respond: func(map[string]any) ([]byte, error) {
+				return []byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"workspace not found"}}`), nil
+			},
+			wantErr: "workspace not found",
+		},
+		{
+			name: "error of the forward",
+			respond: func(map[string]any) ([]byte, error) {
+				return nil, errors.New("connection refused")
+			},
+			wantErr: "connection refused",
+		},
+		{
+			name: "empty response",
+			respond: func(map[string]any) ([]byte, error) {
+				return []byte(`{"jsonrpc":"2.0","id":1}`), nil
+			},
+			wantErr: "empty response of the tool call",
+		},
+		{
+			name: "invalid response",
+			respond: func(map[string]any) ([]byte, error) {
+				return []byte(`<html>`), nil
+			},
+			wantErr: "invalid character",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarder := &fakeForwarder{respond: tt.respond}
+			result, err := forwardToolCall(context.Background(), forwarder.forward, request)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("forwardToolCall() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("forwardToolCall() error = %v", err)
+			}
+
+			texts := []string{}
+			for _, content := range result.Content {
+				texts = append(texts, content.(mcp.TextContent).Text)
+			}
+			if strings.Join(texts, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got contents %q, want %q", texts, tt.want)
+			}
+
+			// The call is forwarded as a tools/call request with the parameters of the request
+			message := forwarder.messages[0]
+			params, _ := message["params"].(map[string]any)
+			if message["method"] != string(mcp.MethodToolsCall) || params["name"] != "search_content" {
+				t.Errorf("got forwarded message %v", message)
+			}
+		})
+	}
+}
+
+func TestParseCallToolResult(t *testing.T) {
+	result, err := parseCallToolResult([]byte(`{"isError":true,"content":[` +
+		`{"type":"text","text":""},{"type":"image","data":"aGk=","mimeType":"image/png"}]}`))
+	if err != nil {
+		t.Fatalf("parseCallToolResult() error = %v", err)
+	}
+	if !result.IsError || len(result.Content) != 2 {
+		t.Fatalf("got result %+v, want an error with 2 contents", result)
+	}
+	if text, ok := result.Content[0].(mcp.TextContent); !ok || text.Text != "" {
+		t.Errorf("got content %#v, want the empty text", result.Content[0])
+	}
+	if image, ok := result.Content[1].(mcp.ImageContent); !ok || image.MIMEType != "image/png" {
+		t.Errorf("got content %#v, want the image", result.Content[1])
+	}
+
+	for _, data := range []string{`{"content":[{"type":"unknown"}]}`, `{"content":"text"}`} {
+		if _, err := parseCallToolResult([]byte(data)); err == nil {
+			t.Errorf("parseCallToolResult(%s) expected an error", data)
+		}
+	}
+}
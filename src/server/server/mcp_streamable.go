@@ -0,0 +1,615 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codetrek/haystack/conf"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	mcpSessionHeader     = "Mcp-Session-Id"
+	mcpLastEventIdHeader = "Last-Event-ID"
+
+	// mcpSessionIdleTimeout is how long a session without requests or an open stream is kept
+	mcpSessionIdleTimeout = 30 * time.Minute
+	// mcpSessionExpiryInterval is how often the idle sessions are removed
+	mcpSessionExpiryInterval = time.Minute
+	mcpMaxSessions           = 256
+	// mcpMaxSessionEvents is the number of the latest events of a session kept for resuming its streams
+	mcpMaxSessionEvents = 256
+	mcpMaxMessageSize   = 16 * 1024 * 1024
+	mcpKeepAlive        = 15 * time.Second
+)
+
+// streamEvent is an SSE event of a stream of a session
+// The standalone stream opened by GET is stream 0, each POST streaming its responses has its own stream
+type streamEvent struct {
+	stream uint64
+	seq    uint64
+	data   []byte
+}
+
+// id returns the SSE event id, it refers to the stream, so the stream could be resumed after its events are dropped
+func (e *streamEvent) id() string {
+	return fmt.Sprintf("%d-%d", e.stream, e.seq)
+}
+
+// parseEventId parses the SSE event id to the stream and the sequence number
+func parseEventId(id string) (uint64, uint64, bool) {
+	stream, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	streamId, err1 := strconv.ParseUint(stream, 10, 64)
+	seqId, err2 := strconv.ParseUint(seq, 10, 64)
+	return streamId, seqId, err1 == nil && err2 == nil
+}
+
+// streamableSession is a client session of the Streamable HTTP transport
+// Responses and notifications are recorded as events, so a dropped stream is resumed by the Last-Event-ID
+type streamableSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+	done          chan struct{}
+
+	mutex      sync.Mutex
+	events     []streamEvent
+	nextSeq    uint64
+	nextStream uint64
+	wake       chan struct{}       // closed once an event is recorded or a stream is finished
+	active     map[uint64]struct{} // streams of POST requests still being handled
+	streaming  bool                // whether the standalone stream is open
+	lastActive time.Time
+}
+
+func newStreamableSession() (*streamableSession, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &streamableSession{
+		id:            hex.EncodeToString(id),
+		notifications: make(chan mcp.JSONRPCNotification, 100),
+		done:          make(chan struct{}),
+		wake:          make(chan struct{}),
+		active:        map[uint64]struct{}{},
+		lastActive:    time.Now(),
+	}, nil
+}
+
+func (s *streamableSession) SessionID() string {
+	return s.id
+}
+
+func (s *streamableSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *streamableSession) Initialize() {
+	s.initialized.Store(true)
+}
+
+func (s *streamableSession) Initialized() bool {
+	return s.initialized.Load()
+}
+
+// recordNotifications records the notifications of the session to the standalone stream until it's closed
+func (s *streamableSession) recordNotifications() {
+	for {
+		select {
+		case notification := <-s.notifications:
+			data, err := json.Marshal(notification)
+			if err != nil {
+				log.Printf("Failed to marshal MCP notification: %v", err)
+				continue
+			}
+			s.record(0, data)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// newStream returns the id of a new stream of a POST
+func (s *streamableSession) newStream() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextStream++
+	s.active[s.nextStream] = struct{}{}
+	return s.nextStream
+}
+
+// finishStream marks the stream of a POST as finished once all its responses are recorded
+func (s *streamableSession) finishStream(stream uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.active, stream)
+	s.notify()
+}
+
+// notify wakes up the streams waiting for events, the caller must hold the lock
+func (s *streamableSession) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// record records an event of the stream, the oldest events are dropped
+func (s *streamableSession) record(stream uint64, data []byte) streamEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextSeq++
+	event := streamEvent{stream: stream, seq: s.nextSeq, data: data}
+	s.events = append(s.events, event)
+	if len(s.events) > mcpMaxSessionEvents {
+		s.events = slices.Delete(s.events, 0, len(s.events)-mcpMaxSessionEvents)
+	}
+
+	s.notify()
+	return event
+}
+
+// eventsAfter returns the recorded events of the stream after the sequence number, the channel closed once
+// the next event is recorded, and whether more events could be recorded to the stream
+func (s *streamableSession) eventsAfter(stream, seq uint64) ([]streamEvent, <-chan struct{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := []streamEvent{}
+	for _, event := range s.events {
+		if event.stream == stream && event.seq > seq {
+			events = append(events, event)
+		}
+	}
+
+	_, active := s.active[stream]
+	return events, s.wake, stream == 0 || active
+}
+
+func (s *streamableSession) touch() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastActive = time.Now()
+}
+
+// expired returns true if the session has been idle for too long
+func (s *streamableSession) expired() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return !s.streaming && time.Since(s.lastActive) > mcpSessionIdleTimeout
+}
+
+// streamableHTTPServer serves the MCP server by the Streamable HTTP transport on a single endpoint
+// POST sends messages and receives their responses as JSON or an SSE stream, GET opens the standalone
+// SSE stream of the server notifications, and DELETE terminates the session
+type streamableHTTPServer struct {
+	mcpServer *server.MCPServer
+
+	mutex    sync.Mutex
+	sessions map[string]*streamableSession
+}
+
+func newStreamableHTTPServer(mcpServer *server.MCPServer) *streamableHTTPServer {
+	return &streamableHTTPServer{
+		mcpServer: mcpServer,
+		sessions:  map[string]*streamableSession{},
+	}
+}
+
+func (s *streamableHTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !checkMCPOrigin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers",
+			"Content-Type, Accept, Authorization, "+mcpSessionHeader+", "+mcpLastEventIdHeader+", Mcp-Protocol-Version")
+		w.Header().Set("Access-Control-Max-Age", "86400")
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost:
+		s.handlePost(w, r)
+	case http.MethodGet:
+		s.handleGet(w, r)
+	case http.MethodDelete:
+		s.handleDelete(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// checkMCPOrigin validates the Origin of browser requests, so web pages can't call the local server, e.g. by
+// DNS rebinding. Localhost and the configured origins are allowed, and CORS headers are set for them.
+// Requests without Origin are not from browsers and are allowed.
+func checkMCPOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if !isAllowedOrigin(origin) {
+		log.Printf("MCP request from origin `%s` is forbidden", origin)
+		http.Error(w, "Forbidden origin", http.StatusForbidden)
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Expose-Headers", mcpSessionHeader)
+	w.Header().Add("Vary", "Origin")
+	return true
+}
+
+func isAllowedOrigin(origin string) bool {
+	allowed := conf.Get().Server.MCP.AllowedOrigins
+	if slices.Contains(allowed, "*") || slices.Contains(allowed, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// session returns the session of the request, it responds the error if it's missing or not found
+func (s *streamableHTTPServer) session(w http.ResponseWriter, r *http.Request) *streamableSession {
+	id := r.Header.Get(mcpSessionHeader)
+	if id == "" {
+		http.Error(w, "Missing "+mcpSessionHeader, http.StatusBadRequest)
+		return nil
+	}
+
+	s.mutex.Lock()
+	session := s.sessions[id]
+	s.mutex.Unlock()
+
+	// Clients start a new session once the session is not found
+	if session == nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return nil
+	}
+
+	session.touch()
+	return session
+}
+
+// expireSessions removes the sessions idle for too long, the caller must hold the lock
+func (s *streamableHTTPServer) expireSessions() {
+	for id, session := range s.sessions {
+		if session.expired() {
+			s.closeSession(id)
+		}
+	}
+}
+
+// runExpiry removes the idle sessions every interval until stop is closed, so their subscriptions are
+// released even if no new session is created
+func (s *streamableHTTPServer) runExpiry(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			s.expireSessions()
+			s.mutex.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// createSession creates and registers a new session, expired sessions are removed first
+func (s *streamableHTTPServer) createSession(ctx context.Context) (*streamableSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expireSessions()
+	if len(s.sessions) >= mcpMaxSessions {
+		return nil, fmt.Errorf("too many MCP sessions")
+	}
+
+	session, err := newStreamableSession()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mcpServer.RegisterSession(ctx, session); err != nil {
+		return nil, err
+	}
+	s.sessions[session.id] = session
+	go session.recordNotifications()
+
+	return session, nil
+}
+
+// closeSession unregisters the session, the caller must hold the lock
+func (s *streamableHTTPServer) closeSession(id string) {
+	session := s.sessions[id]
+	if session == nil {
+		return
+	}
+
+	delete(s.sessions, id)
+	s.mcpServer.UnregisterSession(id)
+	resourceSubscriptions.remove(id)
+	close(session.done)
+}
+
+type streamableMessage struct {
+	Method string          `json:"method"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// parseMessages parses a JSON-RPC message or a batch of them
+func parseMessages(body []byte) ([]json.RawMessage, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, true, err
+		}
+		return batch, true, nil
+	}
+
+	var message json.RawMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, false, err
+	}
+	return []json.RawMessage{message}, false, nil
+}
+
+func (s *streamableHTTPServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, mcpMaxMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	messages, batch, err := parseMessages(body)
+	if err != nil || len(messages) == 0 {
+		http.Error(w, "Invalid JSON-RPC message", http.StatusBadRequest)
+		return
+	}
+
+	// Requests have both the method and the id, the responses of the client to the server requests have no method
+	requests := 0
+	initialize := false
+	for _, message := range messages {
+		var base streamableMessage
+		json.Unmarshal(message, &base)
+		if base.Method != "" && len(base.ID) > 0 && string(base.ID) != "null" {
+			requests++
+		}
+		if base.Method == string(mcp.MethodInitialize) {
+			initialize = true
+		}
+	}
+
+	var session *streamableSession
+	if initialize {
+		// The initialize request starts a new session, it can't be batched
+		if len(messages) > 1 {
+			http.Error(w, "The initialize request must not be batched", http.StatusBadRequest)
+			return
+		}
+
+		session, err = s.createSession(context.WithoutCancel(r.Context()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(mcpSessionHeader, session.id)
+	} else if session = s.session(w, r); session == nil {
+		return
+	}
+
+	if requests == 0 {
+		ctx := s.mcpServer.WithContext(r.Context(), session)
+		for _, message := range messages {
+			var base streamableMessage
+			json.Unmarshal(message, &base)
+			if base.Method != "" {
+				dispatchMCPMessage(ctx, s.mcpServer, message, sessionNotifier(session))
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamResponses(w, r, session, messages)
+		return
+	}
+
+	ctx := s.mcpServer.WithContext(r.Context(), session)
+	responses := []mcp.JSONRPCMessage{}
+	for _, message := range messages {
+		if response := dispatchMCPMessage(ctx, s.mcpServer, message, sessionNotifier(session)); response != nil {
+			responses = append(responses, response)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+	} else {
+		json.NewEncoder(w).Encode(responses[0])
+	}
+}
+
+// streamResponses responds the messages by an SSE stream, each response is an event of the stream
+// Messages are handled even if the client disconnects, so their responses could be resumed by GET
+func (s *streamableHTTPServer) streamResponses(w http.ResponseWriter, r *http.Request,
+	session *streamableSession, messages []json.RawMessage) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	stream := session.newStream()
+	defer session.finishStream(stream)
+	ctx := s.mcpServer.WithContext(context.WithoutCancel(r.Context()), session)
+	connected := true
+	for _, message := range messages {
+		response := dispatchMCPMessage(ctx, s.mcpServer, message, sessionNotifier(session))
+		if response == nil {
+			continue
+		}
+
+		data, err := json.Marshal(response)
+		if err != nil {
+			log.Printf("Failed to marshal MCP response: %v", err)
+			continue
+		}
+
+		event := session.record(stream, data)
+		if connected && r.Context().Err() == nil {
+			connected = writeStreamEvent(w, flusher, &event) == nil
+		}
+	}
+}
+
+func writeStreamEvent(w io.Writer, flusher http.Flusher, event *streamEvent) error {
+	if _, err := fmt.Fprintf(w, "id: %s\nevent: message\ndata: %s\n\n", event.id(), event.data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// handleGet opens the standalone stream of the session, or resumes a stream by the Last-Event-ID
+// The events after the last event are replayed, streams of POST requests are closed once they are finished
+func (s *streamableHTTPServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := s.session(w, r)
+	if session == nil {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var stream, seq uint64
+	if lastEventId := r.Header.Get(mcpLastEventIdHeader); lastEventId != "" {
+		if stream, seq, ok = parseEventId(lastEventId); !ok {
+			http.Error(w, "Invalid "+mcpLastEventIdHeader, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Notifications are only sent to one standalone stream
+	if stream == 0 {
+		session.mutex.Lock()
+		streaming := session.streaming
+		session.streaming = true
+		session.mutex.Unlock()
+		if streaming {
+			http.Error(w, "The stream of the session is already open", http.StatusConflict)
+			return
+		}
+
+		defer func() {
+			session.mutex.Lock()
+			session.streaming = false
+			session.lastActive = time.Now()
+			session.mutex.Unlock()
+		}()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(mcpKeepAlive)
+	defer ticker.Stop()
+	for {
+		events, wake, open := session.eventsAfter(stream, seq)
+		for _, event := range events {
+			if err := writeStreamEvent(w, flusher, &event); err != nil {
+				return
+			}
+			seq = event.seq
+		}
+
+		if !open {
+			return
+		}
+
+		select {
+		case <-wake:
+		case <-ticker.C:
+			// SSE comments keep the connection alive through proxies, clients ignore them
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-session.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleDelete terminates the session
+func (s *streamableHTTPServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	session := s.session(w, r)
+	if session == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	s.closeSession(session.id)
+	s.mutex.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mcpInitializeMessage = `{"jsonrpc":"2.0","id":1,"method":"initialize",` +
+	`"params":{"protocolVersion":"2024-11-05","clientInfo":{"name":"test","version":"1.0"},"capabilities":{}}}`
+
+// newTestStreamableServer returns a streamable server of all the MCP tools, its sessions are closed on cleanup
+func newTestStreamableServer(t *testing.T) *streamableHTTPServer {
+	s := newStreamableHTTPServer(newMCPServer())
+	t.Cleanup(func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for id := range s.sessions {
+			s.closeSession(id)
+		}
+	})
+	return s
+}
+
+// serveMCP sends the request to the streamable server, headers are pairs of names and values
+func serveMCP(s *streamableHTTPServer, method string, body string, headers ...string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/mcp/stream", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json, text/event-stream")
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	s.ServeHTTP(recorder, r)
+	return recorder
+}
+
+// initializeSession initializes a new session and returns its id
+func initializeSession(t *testing.T, s *streamableHTTPServer) string {
+	recorder := serveMCP(s, http.MethodPost, mcpInitializeMessage, "Accept", "application/json")
+	id := recorder.Header().Get(mcpSessionHeader)
+	if recorder.Code != http.StatusOK || id == "" {
+		t.Fatalf("initialize got status %d, session %q: %s", recorder.Code, id, recorder.Body)
+	}
+	return id
+}
+
+// sseMessages returns the ids and data of the events of an SSE stream
+func sseMessages(body string) ([]string, []map[string]any) {
+	ids, messages := []string{}, []map[string]any{}
+	for _, line := range strings.Split(body, "\n") {
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var message map[string]any
+			json.Unmarshal([]byte(data), &message)
+			messages = append(messages, message)
+		}
+	}
+	return ids, messages
+}
+
+func TestStreamableSession(t *testing.T) {
+	s := newTestStreamableServer(t)
+
+	// initialize creates a session and responds its id in the header
+	id := initializeSession(t, s)
+	session := s.sessions[id]
+	if session == nil || !session.Initialized() {
+		t.Fatalf("session %q is not registered and initialized", id)
+	}
+
+	// The initialize request starts a session, so it can't be batched
+	recorder := serveMCP(s, http.MethodPost,
+		"["+mcpInitializeMessage+`,{"jsonrpc":"2.0","id":2,"method":"ping"}]`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("batched initialize got status %d, want 400", recorder.Code)
+	}
+
+	// Other requests need the id of an existing session
+	ping := `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+	if recorder := serveMCP(s, http.MethodPost, ping); recorder.Code != http.StatusBadRequest {
+		t.Errorf("missing session got status %d, want 400", recorder.Code)
+	}
+	recorder = serveMCP(s, http.MethodPost, ping, mcpSessionHeader, "unknown")
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("unknown session got status %d, want 404", recorder.Code)
+	}
+	if recorder := serveMCP(s, http.MethodPost, "{", mcpSessionHeader, id); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid message got status %d, want 400", recorder.Code)
+	}
+
+	// DELETE terminates the session
+	if recorder := serveMCP(s, http.MethodDelete, "", mcpSessionHeader, id); recorder.Code != http.StatusNoContent {
+		t.Errorf("DELETE got status %d, want 204", recorder.Code)
+	}
+	select {
+	case <-session.done:
+	default:
+		t.Errorf("session is not closed once it's deleted")
+	}
+	if recorder := serveMCP(s, http.MethodPost, ping, mcpSessionHeader, id); recorder.Code != http.StatusNotFound {
+		t.Errorf("deleted session got status %d, want 404", recorder.Code)
+	}
+}
+
+func TestStreamablePost(t *testing.T) {
+	s := newTestStreamableServer(t)
+	id := initializeSession(t, s)
+
+	// Notifications and responses of the client are accepted without a body
+	recorder := serveMCP(s, http.MethodPost, `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		mcpSessionHeader, id)
+	if recorder.Code != http.StatusAccepted || recorder.Body.Len() != 0 {
+		t.Errorf("notification got status %d and body %q, want 202", recorder.Code, recorder.Body)
+	}
+
+	// A request is responded by JSON unless the client accepts SSE
+	recorder = serveMCP(s, http.MethodPost, `{"jsonrpc":"2.0","id":2,"method":"ping"}`,
+		mcpSessionHeader, id, "Accept", "application/json")
+	var response map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil ||
+		recorder.Header().Get("Content-Type") != "application/json" || response["id"] != float64(2) {
+		t.Errorf("JSON got status %d and body %s", recorder.Code, recorder.Body)
+	}
+
+	// A batch is responded by an array of the responses of its requests
+	batch := `[{"jsonrpc":"2.0","id":3,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"},` +
+		`{"jsonrpc":"2.0","id":4,"method":"tools/list"}]`
+	recorder = serveMCP(s, http.MethodPost, batch, mcpSessionHeader, id, "Accept", "application/json")
+	var responses []map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &responses); err != nil || len(responses) != 2 ||
+		responses[0]["id"] != float64(3) || responses[1]["id"] != float64(4) {
+		t.Errorf("batch got status %d and body %s, want the responses of 3 and 4", recorder.Code, recorder.Body)
+	}
+
+	// Each response of the SSE stream is an event, the stream ends once all of them are sent
+	recorder = serveMCP(s, http.MethodPost, batch, mcpSessionHeader, id)
+	ids, messages := sseMessages(recorder.Body.String())
+	if recorder.Header().Get("Content-Type") != "text/event-stream" || len(messages) != 2 ||
+		messages[0]["id"] != float64(3) || messages[1]["id"] != float64(4) {
+		t.Fatalf("SSE got status %d and body %s, want the events of 3 and 4", recorder.Code, recorder.Body)
+	}
+
+	// The stream is resumed by the events after the Last-Event-ID
+	recorder = serveMCP(s, http.MethodGet, "", mcpSessionHeader, id, "Accept", "text/event-stream",
+		mcpLastEventIdHeader, ids[0])
+	resumed, messages := sseMessages(recorder.Body.String())
+	if recorder.Code != http.StatusOK || len(resumed) != 1 || resumed[0] != ids[1] || messages[0]["id"] != float64(4) {
+		t.Errorf("resume after %s got status %d and body %s, want event %s", ids[0], recorder.Code, recorder.Body,
+			ids[1])
+	}
+
+	if recorder := serveMCP(s, http.MethodGet, "", mcpSessionHeader, id, "Accept", "text/event-stream",
+		mcpLastEventIdHeader, "invalid"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("invalid Last-Event-ID got status %d, want 400", recorder.Code)
+	}
+	if recorder := serveMCP(s, http.MethodGet, "", mcpSessionHeader, id,
+		"Accept", "application/json"); recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET without SSE got status %d, want 405", recorder.Code)
+	}
+
+	// Notifications are only sent to one standalone stream
+	s.sessions[id].streaming = true
+	if recorder := serveMCP(s, http.MethodGet, "", mcpSessionHeader, id,
+		"Accept", "text/event-stream"); recorder.Code != http.StatusConflict {
+		t.Errorf("second standalone stream got status %d, want 409", recorder.Code)
+	}
+}
+
+func TestStreamableOrigin(t *testing.T) {
+	s := newTestStreamableServer(t)
+
+	recorder := serveMCP(s, http.MethodPost, mcpInitializeMessage, "Origin", "https://evil.example")
+	if recorder.Code != http.StatusForbidden || len(s.sessions) != 0 {
+		t.Errorf("forbidden origin got status %d, want 403 without a session", recorder.Code)
+	}
+
+	recorder = serveMCP(s, http.MethodOptions, "", "Origin", "http://localhost:3000")
+	if recorder.Code != http.StatusNoContent ||
+		recorder.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Errorf("localhost preflight got status %d and headers %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestStreamableExpiry(t *testing.T) {
+	s := newTestStreamableServer(t)
+
+	// Sessions are limited, expired sessions are removed for new ones
+	for range mcpMaxSessions {
+		initializeSession(t, s)
+	}
+	if recorder := serveMCP(s, http.MethodPost, mcpInitializeMessage); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("too many sessions got status %d, want 503", recorder.Code)
+	}
+
+	var idle *streamableSession
+	for _, session := range s.sessions {
+		idle = session
+		break
+	}
+	idle.lastActive = time.Now().Add(-mcpSessionIdleTimeout - time.Minute)
+	id := initializeSession(t, s)
+	if s.sessions[idle.id] != nil || s.sessions[id] == nil || len(s.sessions) != mcpMaxSessions {
+		t.Errorf("the idle session is not replaced by the new one")
+	}
+
+	// An open standalone stream keeps the session
+	s.sessions[id].streaming = true
+	s.sessions[id].lastActive = time.Now().Add(-mcpSessionIdleTimeout - time.Minute)
+
+	// Idle sessions are removed by the timer without new sessions
+	idle = nil
+	for _, session := range s.sessions {
+		if session.id != id {
+			idle = session
+			break
+		}
+	}
+	idle.mutex.Lock()
+	idle.lastActive = time.Now().Add(-mcpSessionIdleTimeout - time.Minute)
+	idle.mutex.Unlock()
+
+	stop := make(chan struct{})
+	go s.runExpiry(time.Millisecond, stop)
+	defer close(stop)
+
+	select {
+	case <-idle.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the idle session is not expired by the timer")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.sessions[idle.id] != nil || s.sessions[id] == nil {
+		t.Errorf("got sessions %d, want the idle one removed and the streaming one kept", len(s.sessions))
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/codetrek/haystack/shared/types"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// contentLines returns the lines of the numbers, the content of each line is named by its number
+func contentLines(numbers ...int) []types.SearchContentLine {
+	lines := []types.SearchContentLine{}
+	for _, number := range numbers {
+		lines = append(lines, types.SearchContentLine{LineNumber: number, Content: "line" + string(rune('a'+number))})
+	}
+	return lines
+}
+
+func TestFormatSearchText(t *testing.T) {
+	result := &types.SearchContentToolResult{
+		TotalHits:  4,
+		TotalFiles: 1,
+		Expansions: map[string][]string{"recieve": {"receive"}, "hanlde": {"handle"}, "confg": {"config"}},
+		Variants:   map[string][]string{"tab_group": {"tabGroup"}, "http_server": {"HTTPServer"}},
+		Results: []types.SearchContentResult{{
+			File: "a.go",
+			Lines: []types.LineMatch{
+				// Matches of adjacent lines share their context
+				{Before: contentLines(3, 4), Line: contentLines(5)[0], After: contentLines(6, 7)},
+				{Before: contentLines(4, 5), Line: contentLines(6)[0], After: contentLines(7, 8)},
+				// A multi-line match, its context overlaps the previous one
+				{Before: contentLines(8, 9), Line: contentLines(10)[0], Span: contentLines(11), After: contentLines(12)},
+				{Before: contentLines(18), Line: contentLines(19)[0]},
+			},
+		}},
+	}
+
+	want := "Found 4 results in 1 files\n" +
+		"Fuzzy term `confg` expanded to: config\n" +
+		"Fuzzy term `hanlde` expanded to: handle\n" +
+		"Fuzzy term `recieve` expanded to: receive\n" +
+		"Term `http_server` matched as: HTTPServer\n" +
+		"Term `tab_group` matched as: tabGroup\n" +
+		"\nFile: a.go, 4 results\n" +
+		"3- lined\n4- linee\n5: linef\n6: lineg\n7- lineh\n8- linei\n9- linej\n10: linek\n11: linel\n12- linem\n" +
+		"--\n" +
+		"18- lines\n19: linet\n"
+	for range 5 {
+		if got := formatSearchText(result, false); got != want {
+			t.Fatalf("formatSearchText() got\n%s\nwant\n%s", got, want)
+		}
+	}
+}
+
+func TestHandleSearchFormat(t *testing.T) {
+	ws := newIndexedWorkspace(t, map[string]string{
+		"a.go": "func handleRequest() {}\n",
+		"b.go": "// handleRequest is called twice\nhandleRequest()\n",
+	})
+
+	search := func(format string) string {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = map[string]any{"query": "handleRequest", "workspace": ws.Path, "format": format}
+		result, err := handleSearch(context.Background(), request)
+		if err != nil {
+			t.Fatalf("handleSearch(%q) error = %v", format, err)
+		}
+		return result.Content[0].(mcp.TextContent).Text
+	}
+
+	var result types.SearchContentToolResult
+	if err := json.Unmarshal([]byte(search(MCPFormatJSON)), &result); err != nil {
+		t.Fatalf("Invalid JSON result: %v", err)
+	}
+	if result.TotalHits != 3 || result.TotalFiles != 2 || len(result.Results) != 2 {
+		t.Errorf("got JSON result %+v, want 3 hits in 2 files", result)
+	}
+
+	// The second match of b.go is in the context of the first one
+	text := search(MCPFormatText)
+	for _, want := range []string{"Found 3 results in 2 files", "1: func handleRequest() {}\n",
+		"1: // handleRequest is called twice\n2: handleRequest()\n"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text result %q doesn't contain %q", text, want)
+		}
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"query": "handleRequest", "workspace": ws.Path, "format": "xml"}
+	if _, err := handleSearch(context.Background(), request); err == nil {
+		t.Errorf("handleSearch() expected an error of the invalid format")
+	}
+}
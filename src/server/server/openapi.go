@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/shared/running"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
+// openAPIDocument returns the OpenAPI document describing the routes
+func openAPIDocument(routes []*apiRoute) map[string]any {
+	schemas := map[string]any{}
+	errorResponse := map[string]any{
+		"description": "The error of the request, the HTTP status is of its code",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": schemaOf(reflect.TypeFor[types.APIErrorResponse](), schemas)},
+		},
+	}
+
+	paths := map[string]any{}
+	for _, route := range routes {
+		operation := map[string]any{
+			"operationId": operationID(route),
+			"summary":     route.summary,
+			"tags":        []string{strings.Split(strings.TrimPrefix(route.path, apiV2Prefix), "/")[0]},
+		}
+		if route.scope == "" {
+			operation["security"] = []any{}
+		} else {
+			operation["description"] = fmt.Sprintf("Requires a token of the `%s` scope.", route.scope)
+		}
+
+		if route.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemaOf(route.request, schemas)},
+				},
+			}
+		}
+
+		var content map[string]any
+		if route.stream {
+			record := map[string]any{"schema": schemaOf(route.response, schemas)}
+			content = map[string]any{"application/x-ndjson": record, "text/event-stream": record}
+		} else {
+			content = map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{
+						"type":       "object",
+						"required":   []string{"data"},
+						"properties": map[string]any{"data": schemaOf(route.response, schemas)},
+					},
+				},
+			}
+		}
+		operation["responses"] = map[string]any{
+			fmt.Sprint(route.status): map[string]any{
+				"description": http.StatusText(route.status),
+				"content":     content,
+			},
+			"default": errorResponse,
+		}
+
+		if paths[route.path] == nil {
+			paths[route.path] = map[string]any{}
+		}
+		paths[route.path].(map[string]any)[strings.ToLower(route.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Haystack API",
+			"version": running.Version(),
+		},
+		"servers": []any{
+			map[string]any{"url": fmt.Sprintf("http://127.0.0.1:%d", conf.Get().Global.Port)},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"token": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []any{map[string]any{"token": []string{}}},
+	}
+}
+
+// operationID returns the ID of the operation of the route, e.g. searchContentStream
+func operationID(route *apiRoute) string {
+	var id strings.Builder
+	for i, word := range strings.FieldsFunc(strings.TrimPrefix(route.path, apiV2Prefix), func(c rune) bool {
+		return c == '/' || c == '-' || c == '.'
+	}) {
+		if i > 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		id.WriteString(word)
+	}
+	return id.String()
+}
+
+// schemaOf returns the schema of the type, the structs are added to schemas and referred by their names
+func schemaOf(t reflect.Type, schemas map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType, t.Kind() == reflect.Interface:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; !ok {
+			// Set before the fields, so the recursive types refer to it
+			schemas[t.Name()] = map[string]any{}
+			properties := map[string]any{}
+			structProperties(t, properties, schemas)
+			schemas[t.Name()] = map[string]any{"type": "object", "properties": properties}
+		}
+		return ref
+	default:
+		return map[string]any{}
+	}
+}
+
+// structProperties adds the JSON fields of the struct to properties, the embedded structs are flattened
+func structProperties(t reflect.Type, properties map[string]any, schemas map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				structProperties(embedded, properties, schemas)
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaOf(field.Type, schemas)
+	}
+}
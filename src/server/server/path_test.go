@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/shared/types"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestHandlersRejectEscapingPaths checks every API and MCP tool taking a path of a workspace rejects the paths
+// pointing outside of it
+func TestHandlersRejectEscapingPaths(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "haystack-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	conf.Get().Global.DataPath = filepath.Join(tempDir, "data")
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer fulltext.CloseAndWait()
+	if err := workspace.Init(); err != nil {
+		t.Fatalf("Workspace Init failed: %v", err)
+	}
+
+	wsPath := filepath.Join(tempDir, "ws")
+	outside := filepath.Join(tempDir, "outside")
+	for _, dir := range []string{wsPath, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.go"), []byte("package secret\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	symlinks := true
+	if err := os.Symlink(outside, filepath.Join(wsPath, "link")); err != nil {
+		symlinks = false
+	}
+
+	ws, err := workspace.Create(wsPath)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer workspace.Delete(ws.ID)
+
+	paths := []string{"../outside/secret.go", "../../etc", outside, filepath.Join(outside, "secret.go")}
+	if symlinks {
+		paths = append(paths, "link/secret.go")
+	}
+
+	// Each handler returns the error message of the path, or "" if it's accepted
+	handlers := map[string]func(path string) string{
+		"document/update": func(path string) string {
+			return postAPI(t, handleUpdateDocument, types.DocumentUpdateRequest{Workspace: wsPath, Path: path})
+		},
+		"document/delete": func(path string) string {
+			return postAPI(t, handleDeleteDocument, types.DocumentDeleteRequest{Workspace: wsPath, Path: path})
+		},
+		"document/overlay/set": func(path string) string {
+			return postAPI(t, handleSetOverlay, types.OverlaySetRequest{Workspace: wsPath, Path: path, Content: "x"})
+		},
+		"document/overlay/clear": func(path string) string {
+			return postAPI(t, handleClearOverlay, types.OverlayClearRequest{Workspace: wsPath, Paths: []string{path}})
+		},
+		"search/content": func(path string) string {
+			return postAPI(t, handleSearchContent, searchRequest(wsPath, path))
+		},
+		"search/content/stream": func(path string) string {
+			return postAPI(t, handleSearchContentStream, searchRequest(wsPath, path))
+		},
+		"search/files": func(path string) string {
+			return postAPI(t, handleSearchFiles, types.SearchFilesRequest{Workspace: wsPath, Query: "secret",
+				Filters: &types.SearchFilters{Path: path}})
+		},
+		"replace/preview": func(path string) string {
+			return postAPI(t, handleReplacePreview, types.ReplaceRequest{
+				SearchContentRequest: searchRequest(wsPath, path), Replacement: "public"})
+		},
+		"replace/apply": func(path string) string {
+			return postAPI(t, handleReplaceApply, types.ReplaceApplyRequest{
+				ReplaceRequest: types.ReplaceRequest{SearchContentRequest: searchRequest(wsPath, ""), Replacement: "x"},
+				Files:          []types.ReplaceFile{{Workspace: wsPath, File: path, Hash: "hash"}},
+			})
+		},
+		string(HaystackSearch): func(path string) string {
+			return callTool(handleSearch, map[string]any{"workspace": wsPath, "query": "secret", "path": path})
+		},
+		string(HaystackReplace): func(path string) string {
+			return callTool(replaceToolHandler, map[string]any{"workspace": wsPath, "query": "secret",
+				"replacement": "public", "path": path})
+		},
+		string(HaystackReadFile): func(path string) string {
+			return callTool(readFileToolHandler, map[string]any{"workspace": wsPath, "path": path})
+		},
+		string(HaystackListDir): func(path string) string {
+			return callTool(listDirToolHandler, map[string]any{"workspace": wsPath, "path": path})
+		},
+		"resources/read": func(path string) string {
+			request := mcp.ReadResourceRequest{}
+			request.Params.URI = fileResourceScheme + escapeURIComponent(wsPath, false) + "/" +
+				escapeURIComponent(filepath.ToSlash(path), true)
+			if _, err := readResourceHandler(context.Background(), request); err != nil {
+				return err.Error()
+			}
+			return ""
+		},
+	}
+
+	for name, handler := range handlers {
+		for _, path := range paths {
+			message := handler(path)
+			if !strings.Contains(message, "invalid path") {
+				t.Errorf("%s with path %q got %q, want an invalid path error", name, path, message)
+			}
+		}
+	}
+
+	// Paths in the workspace are accepted
+	if message := handlers["document/overlay/set"]("src/main.go"); message != "" {
+		t.Errorf("document/overlay/set with a path in the workspace got %q", message)
+	}
+	if message := handlers["document/overlay/clear"]("src/main.go"); message != "" {
+		t.Errorf("document/overlay/clear with a path in the workspace got %q", message)
+	}
+	if message := handlers["search/content"]("src"); message != "" {
+		t.Errorf("search/content with a path in the workspace got %q", message)
+	}
+}
+
+func searchRequest(wsPath, path string) types.SearchContentRequest {
+	return types.SearchContentRequest{Workspace: wsPath, Query: "secret", Filters: &types.SearchFilters{Path: path}}
+}
+
+// postAPI calls the API handler and returns the message of its error, or the error of the replaced files
+func postAPI(t *testing.T, handler http.HandlerFunc, request any) string {
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+
+	var response struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Data    struct {
+			Conflicts []types.ReplaceFile `json:"conflicts"`
+		} `json:"data"`
+	}
+	// The first record of the streaming API is the error
+	line, _, _ := strings.Cut(recorder.Body.String(), "\n")
+	if err := json.Unmarshal([]byte(line), &response); err != nil {
+		return recorder.Body.String()
+	}
+
+	if response.Code != 0 || response.Type == types.StreamRecordError {
+		return response.Message
+	}
+	if len(response.Data.Conflicts) > 0 {
+		return response.Data.Conflicts[0].Error
+	}
+	return ""
+}
+
+// callTool calls the MCP tool handler and returns the message of its error
+func callTool(handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error),
+	arguments map[string]any) string {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = arguments
+	if _, err := handler(context.Background(), request); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/codetrek/haystack/server/searcher"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// handleReplacePreview handles the replace preview endpoint
+// It searches the query and returns the unified diffs of replacing the matches, files are not changed
+func handleReplacePreview(w http.ResponseWriter, r *http.Request) {
+	var request types.ReplaceRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	workspaces, err := validateSearchContentRequest(&request.SearchContentRequest)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.ReplacePreviewResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	start := time.Now()
+	result, err := searcher.PreviewReplace(r.Context(), workspaces, &request)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.ReplacePreviewResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	req, _ := json.Marshal(request)
+	log.Printf("Process /api/v1/replace/preview `%s`: took %s, found %d replacements in %d files, truncate: %t",
+		string(req), time.Since(start), result.TotalReplacements, len(result.Files), result.Truncate)
+
+	json.NewEncoder(w).Encode(types.ReplacePreviewResponse{
+		Code:    0,
+		Message: "Ok",
+		Data:    result,
+	})
+}
+
+// handleReplaceApply handles the replace apply endpoint
+// It rewrites the files of a preview whose content hashes still match, and re-indexes them
+func handleReplaceApply(w http.ResponseWriter, r *http.Request) {
+	var request types.ReplaceApplyRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	workspaces, err := validateSearchContentRequest(&request.SearchContentRequest)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.ReplaceApplyResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	start := time.Now()
+	result, err := searcher.ApplyReplace(workspaces, &request)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.ReplaceApplyResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("Process /api/v1/replace/apply `%s` -> `%s`: took %s, replaced %d matches in %d files, %d conflicts",
+		request.Query, request.Replacement, time.Since(start), result.TotalReplacements, len(result.Files), len(result.Conflicts))
+
+	json.NewEncoder(w).Encode(types.ReplaceApplyResponse{
+		Code:    0,
+		Message: "Ok",
+		Data:    result,
+	})
+}
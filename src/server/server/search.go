@@ -2,9 +2,11 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/codetrek/haystack/server/core/workspace"
@@ -26,28 +28,7 @@ func handleSearchContent(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	if request.Workspace == "" {
-		json.NewEncoder(w).Encode(types.SearchContentResponse{
-			Code:    1,
-			Message: "Workspace is required",
-		})
-		return
-	}
-
-	// Normalize the workspace path
-	// If the path is not absolute, return an error
-	workspacePath := utils.NormalizePath(request.Workspace)
-	if !filepath.IsAbs(workspacePath) {
-		json.NewEncoder(w).Encode(types.SearchContentResponse{
-			Code:    1,
-			Message: "Workspace is not absolute",
-		})
-		return
-	}
-
-	// Get the workspace by path
-	// If the workspace is not found, return an error
-	workspace, err := workspace.GetByPath(workspacePath)
+	workspaces, err := validateSearchContentRequest(&request)
 	if err != nil {
 		json.NewEncoder(w).Encode(types.SearchContentResponse{
 			Code:    1,
@@ -56,76 +37,182 @@ func handleSearchContent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// If the query is empty, return an error
-	if request.Query == "" {
-		json.NewEncoder(w).Encode(types.SearchContentResponse{
-			Code:    1,
-			Message: "Query is required",
-		})
-		return
-	}
-
 	start := time.Now()
 	// Search the content of the workspace
-	results, truncate := searcher.SearchContent(workspace, &request)
+	results := searcher.SearchContent(r.Context(), workspaces, &request)
 	defer func() {
 		totalHits := 0
-		for _, result := range results {
+		for _, result := range results.Results {
 			totalHits += len(result.Lines)
 		}
 		req, _ := json.Marshal(request)
 		log.Printf("Process /api/v1/search/content `%s`: took %s, found %d results in %d files, truncate: %t",
-			string(req), time.Since(start), totalHits, len(results), truncate)
+			string(req), time.Since(start), totalHits, len(results.Results), results.Truncate)
 	}()
 
 	json.NewEncoder(w).Encode(types.SearchContentResponse{
 		Code:    0,
 		Message: "Ok",
-		Data: struct {
-			Results  []types.SearchContentResult `json:"results,omitempty"`
-			Truncate bool                        `json:"truncate,omitempty"`
-		}{
-			Results:  results,
-			Truncate: truncate,
-		},
+		Data:    results,
 	})
 }
 
-// handleSearchContent handles the search content endpoint
-// It will search the content of the server
-func handleSearchFiles(w http.ResponseWriter, r *http.Request) {
-	var request types.SearchFilesRequest
+// handleSearchContentStream handles the streaming search content endpoint
+// It writes one record per matched file as soon as the file is matched, followed by a summary record.
+// Records are in the order the files are matched, unlike the ranked results of handleSearchContent.
+// Records are written as NDJSON, or as SSE events if the client accepts `text/event-stream` or passes `?format=sse`.
+// The search is cancelled once the client disconnects.
+func handleSearchContentStream(w http.ResponseWriter, r *http.Request) {
+	var request types.SearchContentRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	workspaces, err := validateSearchContentRequest(&request)
+	streamSearchContent(w, r, &request, workspaces, err)
+}
+
+// streamSearchContent writes the records of the search to the stream, or an error record if the request is invalid
+func streamSearchContent(w http.ResponseWriter, r *http.Request, request *types.SearchContentRequest,
+	workspaces []*workspace.Workspace, err error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+		return
+	}
+
+	sse := r.URL.Query().Get("format") == "sse" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
 	w.WriteHeader(http.StatusOK)
 
-	if request.Workspace == "" {
-		json.NewEncoder(w).Encode(types.SearchFilesResponse{
-			Code:    1,
-			Message: "Workspace is required",
+	var writeRecord = func(record types.SearchContentStreamRecord) bool {
+		data, err := json.Marshal(record)
+		if err != nil {
+			log.Printf("Failed to marshal stream record: %v", err)
+			return false
+		}
+
+		if sse {
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", record.Type, data)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\n", data)
+		}
+		if err != nil {
+			return false
+		}
+
+		flusher.Flush()
+		return true
+	}
+
+	if err != nil {
+		writeRecord(types.SearchContentStreamRecord{
+			Type:    types.StreamRecordError,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	start := time.Now()
+	summary := searcher.SearchContentStream(r.Context(), workspaces, request, func(result types.SearchContentResult) bool {
+		return writeRecord(types.SearchContentStreamRecord{
+			Type:   types.StreamRecordResult,
+			Result: &result,
 		})
+	})
+
+	req, _ := json.Marshal(request)
+	log.Printf("Process %s `%s`: took %s, found %d results in %d files, truncate: %t, cancelled: %t",
+		r.URL.Path, string(req), time.Since(start), summary.TotalHits, summary.TotalFiles, summary.Truncate, r.Context().Err() != nil)
+
+	if r.Context().Err() != nil {
 		return
 	}
 
+	writeRecord(types.SearchContentStreamRecord{
+		Type:    types.StreamRecordSummary,
+		Summary: summary,
+	})
+}
+
+// validateSearchContentRequest validates the search content request
+// and returns the workspaces to search in
+func validateSearchContentRequest(request *types.SearchContentRequest) ([]*workspace.Workspace, error) {
+	workspaces, err := resolveWorkspaces(request.Workspace, request.Workspaces)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the query is empty, return an error
+	if request.Query == "" {
+		return nil, fmt.Errorf("Query is required")
+	}
+
+	if err := searcher.ValidateFilters(workspaces, request.Filters); err != nil {
+		return nil, err
+	}
+
+	if err := searcher.ValidateMode(request.Mode); err != nil {
+		return nil, err
+	}
+
+	if err := searcher.ValidateQuery(request); err != nil {
+		return nil, fmt.Errorf("Invalid query: %w", err)
+	}
+
+	return workspaces, nil
+}
+
+// resolveWorkspaces returns the workspaces of a request
+// patterns are workspace paths, globs of paths or "all", the single workspace is used if there is no pattern
+func resolveWorkspaces(single string, patterns []string) ([]*workspace.Workspace, error) {
+	if len(patterns) > 0 {
+		return workspace.Match(patterns)
+	}
+
+	if single == "" {
+		return nil, fmt.Errorf("Workspace is required")
+	}
+
 	// Normalize the workspace path
 	// If the path is not absolute, return an error
-	workspacePath := utils.NormalizePath(request.Workspace)
+	workspacePath := utils.NormalizePath(single)
 	if !filepath.IsAbs(workspacePath) {
-		json.NewEncoder(w).Encode(types.SearchFilesResponse{
-			Code:    1,
-			Message: "Workspace is not absolute",
-		})
-		return
+		return nil, fmt.Errorf("Workspace is not absolute")
 	}
 
 	// Get the workspace by path
 	// If the workspace is not found, return an error
-	workspace, err := workspace.GetByPath(workspacePath)
+	ws, err := workspace.GetByPath(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*workspace.Workspace{ws}, nil
+}
+
+// handleSearchFiles handles the search files endpoint
+// It will search the files of the server
+func handleSearchFiles(w http.ResponseWriter, r *http.Request) {
+	var request types.SearchFilesRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	workspaces, err := resolveWorkspaces(request.Workspace, request.Workspaces)
 	if err != nil {
 		json.NewEncoder(w).Encode(types.SearchFilesResponse{
 			Code:    1,
@@ -143,9 +230,17 @@ func handleSearchFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := searcher.ValidateFilters(workspaces, request.Filters); err != nil {
+		json.NewEncoder(w).Encode(types.SearchFilesResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	start := time.Now()
 	// Search the content of the workspace
-	result, err := searcher.SearchFiles(workspace, &request)
+	result, err := searcher.SearchFiles(r.Context(), workspaces, &request)
 	defer func() {
 		req, _ := json.Marshal(request)
 		log.Printf("Process /api/v1/search/files `%s`: took %s, found %d results, err: %s",
@@ -158,3 +253,46 @@ func handleSearchFiles(w http.ResponseWriter, r *http.Request) {
 		Data:    result,
 	})
 }
+
+// handleSearchSuggest handles the search suggest endpoint
+// It returns the indexed keywords starting with the prefix, ranked by the number of documents
+func handleSearchSuggest(w http.ResponseWriter, r *http.Request) {
+	var request types.SearchSuggestRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	workspaces, err := resolveWorkspaces(request.Workspace, request.Workspaces)
+	if err != nil {
+		json.NewEncoder(w).Encode(types.SearchSuggestResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// If the prefix is empty, return an error
+	if strings.TrimSpace(request.Prefix) == "" {
+		json.NewEncoder(w).Encode(types.SearchSuggestResponse{
+			Code:    1,
+			Message: "Prefix is required",
+		})
+		return
+	}
+
+	start := time.Now()
+	result := searcher.SuggestKeywords(workspaces, &request)
+	log.Printf("Process /api/v1/search/suggest `%s`: took %s, found %d suggestions",
+		request.Prefix, time.Since(start), len(result.Suggestions))
+
+	json.NewEncoder(w).Encode(types.SearchSuggestResponse{
+		Code:    0,
+		Message: "Ok",
+		Data:    result,
+	})
+}
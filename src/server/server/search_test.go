@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/core/fulltext"
+	"github.com/codetrek/haystack/server/core/workspace"
+	"github.com/codetrek/haystack/server/indexer"
+	"github.com/codetrek/haystack/shared/types"
+)
+
+// newIndexedWorkspace creates a workspace of the files, and indexes them
+func newIndexedWorkspace(t *testing.T, files map[string]string) *workspace.Workspace {
+	tempDir := t.TempDir()
+	conf.Get().Global.DataPath = filepath.Join(tempDir, "data")
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := workspace.Init(); err != nil {
+		t.Fatalf("Workspace Init failed: %v", err)
+	}
+
+	wsPath := filepath.Join(tempDir, "ws")
+	if err := os.MkdirAll(wsPath, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	ws, err := workspace.Create(wsPath)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	docs := []*fulltext.Document{}
+	for relPath, content := range files {
+		fullPath := filepath.Join(wsPath, relPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		stat, _ := os.Stat(fullPath)
+		docs = append(docs, &fulltext.Document{
+			ID:           indexer.GetDocumentId(fullPath),
+			RelPath:      relPath,
+			ModifiedTime: stat.ModTime().UnixNano(),
+			Words:        indexer.ParseKeywords(content),
+		})
+	}
+	if err := fulltext.SaveNewDocuments(ws.ID, docs); err != nil {
+		t.Fatalf("SaveNewDocuments failed: %v", err)
+	}
+
+	// The keywords are written once the storage is closed
+	fulltext.CloseAndWait()
+	if err := fulltext.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		workspace.Delete(ws.ID)
+		fulltext.CloseAndWait()
+	})
+	return ws
+}
+
+// streamRecords posts the request to the stream handler and returns the records of the stream
+func streamRecords(t *testing.T, handler http.Handler, url string, accept string,
+	request types.SearchContentRequest) (*httptest.ResponseRecorder, []types.SearchContentStreamRecord) {
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(jsonOf(t, request)))
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	handler.ServeHTTP(recorder, r)
+
+	records := []types.SearchContentStreamRecord{}
+	scanner := bufio.NewScanner(recorder.Body)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+			continue
+		}
+		line = strings.TrimPrefix(line, "data: ")
+		if line == "" {
+			continue
+		}
+
+		var record types.SearchContentStreamRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid record %q: %v", line, err)
+		}
+		if event != "" && event != record.Type {
+			t.Errorf("SSE event %q of a %q record", event, record.Type)
+		}
+		records = append(records, record)
+	}
+	return recorder, records
+}
+
+func TestSearchContentStream(t *testing.T) {
+	ws := newIndexedWorkspace(t, map[string]string{
+		"a.go": "func handleRequest() {}\n",
+		"b.go": "// handleRequest is called twice\nhandleRequest()\n",
+		"c.go": "func other() {}\n",
+	})
+
+	request := types.SearchContentRequest{Workspace: ws.Path, Query: "handleRequest"}
+	invalid := types.SearchContentRequest{Workspace: ws.Path, Query: "handleRequest NEAR/3"}
+
+	for _, format := range []struct {
+		name        string
+		url         string
+		accept      string
+		contentType string
+	}{
+		{"ndjson", "/api/v1/search/content/stream", "", "application/x-ndjson"},
+		{"sse", "/api/v1/search/content/stream", "text/event-stream", "text/event-stream"},
+		{"sse query", "/api/v1/search/content/stream?format=sse", "", "text/event-stream"},
+	} {
+		recorder, records := streamRecords(t, http.HandlerFunc(handleSearchContentStream), format.url,
+			format.accept, request)
+		if got := recorder.Header().Get("Content-Type"); got != format.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", format.name, got, format.contentType)
+		}
+
+		// One record per matched file, followed by the summary
+		if len(records) != 3 {
+			t.Fatalf("%s: got %d records, want 3: %+v", format.name, len(records), records)
+		}
+		files := map[string]int{}
+		for _, record := range records[:2] {
+			if record.Type != types.StreamRecordResult || record.Result == nil {
+				t.Fatalf("%s: got record %+v, want a result", format.name, record)
+			}
+			files[record.Result.File] = len(record.Result.Lines)
+		}
+		if files["a.go"] != 1 || files["b.go"] != 2 {
+			t.Errorf("%s: got matched lines %v", format.name, files)
+		}
+		summary := records[2]
+		if summary.Type != types.StreamRecordSummary || summary.Summary == nil ||
+			summary.Summary.TotalHits != 3 || summary.Summary.TotalFiles != 2 {
+			t.Errorf("%s: got summary %+v", format.name, summary)
+		}
+
+		// An invalid query is reported by an error record, rather than an empty stream
+		_, records = streamRecords(t, http.HandlerFunc(handleSearchContentStream), format.url, format.accept, invalid)
+		if len(records) != 1 || records[0].Type != types.StreamRecordError ||
+			!strings.Contains(records[0].Message, "NEAR/3") {
+			t.Errorf("%s: got records %+v, want an error of the query", format.name, records)
+		}
+	}
+
+	// The stream of the v2 API responds an invalid query before the stream starts
+	apiV2 = newAPIRouter(apiV2Routes())
+	defer func() { apiV2 = nil }()
+	handler := apiMiddleware(apiV2)
+
+	_, records := streamRecords(t, handler, "/api/v2/search/content/stream", "", request)
+	if len(records) != 3 || records[2].Type != types.StreamRecordSummary {
+		t.Errorf("v2: got records %+v, want 2 results and the summary", records)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v2/search/content/stream",
+		strings.NewReader(jsonOf(t, invalid))))
+	var response types.APIErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusBadRequest ||
+		response.Error.Code != types.ErrorCodeInvalidRequest {
+		t.Errorf("v2: got status %d and body %s, want an invalid request", recorder.Code, recorder.Body)
+	}
+}
@@ -2,8 +2,11 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,14 +14,16 @@ import (
 	"github.com/codetrek/haystack/shared/running"
 )
 
-// StartServer initializes and starts the HTTP server
-func StartServer(wg *sync.WaitGroup, addr string) {
+// StartServer initializes and starts the HTTP server on the TCP address and the unix socket
+// Either of them could be empty to not listen on it.
+func StartServer(wg *sync.WaitGroup, addr string, socketFile string) {
 	wg.Add(1)
 	defer wg.Done()
 
 	var shuttingDown atomic.Bool
 	server := &http.Server{
-		Addr: addr,
+		Addr:    addr,
+		Handler: requireToken(http.DefaultServeMux),
 	}
 
 	http.HandleFunc("/", http.NotFound)
@@ -26,9 +31,13 @@ func StartServer(wg *sync.WaitGroup, addr string) {
 	http.HandleFunc("/api/v1/server/restart", handleRestart)
 	http.HandleFunc("/api/v1/server/stop", handleStop)
 	http.HandleFunc("/api/v1/server/status", handleStatus)
+	http.HandleFunc("/api/v1/server/reload", handleReloadConfig)
 
 	http.HandleFunc("/api/v1/document/update", handleUpdateDocument)
 	http.HandleFunc("/api/v1/document/delete", handleDeleteDocument)
+	http.HandleFunc("/api/v1/document/overlay/set", handleSetOverlay)
+	http.HandleFunc("/api/v1/document/overlay/clear", handleClearOverlay)
+	http.HandleFunc("/api/v1/document/overlay/list", handleListOverlay)
 
 	http.HandleFunc("/api/v1/workspace/create", handleCreateWorkspace)
 	http.HandleFunc("/api/v1/workspace/delete", handleDeleteWorkspace)
@@ -39,17 +48,45 @@ func StartServer(wg *sync.WaitGroup, addr string) {
 	http.HandleFunc("/api/v1/workspace/update", handleUpdateWorkspace)
 
 	http.HandleFunc("/api/v1/search/content", handleSearchContent)
+	http.HandleFunc("/api/v1/search/content/stream", handleSearchContentStream)
 	http.HandleFunc("/api/v1/search/files", handleSearchFiles)
+	http.HandleFunc("/api/v1/search/suggest", handleSearchSuggest)
+
+	http.HandleFunc("/api/v1/replace/preview", handleReplacePreview)
+	http.HandleFunc("/api/v1/replace/apply", handleReplaceApply)
+
+	apiV2 = newAPIRouter(apiV2Routes())
+	http.Handle(apiV2Prefix, apiMiddleware(apiV2))
 
 	mcpInit()
 
-	// Start server in a goroutine
-	go func() {
-		log.Printf("HTTP server starting on %s", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("ListenAndServe: ", err)
+	// The socket is listened on a temporary name, so the listeners are named by their configured addresses
+	listeners := map[string]net.Listener{}
+	if addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatal("Listen: ", err)
+		}
+		listeners[addr] = listener
+	}
+	if socketFile != "" {
+		listener, err := listenUnixSocket(socketFile)
+		if err != nil {
+			log.Fatal("Listen: ", err)
 		}
-	}()
+		defer os.Remove(socketFile)
+		listeners[socketFile] = listener
+	}
+
+	// Start server in goroutines
+	for name, listener := range listeners {
+		go func() {
+			log.Printf("HTTP server starting on %s", name)
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				log.Fatal("Serve: ", err)
+			}
+		}()
+	}
 
 	// Wait for shutdown signal
 	<-running.GetShutdown().Done()
@@ -67,3 +104,30 @@ func StartServer(wg *sync.WaitGroup, addr string) {
 
 	log.Println("HTTP server stopped")
 }
+
+// listenUnixSocket listens on the unix socket which only the user could connect to
+// The socket is created by a temporary name and renamed once its permissions are restricted, so it's never
+// accessible by others. A socket left by a server which has stopped is replaced.
+func listenUnixSocket(socketFile string) (net.Listener, error) {
+	tempFile := fmt.Sprintf("%s.%d", socketFile, os.Getpid())
+	os.Remove(tempFile)
+
+	listener, err := net.Listen("unix", tempFile)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tempFile, 0600); err != nil {
+		listener.Close()
+		os.Remove(tempFile)
+		return nil, err
+	}
+	if err := os.Rename(tempFile, socketFile); err != nil {
+		listener.Close()
+		os.Remove(tempFile)
+		return nil, err
+	}
+
+	return listener, nil
+}
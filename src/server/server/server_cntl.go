@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/codetrek/haystack/conf"
+	"github.com/codetrek/haystack/server/searcher"
 	"github.com/codetrek/haystack/shared/running"
 	"github.com/codetrek/haystack/shared/types"
 )
@@ -92,6 +93,7 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 		Data    types.ServerStatus `json:"data"`
 	}
 
+	cacheStats := searcher.CacheStats()
 	response := StatusResponse{
 		Code:    0,
 		Message: "Ok",
@@ -101,8 +103,52 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 			PID:          os.Getpid(),
 			Version:      running.Version(),
 			DataPath:     conf.Get().Global.DataPath,
+			SearchCache:  &cacheStats,
 		},
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
+
+// ReloadConfig reloads the configuration file and logs what's changed, source is what requested the reload
+func ReloadConfig(source string) (*types.ConfigReloadResult, error) {
+	result, err := conf.Reload()
+	if err != nil {
+		log.Printf("Reload config by %s failed, keeping the current config: %v", source, err)
+		return nil, err
+	}
+
+	log.Printf("Reloaded config `%s` by %s, changed: %v", result.File, source, result.Changed)
+	if len(result.RestartRequired) > 0 {
+		log.Printf("Config %v changed, they're applied once the server restarts", result.RestartRequired)
+	}
+	return result, nil
+}
+
+// handleReloadConfig handles the reload endpoint
+// It will reload the configuration file, the current one is kept if the file is invalid
+func handleReloadConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	type ReloadResponse struct {
+		Code    int                       `json:"code"`
+		Message string                    `json:"message"`
+		Data    *types.ConfigReloadResult `json:"data,omitempty"`
+	}
+
+	result, err := ReloadConfig("API")
+	if err != nil {
+		json.NewEncoder(w).Encode(ReloadResponse{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(ReloadResponse{
+		Code:    0,
+		Message: "Ok",
+		Data:    result,
+	})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codetrek/haystack/conf"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	socketFile := filepath.Join(t.TempDir(), "server.sock")
+
+	// A socket left by a server which has stopped is replaced
+	stale, err := net.Listen("unix", socketFile)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	if _, err := net.Dial("unix", socketFile); err == nil {
+		t.Fatalf("the stale socket is still listened")
+	}
+
+	listener, err := listenUnixSocket(socketFile)
+	if err != nil {
+		t.Fatalf("listenUnixSocket() error = %v", err)
+	}
+	defer listener.Close()
+
+	// Only the user could connect to the socket
+	info, err := os.Stat(socketFile)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want a socket of 0600", info.Mode())
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", socketFile, os.Getpid())); !os.IsNotExist(err) {
+		t.Errorf("the temporary socket is left, error = %v", err)
+	}
+
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", socketFile)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Close()
+}
+
+func TestNewSSEServer(t *testing.T) {
+	saved := conf.Get().Global
+	defer func() { conf.Get().Global = saved }()
+	mcpServer := newMCPServer()
+
+	// Clients connected by the socket resolve the message path against the SSE URL
+	conf.Get().Global.Port = 13134
+	for _, tt := range []struct {
+		disableTCP bool
+		want       string
+	}{
+		{false, "http://localhost:13134/mcp/message?sessionId=1"},
+		{true, "/mcp/message?sessionId=1"},
+	} {
+		conf.Get().Global.DisableTCP = tt.disableTCP
+		sse := newSSEServer(mcpServer)
+		if got := sse.GetMessageEndpointForClient("1"); got != tt.want {
+			t.Errorf("disable_tcp %t: message endpoint = %q, want %q", tt.disableTCP, got, tt.want)
+		}
+		if got := sse.CompleteMessagePath(); got != "/mcp/message" {
+			t.Errorf("disable_tcp %t: message path = %q, want /mcp/message", tt.disableTCP, got)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scope is what the requests with a token are allowed to do
+type Scope string
+
+const (
+	// ScopeSearch only allows to search and read the indexes
+	ScopeSearch Scope = "search"
+	// ScopeAdmin allows everything, including changing workspaces and stopping the server
+	ScopeAdmin Scope = "admin"
+)
+
+// DefaultTokenName is the name of the token generated on first start, which is used by the CLI
+const DefaultTokenName = "default"
+
+// tokenPrefix makes the tokens recognizable, e.g. by secret scanners
+const tokenPrefix = "hs_"
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenExists   = errors.New("token already exists")
+
+	validName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+)
+
+type Token struct {
+	Name      string    `json:"name"`
+	Token     string    `json:"token"`
+	Scope     Scope     `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type tokenStore struct {
+	Tokens []*Token `json:"tokens"`
+}
+
+var (
+	tokenFile string
+
+	// The tokens read by Authenticate, they're read again once the file is changed by the token commands
+	mutex   sync.Mutex
+	cached  *tokenStore
+	modTime time.Time
+)
+
+// RegisterTokenFile registers the file storing the tokens, only the current user could read it
+func RegisterTokenFile(file string) {
+	if len(tokenFile) > 0 {
+		return
+	}
+	tokenFile = file
+}
+
+func TokenFile() string {
+	return tokenFile
+}
+
+// ParseScope parses the scope of a token, the empty one is the search scope
+func ParseScope(scope string) (Scope, error) {
+	switch Scope(scope) {
+	case "", ScopeSearch:
+		return ScopeSearch, nil
+	case ScopeAdmin:
+		return ScopeAdmin, nil
+	default:
+		return "", fmt.Errorf("unknown scope: %s, available scopes: %s, %s", scope, ScopeSearch, ScopeAdmin)
+	}
+}
+
+// Allows returns true if the scope includes the required one
+func (s Scope) Allows(required Scope) bool {
+	return s == ScopeAdmin || s == required
+}
+
+// EnsureDefaultToken generates the default token with the admin scope if it doesn't exist
+func EnsureDefaultToken() error {
+	return update(func(store *tokenStore) error {
+		if store.find(DefaultTokenName) != nil {
+			return nil
+		}
+
+		token, err := newToken(DefaultTokenName, ScopeAdmin)
+		if err != nil {
+			return err
+		}
+		store.Tokens = append(store.Tokens, token)
+		return nil
+	})
+}
+
+// DefaultToken returns the default token, it's empty if the server has never started
+func DefaultToken() string {
+	store, err := load()
+	if err != nil {
+		return ""
+	}
+
+	if token := store.find(DefaultTokenName); token != nil {
+		return token.Token
+	}
+	return ""
+}
+
+// List returns the tokens sorted by their names
+func List() ([]*Token, error) {
+	store, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(store.Tokens, func(i, j int) bool {
+		return store.Tokens[i].Name < store.Tokens[j].Name
+	})
+	return store.Tokens, nil
+}
+
+// Add generates a new token with the name and scope
+func Add(name string, scope Scope) (*Token, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid token name: %s, only letters, digits, '_', '.' and '-' are allowed", name)
+	}
+
+	var token *Token
+	err := update(func(store *tokenStore) error {
+		if store.find(name) != nil {
+			return ErrTokenExists
+		}
+
+		var err error
+		token, err = newToken(name, scope)
+		if err != nil {
+			return err
+		}
+		store.Tokens = append(store.Tokens, token)
+		return nil
+	})
+	return token, err
+}
+
+// Rotate replaces the token of the name with a new one, the old one is rejected at once
+func Rotate(name string) (*Token, error) {
+	var token *Token
+	err := update(func(store *tokenStore) error {
+		if token = store.find(name); token == nil {
+			return ErrTokenNotFound
+		}
+
+		rotated, err := newToken(name, token.Scope)
+		if err != nil {
+			return err
+		}
+		*token = *rotated
+		return nil
+	})
+	return token, err
+}
+
+// Remove removes the token of the name, the default token can't be removed as the CLI uses it
+func Remove(name string) error {
+	if name == DefaultTokenName {
+		return fmt.Errorf("the %s token can't be removed, rotate it instead", DefaultTokenName)
+	}
+
+	return update(func(store *tokenStore) error {
+		for i, token := range store.Tokens {
+			if token.Name == name {
+				store.Tokens = append(store.Tokens[:i], store.Tokens[i+1:]...)
+				return nil
+			}
+		}
+		return ErrTokenNotFound
+	})
+}
+
+// Authenticate returns the token matching the value, or nil if none matches
+// The tokens are cached and read again when the file is modified.
+func Authenticate(value string) *Token {
+	if value == "" {
+		return nil
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// The cached tokens are kept if the file can't be read, e.g. while it's being replaced
+	if info, err := os.Stat(tokenFile); err == nil && (cached == nil || !info.ModTime().Equal(modTime)) {
+		if store, err := load(); err == nil {
+			cached, modTime = store, info.ModTime()
+		}
+	}
+	if cached == nil {
+		return nil
+	}
+
+	var matched *Token
+	for _, token := range cached.Tokens {
+		// Every token is compared so the time doesn't tell which one matches
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(value)) == 1 {
+			matched = token
+		}
+	}
+	return matched
+}
+
+func (s *tokenStore) find(name string) *Token {
+	for _, token := range s.Tokens {
+		if token.Name == name {
+			return token
+		}
+	}
+	return nil
+}
+
+func newToken(name string, scope Scope) (*Token, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	return &Token{
+		Name:      name,
+		Token:     tokenPrefix + hex.EncodeToString(data),
+		Scope:     scope,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// load reads the tokens, the store is empty if the file doesn't exist
+func load() (*tokenStore, error) {
+	if len(tokenFile) == 0 {
+		return nil, fmt.Errorf("token file not registered")
+	}
+
+	store := &tokenStore{}
+	data, err := os.ReadFile(tokenFile)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %v", err)
+	}
+
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens: %v", err)
+	}
+	return store, nil
+}
+
+// update changes the tokens by fn and writes them back
+// The file is written to a temporary one readable only by the user and renamed, so it's never read partially.
+func update(fn func(store *tokenStore) error) error {
+	store, err := load()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(store); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(tokenFile), 0700); err != nil {
+		return fmt.Errorf("failed to create token directory: %v", err)
+	}
+
+	tempFile := fmt.Sprintf("%s.%d", tokenFile, os.Getpid())
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write tokens: %v", err)
+	}
+	// The permissions of an existing temporary file are not changed by WriteFile
+	if err := os.Chmod(tempFile, 0600); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write tokens: %v", err)
+	}
+	if err := os.Rename(tempFile, tokenFile); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write tokens: %v", err)
+	}
+	return nil
+}
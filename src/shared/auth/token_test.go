@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "haystack-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	RegisterTokenFile(filepath.Join(tempDir, "data", "tokens.json"))
+
+	if DefaultToken() != "" || Authenticate("") != nil {
+		t.Fatal("Got a token before the default one is generated")
+	}
+
+	if err := EnsureDefaultToken(); err != nil {
+		t.Fatalf("EnsureDefaultToken() error = %v", err)
+	}
+	defaultToken := DefaultToken()
+	if err := EnsureDefaultToken(); err != nil || DefaultToken() != defaultToken {
+		t.Fatalf("EnsureDefaultToken() replaced the existing token, error = %v", err)
+	}
+
+	info, err := os.Stat(TokenFile())
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Token file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	if token := Authenticate(defaultToken); token == nil || token.Name != DefaultTokenName || token.Scope != ScopeAdmin {
+		t.Errorf("Authenticate(default) = %+v", token)
+	}
+
+	search, err := Add("editor", ScopeSearch)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := Add("editor", ScopeAdmin); err != ErrTokenExists {
+		t.Errorf("Add() of an existing name error = %v, want %v", err, ErrTokenExists)
+	}
+	if _, err := Add("../editor", ScopeAdmin); err == nil {
+		t.Error("Add() of an invalid name got no error")
+	}
+
+	// Changes of the file are seen by Authenticate
+	token := Authenticate(search.Token)
+	if token == nil || token.Scope != ScopeSearch {
+		t.Fatalf("Authenticate(editor) = %+v", token)
+	}
+	if token.Scope.Allows(ScopeAdmin) || !token.Scope.Allows(ScopeSearch) || !ScopeAdmin.Allows(ScopeSearch) {
+		t.Error("Scope.Allows() got wrong result")
+	}
+
+	rotated, err := Rotate("editor")
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if Authenticate(search.Token) != nil || Authenticate(rotated.Token) == nil {
+		t.Error("Authenticate() accepts the rotated token or rejects the new one")
+	}
+
+	if err := Remove(DefaultTokenName); err == nil {
+		t.Error("Remove() of the default token got no error")
+	}
+	if err := Remove("editor"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := Remove("editor"); err != ErrTokenNotFound {
+		t.Errorf("Remove() of a removed token error = %v, want %v", err, ErrTokenNotFound)
+	}
+	if Authenticate(rotated.Token) != nil || Authenticate("hs_invalid") != nil {
+		t.Error("Authenticate() accepts a removed or invalid token")
+	}
+
+	tokens, err := List()
+	if err != nil || len(tokens) != 1 || tokens[0].Name != DefaultTokenName {
+		t.Errorf("List() = %v, error = %v", tokens, err)
+	}
+}
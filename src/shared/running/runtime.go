@@ -73,6 +73,16 @@ func ExecutablePath() string {
 }
 
 func StartNewServer() {
+	startServerProcess(os.Stdout, os.Stderr)
+}
+
+// StartDetachedServer starts the server without its stdout and stderr
+// It's used by clients whose own stdout is a protocol stream, e.g. the MCP stdio transport
+func StartDetachedServer() {
+	startServerProcess(nil, nil)
+}
+
+func startServerProcess(stdout, stderr *os.File) {
 	executable, err := os.Executable()
 	if err != nil {
 		log.Printf("Failed to get executable path: %v", err)
@@ -88,7 +98,7 @@ func StartNewServer() {
 	args := os.Args[1:]
 	procAttr := &os.ProcAttr{
 		Dir:   wd,
-		Files: []*os.File{nil, os.Stdout, os.Stderr},
+		Files: []*os.File{nil, stdout, stderr},
 		Env:   os.Environ(),
 	}
 
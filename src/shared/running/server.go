@@ -1,16 +1,20 @@
 package running
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gofrs/flock"
 )
 
 var (
 	lockFile   string
+	socketFile string
 	ErrRunning = errors.New("server is running")
 )
 
@@ -21,6 +25,35 @@ func RegisterLockFile(file string) {
 	lockFile = file
 }
 
+// RegisterSocketFile registers the path of the unix socket the server listens on if it's enabled
+func RegisterSocketFile(file string) {
+	if len(socketFile) > 0 {
+		return
+	}
+	socketFile = file
+}
+
+func SocketFile() string {
+	return socketFile
+}
+
+// DialServer connects to the server by the unix socket if it exists, or by TCP at tcpAddr
+// The socket is skipped if it's left by a server which has stopped, tcpAddr is empty if TCP is disabled.
+func DialServer(ctx context.Context, tcpAddr string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if _, err := os.Stat(socketFile); socketFile != "" && err == nil {
+		conn, err := dialer.DialContext(ctx, "unix", socketFile)
+		if err == nil || tcpAddr == "" {
+			return conn, err
+		}
+	}
+
+	if tcpAddr == "" {
+		return nil, fmt.Errorf("server socket %s is not found", socketFile)
+	}
+	return dialer.DialContext(ctx, "tcp", tcpAddr)
+}
+
 func CheckAndLockServer() (func(), error) {
 	if len(lockFile) == 0 {
 		return nil, fmt.Errorf("lock file not registered")
@@ -54,6 +87,14 @@ func CheckAndLockServer() (func(), error) {
 }
 
 func IsServerRunning() bool {
+	// A server is listening on the socket, it's only checked if the socket exists
+	if _, err := os.Stat(socketFile); socketFile != "" && err == nil {
+		if conn, err := net.DialTimeout("unix", socketFile, time.Second); err == nil {
+			conn.Close()
+			return true
+		}
+	}
+
 	cancel, err := CheckAndLockServer()
 	if err != nil {
 		return err == ErrRunning
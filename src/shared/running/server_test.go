@@ -0,0 +1,117 @@
+package running
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useFiles registers the socket and the lock files of the test, they are restored on cleanup
+func useFiles(t *testing.T, socket string, lock string) {
+	savedSocket, savedLock := socketFile, lockFile
+	socketFile, lockFile = socket, lock
+	t.Cleanup(func() { socketFile, lockFile = savedSocket, savedLock })
+}
+
+// listen listens on the network, the connections are accepted and closed until the test ends
+func listen(t *testing.T, network, addr string) net.Listener {
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return listener
+}
+
+// staleSocket creates a socket file which is not listened, as a server which has stopped leaves
+func staleSocket(t *testing.T, socket string) {
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+}
+
+func TestDialServer(t *testing.T) {
+	tempDir := t.TempDir()
+	socket := filepath.Join(tempDir, "server.sock")
+	useFiles(t, socket, filepath.Join(tempDir, "server.lock"))
+	tcpAddr := listen(t, "tcp", "127.0.0.1:0").Addr().String()
+
+	dial := func(tcpAddr string) (string, error) {
+		conn, err := DialServer(context.Background(), tcpAddr)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.RemoteAddr().Network(), nil
+	}
+
+	// Without the socket, the server is connected by TCP unless it's disabled
+	if network, err := dial(tcpAddr); err != nil || network != "tcp" {
+		t.Errorf("DialServer() without socket = %q, %v, want tcp", network, err)
+	}
+	if _, err := dial(""); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("DialServer() without socket and TCP error = %v, want not found", err)
+	}
+
+	// A dead socket falls back to TCP, it fails if TCP is disabled
+	staleSocket(t, socket)
+	if network, err := dial(tcpAddr); err != nil || network != "tcp" {
+		t.Errorf("DialServer() of a dead socket = %q, %v, want tcp", network, err)
+	}
+	if _, err := dial(""); err == nil {
+		t.Errorf("DialServer() of a dead socket without TCP expected an error")
+	}
+
+	// The listened socket is preferred
+	os.Remove(socket)
+	listen(t, "unix", socket)
+	for _, addr := range []string{tcpAddr, ""} {
+		if network, err := dial(addr); err != nil || network != "unix" {
+			t.Errorf("DialServer(%q) = %q, %v, want unix", addr, network, err)
+		}
+	}
+}
+
+func TestIsServerRunning(t *testing.T) {
+	tempDir := t.TempDir()
+	socket := filepath.Join(tempDir, "server.sock")
+	useFiles(t, socket, filepath.Join(tempDir, "server.lock"))
+
+	// A dead socket is not a running server
+	staleSocket(t, socket)
+	if IsServerRunning() {
+		t.Errorf("IsServerRunning() = true with a dead socket")
+	}
+
+	// The server is running if the lock is held, e.g. it only listens on TCP
+	unlock, err := CheckAndLockServer()
+	if err != nil {
+		t.Fatalf("CheckAndLockServer() error = %v", err)
+	}
+	if !IsServerRunning() {
+		t.Errorf("IsServerRunning() = false while the lock is held")
+	}
+	unlock()
+
+	os.Remove(socket)
+	listen(t, "unix", socket)
+	if !IsServerRunning() {
+		t.Errorf("IsServerRunning() = false while the socket is listened")
+	}
+}
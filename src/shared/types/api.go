@@ -0,0 +1,38 @@
+package types
+
+// The stable codes of the errors of /api/v2, clients should check the code instead of the message
+const (
+	ErrorCodeInvalidRequest    = "invalid_request"
+	ErrorCodeInvalidPath       = "invalid_path"
+	ErrorCodeUnauthorized      = "unauthorized"
+	ErrorCodeForbidden         = "forbidden"
+	ErrorCodeNotFound          = "not_found"
+	ErrorCodeWorkspaceNotFound = "workspace_not_found"
+	ErrorCodeMethodNotAllowed  = "method_not_allowed"
+	ErrorCodeWorkspaceExists   = "workspace_exists"
+	ErrorCodeRequestTooLarge   = "request_too_large"
+	ErrorCodeInvalidConfig     = "invalid_config"
+	ErrorCodeInternal          = "internal_error"
+)
+
+// APIError is the error of a request of /api/v2, it's responded with the HTTP status of the code
+// @param RequestID: is the ID of the request, which is also in the X-Request-Id header and the server log
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIResponse is the response of a successful request of /api/v2, Data is the result of the endpoint
+type APIResponse struct {
+	Data any `json:"data"`
+}
+
+// APIMessage is the result of the endpoints of /api/v2 which start an operation in the background
+type APIMessage struct {
+	Message string `json:"message"`
+}
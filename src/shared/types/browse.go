@@ -0,0 +1,35 @@
+package types
+
+// ReadFileResult is a range of lines of a file of a workspace
+// @param StartLine: is the line number of the first line, starting from 1
+// @param TotalLines: is the number of lines of the file
+// @param Truncate: is set if the range is cut by the size limit before EndLine
+// @param Overlay: is set if the content is an unsaved buffer
+type ReadFileResult struct {
+	Workspace  string   `json:"workspace"`
+	File       string   `json:"file"`
+	StartLine  int      `json:"start_line"`
+	EndLine    int      `json:"end_line"`
+	TotalLines int      `json:"total_lines"`
+	Lines      []string `json:"lines"`
+	Truncate   bool     `json:"truncate,omitempty"`
+	Overlay    bool     `json:"overlay,omitempty"`
+}
+
+// DirEntry is a child of a directory
+// @param Files: is the number of indexed files in a child directory, including all its descendants
+type DirEntry struct {
+	Name  string `json:"name"`
+	Dir   bool   `json:"dir,omitempty"`
+	Files int    `json:"files,omitempty"`
+}
+
+// ListDirResult is the indexed children of a directory of a workspace, directories first
+// @param TotalFiles: is the number of indexed files in the directory, including all its descendants
+type ListDirResult struct {
+	Workspace  string     `json:"workspace"`
+	Path       string     `json:"path"`
+	Entries    []DirEntry `json:"entries"`
+	TotalFiles int        `json:"total_files"`
+	Truncate   bool       `json:"truncate,omitempty"`
+}
@@ -9,11 +9,32 @@ type CommonResponse struct {
 }
 
 type ServerStatus struct {
-	ShuttingDown bool   `json:"shutting_down"`
-	Restarting   bool   `json:"restarting"`
-	PID          int    `json:"pid"`
-	Version      string `json:"version"`
-	DataPath     string `json:"data_path"`
+	ShuttingDown bool              `json:"shutting_down"`
+	Restarting   bool              `json:"restarting"`
+	PID          int               `json:"pid"`
+	Version      string            `json:"version"`
+	DataPath     string            `json:"data_path"`
+	SearchCache  *SearchCacheStats `json:"search_cache,omitempty"`
+}
+
+// SearchCacheStats is the statistics of the search result cache, sizes are in bytes
+type SearchCacheStats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Entries       int   `json:"entries"`
+	Bytes         int64 `json:"bytes"`
+	MaxBytes      int64 `json:"max_bytes"`
+	Evictions     int64 `json:"evictions"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+// ConfigReloadResult is the result of reloading the configuration file
+// Changed are the keys of the changed settings, e.g. "server.search.timeout_ms", the ones in RestartRequired
+// are only applied once the server restarts.
+type ConfigReloadResult struct {
+	File            string   `json:"file"`
+	Changed         []string `json:"changed"`
+	RestartRequired []string `json:"restart_required,omitempty"`
 }
 
 type HealthInfo struct {
@@ -9,3 +9,43 @@ type DocumentDeleteRequest struct {
 	Workspace string `json:"workspace"`
 	Path      string `json:"path"` // relative path to the workspace
 }
+
+// OverlaySetRequest registers the content of an unsaved editor buffer, which is searched instead of the file on disk
+// @param Path: is the relative path to the workspace, the file doesn't need to exist on disk
+// @param TtlMs: is how long the overlay lives if it's not set again, server's default is used if it's not set
+type OverlaySetRequest struct {
+	Workspace string `json:"workspace"`
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	TtlMs     int    `json:"ttl_ms,omitempty"`
+}
+
+// OverlayClearRequest removes the overlays of the paths, all overlays of the workspace if no path is given
+type OverlayClearRequest struct {
+	Workspace string   `json:"workspace"`
+	Paths     []string `json:"paths,omitempty"`
+}
+
+type OverlayListRequest struct {
+	Workspace string `json:"workspace"`
+}
+
+// Overlay is an active overlay of a workspace
+// @param ExpiresAt: is the unix time in milliseconds the overlay expires at
+type Overlay struct {
+	Path      string `json:"path"`
+	Hash      string `json:"hash"`
+	Size      int    `json:"size"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type OverlayResult struct {
+	Workspace string    `json:"workspace"`
+	Overlays  []Overlay `json:"overlays"`
+}
+
+type OverlayResponse struct {
+	Code    int            `json:"code"`
+	Message string         `json:"message"`
+	Data    *OverlayResult `json:"data,omitempty"`
+}
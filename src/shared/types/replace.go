@@ -0,0 +1,58 @@
+package types
+
+// ReplaceRequest is the request for replacing the matches of a search
+// @param Replacement: is the text to replace each match of the query with,
+// `$0` is the matched term and `$1`, `$2`... are the texts matched by the wildcards of the term
+// @param IgnoreCase: matches the term case-insensitively, replace is case-sensitive by default,
+// so the case_sensitive of the search is not used
+type ReplaceRequest struct {
+	SearchContentRequest
+	Replacement string `json:"replacement"`
+	IgnoreCase  bool   `json:"ignore_case,omitempty"`
+}
+
+// ReplaceFile is the replacement of a file
+// @param Hash: is the content hash of the file when it's previewed, the file is only rewritten if it still matches
+// @param Diff: is the unified diff of the replacement
+type ReplaceFile struct {
+	Workspace    string `json:"workspace"`
+	File         string `json:"file"`
+	Hash         string `json:"hash"`
+	Replacements int    `json:"replacements"`
+	Diff         string `json:"diff,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type ReplacePreviewResult struct {
+	Files             []ReplaceFile `json:"files"`
+	TotalReplacements int           `json:"total_replacements"`
+	Truncate          bool          `json:"truncate"`
+}
+
+type ReplacePreviewResponse struct {
+	Code    int                   `json:"code"`
+	Message string                `json:"message"`
+	Data    *ReplacePreviewResult `json:"data,omitempty"`
+}
+
+// ReplaceApplyRequest is the request for rewriting the files of a preview
+// @param Files: is the files of the preview with their hashes, only the workspace, file and hash are used
+type ReplaceApplyRequest struct {
+	ReplaceRequest
+	Files []ReplaceFile `json:"files"`
+}
+
+// ReplaceApplyResult is the result of rewriting files
+// @param Files: is the rewritten files
+// @param Conflicts: is the files not rewritten as they are changed since the preview or failed to be rewritten
+type ReplaceApplyResult struct {
+	Files             []ReplaceFile `json:"files"`
+	Conflicts         []ReplaceFile `json:"conflicts,omitempty"`
+	TotalReplacements int           `json:"total_replacements"`
+}
+
+type ReplaceApplyResponse struct {
+	Code    int                 `json:"code"`
+	Message string              `json:"message"`
+	Data    *ReplaceApplyResult `json:"data,omitempty"`
+}
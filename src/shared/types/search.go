@@ -6,14 +6,48 @@ type SearchLimit struct {
 	MaxFilesResults   int `yaml:"max_files_results" json:"max_files_results,omitempty"`
 }
 
+// SearchFilters are the filters of the files to search
+// @param ModifiedAfter, ModifiedBefore: is an RFC 3339 time, a date like 2006-01-02, or a relative time like 7d, 12h
+// @param MinSize, MaxSize: is the size of the file in bytes, 0 means no limit
 type SearchFilters struct {
-	Path    string `json:"path,omitempty"`
-	Include string `json:"include,omitempty"`
-	Exclude string `json:"exclude,omitempty"`
+	Path           string `json:"path,omitempty"`
+	Include        string `json:"include,omitempty"`
+	Exclude        string `json:"exclude,omitempty"`
+	ModifiedAfter  string `json:"modified_after,omitempty"`
+	ModifiedBefore string `json:"modified_before,omitempty"`
+	MinSize        int64  `json:"min_size,omitempty"`
+	MaxSize        int64  `json:"max_size,omitempty"`
+}
+
+// SearchMultiline enables matches spanning multiple lines
+// @param Window: is the maximum number of lines a match may span, 0 means the whole file
+type SearchMultiline struct {
+	Window int `json:"window,omitempty"`
+}
+
+const (
+	SearchScopeLine   = "line"
+	SearchScopeWindow = "window"
+	SearchScopeFile   = "file"
+)
+
+// SearchScope is where all terms of an AND query must co-occur
+// @param Type: is one of "line" (default), "window" or "file"
+// @param Window: is the number of lines of the "window" scope
+type SearchScope struct {
+	Type   string `json:"type,omitempty"`
+	Window int    `json:"window,omitempty"`
+}
+
+// SearchFuzzy makes all terms of the query fuzzy, they are expanded to the indexed keywords within the edit distance
+// @param Distance: is the maximum edit distance, 0 means 1 for terms up to 4 characters and 2 for longer terms
+type SearchFuzzy struct {
+	Distance int `json:"distance,omitempty"`
 }
 
 // SearchContentRequest is the request for searching the content of a workspace
 // @param Workspace: is the path to the workspace
+// @param Workspaces: is to search multiple workspaces, each item is a workspace path, a glob of paths or "all"
 // @param Query: is the query to search for, refer to the search query syntax in the server/server/search.md
 // @param Filters: is the filters to apply to the search
 // @param Limit: is the limit to apply to the search
@@ -23,25 +57,70 @@ type SearchFilters struct {
 // @param Limit.MaxLines: is the max lines to apply to the search
 // @param Limit.MaxFiles: is the max files to apply to the search
 // @param Limit.MaxLinesPerFile: is the max lines per file to apply to the search
+// @param TimeoutMs: is the timeout of the search in milliseconds, server's default is used if it's not set
+// @param Multiline: is to match terms across lines, nil means each line is matched separately
+// @param Scope: is where all terms must co-occur, the terms are matched in any order if it's not "line"
+// @param Fuzzy: is to make all terms fuzzy, nil means only terms prefixed with `~` are fuzzy
+// @param Variants: is to match the terms in all identifier styles, e.g. `tab_group`, `tabGroup`, `TabGroup` and `tab-group`
+// @param Mode: is one of SearchMode*, the default is to return the matched lines
+// @param Explain: is to return the query plan and the statistics of the search, such searches are never cached
 type SearchContentRequest struct {
-	Workspace     string         `json:"workspace,omitempty"`
-	Query         string         `json:"query,omitempty"`
-	CaseSensitive bool           `json:"case_sensitive,omitempty"`
-	Filters       *SearchFilters `json:"filters,omitempty"`
-	Limit         *SearchLimit   `json:"limit,omitempty"`
-	BeforeAfter   int            `json:"before_after,omitempty"`
+	Workspace     string           `json:"workspace,omitempty"`
+	Workspaces    []string         `json:"workspaces,omitempty"`
+	Query         string           `json:"query,omitempty"`
+	CaseSensitive bool             `json:"case_sensitive,omitempty"`
+	Filters       *SearchFilters   `json:"filters,omitempty"`
+	Limit         *SearchLimit     `json:"limit,omitempty"`
+	BeforeAfter   int              `json:"before_after,omitempty"`
+	TimeoutMs     int              `json:"timeout_ms,omitempty"`
+	Multiline     *SearchMultiline `json:"multiline,omitempty"`
+	Scope         *SearchScope     `json:"scope,omitempty"`
+	Fuzzy         *SearchFuzzy     `json:"fuzzy,omitempty"`
+	Variants      bool             `json:"variants,omitempty"`
+	Mode          string           `json:"mode,omitempty"`
+	Explain       bool             `json:"explain,omitempty"`
 }
 
+const (
+	// SearchModeResults returns the matched lines, it's the default
+	SearchModeResults = "results"
+	// SearchModeCount only counts the hits and the matched files, without the MaxResults limits
+	SearchModeCount = "count"
+	// SearchModeFacets counts the hits and the matched files by top-level directory, extension and language
+	SearchModeFacets = "facets"
+	// SearchModeEstimate only counts the candidate documents of the index, no file is read
+	SearchModeEstimate = "estimate"
+)
+
+// SearchFilesRequest is the request for searching the files of a workspace
+// Workspaces is to search multiple workspaces, each item is a workspace path, a glob of paths or "all"
 type SearchFilesRequest struct {
-	Workspace string `json:"workspace,omitempty"`
-	Query     string `json:"query,omitempty"`
-	Limit     int    `json:"limit,omitempty"`
+	Workspace  string         `json:"workspace,omitempty"`
+	Workspaces []string       `json:"workspaces,omitempty"`
+	Query      string         `json:"query,omitempty"`
+	Limit      int            `json:"limit,omitempty"`
+	Filters    *SearchFilters `json:"filters,omitempty"`
 }
 
+// LineMatch is a match with its context lines
+// Line is the first line of the match, Span is the rest lines if the match spans multiple lines
+// Range is only set for multi-line searches, Term is only set if the hit is of a single term
 type LineMatch struct {
 	Before []SearchContentLine `json:"before,omitempty"`
 	Line   SearchContentLine   `json:"line"`
+	Span   []SearchContentLine `json:"span,omitempty"`
 	After  []SearchContentLine `json:"after,omitempty"`
+	Range  *SearchContentRange `json:"range,omitempty"`
+	Term   string              `json:"term,omitempty"`
+}
+
+// SearchContentRange is the range of a match
+// Lines are 1-based, columns are 0-based byte offsets in the line and EndColumn is exclusive
+type SearchContentRange struct {
+	StartLine   int `json:"start_line"`
+	StartColumn int `json:"start_column"`
+	EndLine     int `json:"end_line"`
+	EndColumn   int `json:"end_column"`
 }
 
 type SearchContentLine struct {
@@ -50,15 +129,47 @@ type SearchContentLine struct {
 	Match      []int  `json:"match,omitempty"`
 }
 
+// SearchContentResult is the matches of a file, Workspace is the path of the workspace the file belongs to
 type SearchContentResult struct {
-	File     string      `json:"file"`
-	Lines    []LineMatch `json:"lines,omitempty"`
-	Truncate bool        `json:"truncate,omitempty"`
+	Workspace string      `json:"workspace,omitempty"`
+	File      string      `json:"file"`
+	Lines     []LineMatch `json:"lines,omitempty"`
+	Truncate  bool        `json:"truncate,omitempty"`
+	Overlay   bool        `json:"overlay,omitempty"` // matched in the unsaved content of an overlay
 }
 
+// SearchContentResults is the results of a content search
+// Expansions are the indexed keywords each fuzzy term was expanded to
+// Counts is only set by the count, facets and estimate modes
+// Variants are the spellings each term was matched in if variants are requested
+// Warnings are the terms the planner could not look up in the index, e.g. a prefix matching too many keywords
 type SearchContentResults struct {
-	Results  []SearchContentResult `json:"results,omitempty"`
-	Truncate bool                  `json:"truncate,omitempty"`
+	Results    []SearchContentResult `json:"results,omitempty"`
+	Truncate   bool                  `json:"truncate,omitempty"`
+	Expansions map[string][]string   `json:"expansions,omitempty"`
+	Variants   map[string][]string   `json:"variants,omitempty"`
+	Warnings   []string              `json:"warnings,omitempty"`
+	Counts     *SearchContentCounts  `json:"counts,omitempty"`
+	Explain    *SearchExplain        `json:"explain,omitempty"`
+}
+
+// SearchContentCounts is the counts of a search in the count, facets or estimate mode
+// Candidates is the number of indexed documents containing the keywords of the query, before any file is read,
+// so it's a fast estimate of TotalFiles. Directories, Extensions and Languages are only set by the facets mode,
+// files in the root of a workspace are counted in the "." directory.
+type SearchContentCounts struct {
+	TotalHits  int `json:"total_hits"`
+	TotalFiles int `json:"total_files"`
+	Candidates int `json:"candidates"`
+
+	Directories map[string]SearchFacet `json:"directories,omitempty"`
+	Extensions  map[string]SearchFacet `json:"extensions,omitempty"`
+	Languages   map[string]SearchFacet `json:"languages,omitempty"`
+}
+
+type SearchFacet struct {
+	Hits  int `json:"hits"`
+	Files int `json:"files"`
 }
 
 type SearchContentResponse struct {
@@ -67,9 +178,134 @@ type SearchContentResponse struct {
 	Data    SearchContentResults `json:"data,omitempty"`
 }
 
+// SearchContentToolResult is the result of the content search MCP tool in the JSON format
+// TotalHits and TotalFiles are the counts of the returned results unless they are counted by the mode
+type SearchContentToolResult struct {
+	TotalHits  int                   `json:"total_hits"`
+	TotalFiles int                   `json:"total_files"`
+	Truncate   bool                  `json:"truncate,omitempty"`
+	Expansions map[string][]string   `json:"expansions,omitempty"`
+	Variants   map[string][]string   `json:"variants,omitempty"`
+	Warnings   []string              `json:"warnings,omitempty"`
+	Counts     *SearchContentCounts  `json:"counts,omitempty"`
+	Results    []SearchContentResult `json:"results"`
+}
+
+// SearchContentSummary is the summary of a content search, it's sent as the last record of a streamed search
+// Cached is set if the results are served from the search result cache, Counts is set as SearchContentResults
+type SearchContentSummary struct {
+	TotalHits  int   `json:"total_hits"`
+	TotalFiles int   `json:"total_files"`
+	Truncate   bool  `json:"truncate,omitempty"`
+	TookMs     int64 `json:"took_ms"`
+	Cached     bool  `json:"cached,omitempty"`
+
+	Expansions map[string][]string  `json:"expansions,omitempty"`
+	Variants   map[string][]string  `json:"variants,omitempty"`
+	Warnings   []string             `json:"warnings,omitempty"`
+	Counts     *SearchContentCounts `json:"counts,omitempty"`
+	Explain    *SearchExplain       `json:"explain,omitempty"`
+}
+
+const (
+	TruncateByMaxResults = "max_results"
+	TruncateByTimeout    = "timeout"
+	TruncateByCancel     = "cancelled"
+)
+
+// SearchExplain is the query plan and the statistics of a search, it's only returned if explain is requested
+// Truncation is why the search stopped early, one of TruncateBy*, empty if it's complete
+type SearchExplain struct {
+	Workspaces []SearchExplainWorkspace `json:"workspaces"`
+	Truncation string                   `json:"truncation,omitempty"`
+}
+
+// SearchExplainWorkspace is the query plan and the statistics of a workspace
+// @param Tree: is the parsed query, OR clauses are separated by `|`, and terms of a clause are joined by AND
+// @param Candidates: is the number of indexed documents matching any clause, the files to read
+// @param FilesSkipped: is the number of candidates excluded by the filters, they are not read
+// @param FilesRemoved: is the number of candidates removed from the disk since they were indexed
+// @param FilesTruncated: is the number of files whose hits are truncated by max_results_per_file
+// @param *Us: is the time of each phase in microseconds, MatchUs includes reading the files
+type SearchExplainWorkspace struct {
+	Workspace string                `json:"workspace"`
+	Tree      string                `json:"tree"`
+	Scope     string                `json:"scope"`
+	Window    int                   `json:"window,omitempty"`
+	Clauses   []SearchExplainClause `json:"clauses"`
+
+	Candidates     int `json:"candidates"`
+	FilesRead      int `json:"files_read"`
+	FilesSkipped   int `json:"files_skipped"`
+	FilesRemoved   int `json:"files_removed"`
+	FilesMatched   int `json:"files_matched"`
+	FilesTruncated int `json:"files_truncated"`
+
+	CompileUs int64 `json:"compile_us"`
+	CollectUs int64 `json:"collect_us"`
+	MatchUs   int64 `json:"match_us"`
+}
+
+// SearchExplainClause is an OR clause of the query
+// Regex matches the terms in order in a line, MultilineRegex is only set for multi-line searches,
+// Plan is the patterns of the terms in the order they are intersected, from the rarest,
+// Intersections is the number of candidates left once each term of Plan is intersected,
+// Candidates is the size of the intersection of the candidates of the terms
+type SearchExplainClause struct {
+	Regex          string              `json:"regex"`
+	MultilineRegex string              `json:"multiline_regex,omitempty"`
+	Terms          []SearchExplainTerm `json:"terms"`
+	Near           []string            `json:"near,omitempty"`
+	Plan           []string            `json:"plan,omitempty"`
+	Intersections  []int               `json:"intersections,omitempty"`
+	Candidates     int                 `json:"candidates"`
+}
+
+// SearchExplainTerm is a term of a clause
+// Prefix is the keyword prefix looked up in the index, Suffix and Infix are the literals of a term starting
+// with wildcards, Expansions are the keywords of a fuzzy or wildcard term, Variants are the spellings of the term,
+// Estimate is the number of documents of the keywords of the term, Skipped is set if the term matches too many
+// keywords to be looked up in the index, Candidates is the number of candidates left once the term is intersected
+type SearchExplainTerm struct {
+	Pattern    string   `json:"pattern"`
+	Prefix     string   `json:"prefix"`
+	Suffix     string   `json:"suffix,omitempty"`
+	Infix      string   `json:"infix,omitempty"`
+	Regex      string   `json:"regex"`
+	Expansions []string `json:"expansions,omitempty"`
+	Variants   []string `json:"variants,omitempty"`
+	Estimate   int      `json:"estimate"`
+	Skipped    bool     `json:"skipped,omitempty"`
+	Candidates int      `json:"candidates"`
+}
+
+const (
+	StreamRecordResult  = "result"
+	StreamRecordSummary = "summary"
+	StreamRecordError   = "error"
+)
+
+// SearchContentStreamRecord is one record of /api/v1/search/content/stream
+// Type is one of "result", "summary" or "error", and only the corresponding field is set
+type SearchContentStreamRecord struct {
+	Type    string                `json:"type"`
+	Result  *SearchContentResult  `json:"result,omitempty"`
+	Summary *SearchContentSummary `json:"summary,omitempty"`
+	Message string                `json:"message,omitempty"`
+}
+
+// SearchFilesResult is the result of a files search
+// Files are the relative paths of the matched files, Matches are the same files with their workspace and score
 type SearchFilesResult struct {
-	Query string   `json:"query"`
-	Files []string `json:"results,omitempty"`
+	Query   string            `json:"query"`
+	Files   []string          `json:"results,omitempty"`
+	Matches []SearchFileMatch `json:"matches,omitempty"`
+}
+
+type SearchFileMatch struct {
+	Workspace string `json:"workspace"`
+	File      string `json:"file"`
+	Score     int    `json:"score"`
 }
 
 type SearchFilesResponse struct {
@@ -77,3 +313,33 @@ type SearchFilesResponse struct {
 	Message string            `json:"message"`
 	Data    SearchFilesResult `json:"data,omitempty"`
 }
+
+// SearchSuggestRequest is the request for the indexed keywords starting with a prefix
+// @param Prefix: is matched case-insensitively, as keywords are indexed in lower case
+// @param Limit: is the maximum number of keywords to return, server's default is used if it's not set
+type SearchSuggestRequest struct {
+	Workspace  string   `json:"workspace,omitempty"`
+	Workspaces []string `json:"workspaces,omitempty"`
+	Prefix     string   `json:"prefix"`
+	Limit      int      `json:"limit,omitempty"`
+}
+
+// SearchSuggestion is an indexed keyword with the number of documents containing it
+type SearchSuggestion struct {
+	Keyword   string `json:"keyword"`
+	Documents int    `json:"documents"`
+}
+
+// SearchSuggestResult is the keywords starting with the prefix, ranked by the number of documents
+// Truncate is set if the prefix matches too many keywords, only the first ones in order are ranked
+type SearchSuggestResult struct {
+	Prefix      string             `json:"prefix"`
+	Suggestions []SearchSuggestion `json:"suggestions"`
+	Truncate    bool               `json:"truncate,omitempty"`
+}
+
+type SearchSuggestResponse struct {
+	Code    int                 `json:"code"`
+	Message string              `json:"message"`
+	Data    SearchSuggestResult `json:"data,omitempty"`
+}